@@ -0,0 +1,193 @@
+package logger
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+
+	"github.com/rs/zerolog"
+)
+
+// Fields of an error which is passed to log functions, e.g. logger.Error(ctx, "unable to save", err)
+const (
+	ErrorMessageKey = "error.message"
+	ErrorTypeKey    = "error.type"
+	ErrorChainKey   = "error.chain"
+	ErrorStackKey   = "error.stack"
+)
+
+const (
+	// maxChainLength limits chains of errors, e.g. joined errors of large batches
+	maxChainLength = 32
+
+	// maxStackDepth limits frames of stack traces
+	maxStackDepth = 32
+)
+
+// ErrorCause is an error of the chain of a logged error
+type ErrorCause struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// stackError records the stack where an error is wrapped, it is transparent to errors.Is, errors.As and logs
+type stackError struct {
+	err   error
+	stack []uintptr
+}
+
+// WithStack wraps an error with the stack of the caller, which is logged as error.stack
+// Errors which already have a stack are returned as is, so the stack is the one closest to the origin of the error
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if findStackError(err) != nil {
+		return err
+	}
+
+	stack := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(2, stack)
+	return &stackError{err: err, stack: stack[:n]}
+}
+
+func (e *stackError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stackError) Unwrap() error {
+	return e.err
+}
+
+// StackTrace returns the stack recorded by WithStack, one frame per item, e.g. "main.run /app/main.go:12"
+func StackTrace(err error) []string {
+	se := findStackError(err)
+	if se == nil {
+		return nil
+	}
+
+	trace := make([]string, 0, len(se.stack))
+	frames := runtime.CallersFrames(se.stack)
+	for {
+		frame, more := frames.Next()
+		trace = append(trace, frame.Function+" "+frame.File+":"+strconv.Itoa(frame.Line))
+		if !more {
+			return trace
+		}
+	}
+}
+
+// findStackError returns the stack of the chain, the chain is walked like errors.As but typed nil errors are not unwrapped
+func findStackError(err error) *stackError {
+	var found *stackError
+	walkErrors(err, func(err error) bool {
+		found, _ = err.(*stackError)
+		return found == nil
+	})
+
+	return found
+}
+
+// GetErrorChain returns the error and its causes in depth-first order by unwrapping wrapped and joined errors
+// Errors wrapped by WithStack are skipped since they are the same as their causes
+func GetErrorChain(err error) []ErrorCause {
+	chain := []ErrorCause{}
+	walkErrors(err, func(err error) bool {
+		if _, ok := err.(*stackError); !ok {
+			chain = append(chain, ErrorCause{Type: fmt.Sprintf("%T", err), Message: errorMessage(err)})
+		}
+
+		return len(chain) < maxChainLength
+	})
+
+	return chain
+}
+
+// walkErrors calls fn with the error and its causes until fn returns false
+func walkErrors(err error, fn func(error) bool) bool {
+	if err == nil {
+		return true
+	}
+
+	if !fn(err) {
+		return false
+	}
+
+	// Methods of typed nil errors may dereference their receivers
+	if isNilError(err) {
+		return true
+	}
+
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		return walkErrors(x.Unwrap(), fn)
+	case interface{ Unwrap() []error }:
+		for _, cause := range x.Unwrap() {
+			if !walkErrors(cause, fn) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// errorMessage returns the message of an error like fmt does: panics of Error are formatted instead of crashing the caller
+// Typed nil errors, e.g. a nil *MyError which is passed as an error, are "<nil>"
+func errorMessage(err error) string {
+	return fmt.Sprint(err)
+}
+
+// isNilError checks if an error is a typed nil, e.g. a nil *MyError which is passed as an error
+func isNilError(err error) bool {
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// firstError returns the first error of the arguments of a log function
+func firstError(v []interface{}) error {
+	for _, arg := range v {
+		if err, ok := arg.(error); ok && err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errorFields are fields of a logged error, messages are redacted
+type errorFields struct {
+	message string
+	chain   []ErrorCause
+	stack   []string
+}
+
+func getErrorFields(err error) errorFields {
+	r := getRedactor()
+	chain := GetErrorChain(err)
+	for i := range chain {
+		chain[i].Message = r.redactString(chain[i].Message)
+	}
+
+	return errorFields{message: r.redactString(errorMessage(err)), chain: chain, stack: StackTrace(err)}
+}
+
+// addErrorFields adds fields of an error to an event
+func addErrorFields(e *zerolog.Event, err error) {
+	if err == nil || !e.Enabled() {
+		return
+	}
+
+	fields := getErrorFields(err)
+	e.Str(ErrorMessageKey, fields.message)
+	if len(fields.chain) > 0 {
+		e.Str(ErrorTypeKey, fields.chain[0].Type)
+	}
+
+	e.Interface(ErrorChainKey, fields.chain)
+	if len(fields.stack) > 0 {
+		e.Strs(ErrorStackKey, fields.stack)
+	}
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hungdv136/gokit/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetErrorChain(t *testing.T) {
+	t.Parallel()
+
+	_, pathErr := os.Open("/not/found")
+	errFirst := errors.New("first")
+	joined := errors.Join(errFirst, fmt.Errorf("second, %w", pathErr))
+	err := fmt.Errorf("unable to open, %w", WithStack(joined))
+
+	chain := GetErrorChain(err)
+	causes := make([]string, len(chain))
+	for i, cause := range chain {
+		causes[i] = cause.Type
+	}
+
+	require.Equal(t, []string{"*fmt.wrapError", "*errors.joinError", "*errors.errorString", "*fmt.wrapError", "*fs.PathError", "syscall.Errno"}, causes)
+	require.Equal(t, err.Error(), chain[0].Message)
+	require.Equal(t, "first", chain[2].Message)
+	require.Empty(t, GetErrorChain(nil))
+
+	// Stacks are transparent and recorded once
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.Same(t, err, WithStack(err))
+	require.Nil(t, WithStack(nil))
+	require.Nil(t, StackTrace(errFirst))
+	require.True(t, strings.HasPrefix(StackTrace(err)[0], "github.com/hungdv136/gokit/logger.TestGetErrorChain "))
+}
+
+func TestLogger_ErrorFields(t *testing.T) {
+	writer := bytes.Buffer{}
+	Setup("test-logger", &writer)
+
+	ctx := context.Background()
+	err := WithStack(fmt.Errorf("unable to save, %w", fs.ErrPermission))
+	NewLogger().Error(ctx, "request failed", err)
+
+	output := types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.Equal(t, "request failed unable to save, permission denied", output["message"])
+	require.Equal(t, "unable to save, permission denied", output[ErrorMessageKey])
+	require.Equal(t, "*fmt.wrapError", output[ErrorTypeKey])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"type": "*fmt.wrapError", "message": "unable to save, permission denied"},
+		map[string]interface{}{"type": "*errors.errorString", "message": "permission denied"},
+	}, output[ErrorChainKey])
+	require.NotEmpty(t, output[ErrorStackKey])
+
+	// Typed nil errors are logged like fmt formats them
+	writer.Reset()
+	var nilErr *testError
+	NewLogger().Error(ctx, "failed", nilErr)
+	output = types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.Equal(t, "failed <nil>", output["message"])
+	require.Equal(t, "<nil>", output[ErrorMessageKey])
+	require.Equal(t, "*logger.testError", output[ErrorTypeKey])
+
+	writer.Reset()
+	NewLogger().Error(ctx, "failed", fmt.Errorf("unable to save, %w", nilErr))
+	output = types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.Equal(t, "unable to save, <nil>", output[ErrorMessageKey])
+	require.Len(t, output[ErrorChainKey], 2)
+
+	writer.Reset()
+	slog.New(NewSlogHandler()).Error("failed", "error", nilErr)
+	output = types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.Equal(t, "<nil>", output["error"])
+	require.Equal(t, "<nil>", output[ErrorMessageKey])
+
+	// Other arguments are only logged in messages
+	writer.Reset()
+	NewLogger().Warn(ctx, "retrying", 3)
+	output = types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.NotContains(t, output, ErrorMessageKey)
+}
+
+// testError dereferences its receiver like most errors, typed nil errors panic
+type testError struct {
+	err error
+}
+
+func (e *testError) Error() string {
+	return "test: " + e.err.Error()
+}
+
+func (e *testError) Unwrap() error {
+	return e.err
+}
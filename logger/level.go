@@ -0,0 +1,284 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// EnvLogLevel is the environment variable of levels, e.g. "debug" or "info,storage=debug,netkit/ginkit=warn"
+// It overrides levels of setup options so operators can change levels without changing configs
+const EnvLogLevel = "LOG_LEVEL"
+
+// defaultLevel is the level if no level is configured
+const defaultLevel = zerolog.InfoLevel
+
+// Levels defines the minimum level of logs and overrides of modules
+// A module is a package path or its trailing segments, e.g. storage or gokit/netkit, and covers its sub-packages
+// Logs of a package use the level of the longest matching module. An empty level is the default level: info
+type Levels struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+// compiledLevels are levels ready to be checked by every log call
+type compiledLevels struct {
+	levels  Levels
+	level   zerolog.Level
+	modules []moduleLevel // Sorted by length, longest first
+	callers sync.Map      // Program counter of the caller -> zerolog.Level
+}
+
+type moduleLevel struct {
+	module string
+	level  zerolog.Level
+}
+
+var (
+	levelsMu      sync.Mutex
+	levelsVersion int
+	revertTimer   *time.Timer
+	baseLevels    *compiledLevels // Levels of the last permanent change, temporary levels revert to them
+	activeLevels  atomic.Pointer[compiledLevels]
+)
+
+func init() {
+	baseLevels = &compiledLevels{level: defaultLevel, levels: Levels{Level: defaultLevel.String()}}
+	activeLevels.Store(baseLevels)
+}
+
+// ParseLevels parses levels in the format of EnvLogLevel: a level and overrides of modules separated by commas
+func ParseLevels(s string) (Levels, error) {
+	levels := Levels{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		module, level, ok := strings.Cut(item, "=")
+		if !ok {
+			levels.Level = item
+			continue
+		}
+
+		if levels.Modules == nil {
+			levels.Modules = map[string]string{}
+		}
+
+		levels.Modules[strings.TrimSpace(module)] = strings.TrimSpace(level)
+	}
+
+	_, err := compileLevels(levels)
+	return levels, err
+}
+
+// String formats levels in the format of EnvLogLevel
+func (l Levels) String() string {
+	items := []string{l.Level}
+	for module, level := range l.Modules {
+		items = append(items, module+"="+level)
+	}
+
+	sort.Strings(items[1:])
+	return strings.Join(items, ",")
+}
+
+// GetLevels returns the current levels
+func GetLevels() Levels {
+	levels := activeLevels.Load().levels
+	modules := make(map[string]string, len(levels.Modules))
+	for module, level := range levels.Modules {
+		modules[module] = level
+	}
+
+	return Levels{Level: levels.Level, Modules: modules}
+}
+
+// SetLevels replaces the current levels and cancels a pending revert
+func SetLevels(levels Levels) error {
+	return SetLevelsFor(levels, 0)
+}
+
+// SetLevelsFor replaces the current levels then reverts them after the duration, e.g. to debug an incident
+// Levels revert to the last levels which are set without a duration, even if temporary levels are stacked
+// Zero durations do not revert. A later change cancels the pending revert
+func SetLevelsFor(levels Levels, duration time.Duration) error {
+	compiled, err := compileLevels(levels)
+	if err != nil {
+		return err
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	applyLevels(compiled)
+	if revertTimer != nil {
+		revertTimer.Stop()
+		revertTimer = nil
+	}
+
+	if duration <= 0 {
+		baseLevels = compiled
+		return nil
+	}
+
+	version := levelsVersion
+	revertTimer = time.AfterFunc(duration, func() {
+		revertLevels(version)
+	})
+
+	return nil
+}
+
+func revertLevels(version int) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	if version != levelsVersion {
+		return
+	}
+
+	base := baseLevels
+	applyLevels(&compiledLevels{levels: base.levels, level: base.level, modules: base.modules})
+	revertTimer = nil
+	NewLogger().Fields(context.Background(), "levels", base.levels.String()).Info(context.Background(), "reverted log levels")
+}
+
+// applyLevels activates levels, levelsMu must be held
+// Zerolog filters by the most verbose level, the level of each call is checked by enabled
+func applyLevels(compiled *compiledLevels) {
+	minLevel := compiled.level
+	for _, m := range compiled.modules {
+		minLevel = min(minLevel, m.level)
+	}
+
+	levelsVersion++
+	activeLevels.Store(compiled)
+	zerolog.SetGlobalLevel(minLevel)
+}
+
+func compileLevels(levels Levels) (*compiledLevels, error) {
+	compiled := &compiledLevels{level: defaultLevel, levels: Levels{Level: defaultLevel.String()}}
+	if len(levels.Level) > 0 {
+		level, err := parseLevel(levels.Level)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled.level = level
+		compiled.levels.Level = level.String()
+	}
+
+	if len(levels.Modules) > 0 {
+		compiled.levels.Modules = make(map[string]string, len(levels.Modules))
+	}
+
+	for module, value := range levels.Modules {
+		module = strings.Trim(module, "/")
+		if len(module) == 0 {
+			return nil, fmt.Errorf("invalid log level %q: module is required", value)
+		}
+
+		level, err := parseLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w of module %q", err, module)
+		}
+
+		compiled.levels.Modules[module] = level.String()
+		compiled.modules = append(compiled.modules, moduleLevel{module: module, level: level})
+	}
+
+	sort.Slice(compiled.modules, func(i, j int) bool {
+		return len(compiled.modules[i].module) > len(compiled.modules[j].module)
+	})
+
+	return compiled, nil
+}
+
+func parseLevel(s string) (zerolog.Level, error) {
+	level, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(s)))
+	if err != nil || level == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %q", s)
+	}
+
+	return level, nil
+}
+
+// enabled checks the level of the package of the caller, skip is the number of frames above the caller of enabled
+func enabled(level zerolog.Level, skip int) bool {
+	compiled := activeLevels.Load()
+	if len(compiled.modules) == 0 {
+		return level >= compiled.level
+	}
+
+	// Skip runtime.Callers and enabled
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return level >= compiled.level
+	}
+
+	return level >= compiled.getCallerLevel(pcs[0])
+}
+
+// enabledAt checks the level of the package of a program counter, e.g. of a slog.Record. Zero is an unknown caller
+func enabledAt(level zerolog.Level, pc uintptr) bool {
+	compiled := activeLevels.Load()
+	if len(compiled.modules) == 0 || pc == 0 {
+		return level >= compiled.level
+	}
+
+	return level >= compiled.getCallerLevel(pc)
+}
+
+func (c *compiledLevels) getCallerLevel(pc uintptr) zerolog.Level {
+	if cached, ok := c.callers.Load(pc); ok {
+		return cached.(zerolog.Level)
+	}
+
+	level := c.getPackageLevel(getPackagePath(pc))
+	c.callers.Store(pc, level)
+	return level
+}
+
+// getPackageLevel returns the level of the longest module which is a trailing part of the package path or of a parent
+func (c *compiledLevels) getPackageLevel(pkg string) zerolog.Level {
+	path := "/" + pkg
+	for _, m := range c.modules {
+		i := strings.Index(path, "/"+m.module)
+		for i >= 0 {
+			end := i + 1 + len(m.module)
+			if end == len(path) || path[end] == '/' {
+				return m.level
+			}
+
+			next := strings.Index(path[i+1:], "/"+m.module)
+			if next < 0 {
+				break
+			}
+
+			i += 1 + next
+		}
+	}
+
+	return c.level
+}
+
+// getPackagePath returns the package path of a program counter of runtime.Callers, e.g. github.com/hungdv136/gokit/storage
+func getPackagePath(pc uintptr) string {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	name := frame.Function
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+
+	return name
+}
@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevels(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected Levels
+		hasErr   bool
+	}{
+		{name: "level", value: "debug", expected: Levels{Level: "debug"}},
+		{name: "modules", value: " warn, storage=debug ,netkit/ginkit=error", expected: Levels{Level: "warn", Modules: map[string]string{"storage": "debug", "netkit/ginkit": "error"}}},
+		{name: "only modules", value: "storage=debug", expected: Levels{Modules: map[string]string{"storage": "debug"}}},
+		{name: "invalid level", value: "verbose", hasErr: true},
+		{name: "invalid module level", value: "info,storage=", hasErr: true},
+		{name: "missing module", value: "info,=debug", hasErr: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			levels, err := ParseLevels(tc.value)
+			if tc.hasErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, levels)
+		})
+	}
+}
+
+func TestGetPackageLevel(t *testing.T) {
+	t.Parallel()
+
+	compiled, err := compileLevels(Levels{Level: "info", Modules: map[string]string{
+		"storage":       "debug",
+		"netkit":        "warn",
+		"netkit/ginkit": "error",
+	}})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		pkg      string
+		expected zerolog.Level
+	}{
+		{pkg: "github.com/hungdv136/gokit/storage", expected: zerolog.DebugLevel},
+		{pkg: "github.com/hungdv136/gokit/storage/internal", expected: zerolog.DebugLevel},
+		{pkg: "github.com/hungdv136/gokit/netkit", expected: zerolog.WarnLevel},
+		{pkg: "github.com/hungdv136/gokit/netkit/ginkit", expected: zerolog.ErrorLevel},
+		{pkg: "github.com/hungdv136/gokit/objectstorage", expected: zerolog.InfoLevel},
+		{pkg: "main", expected: zerolog.InfoLevel},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, compiled.getPackageLevel(tc.pkg), tc.pkg)
+	}
+}
+
+// Tests below change global levels, they must not run in parallel
+func TestLevels(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+
+	ctx := context.Background()
+	writer := &bytes.Buffer{}
+	SetupDefaultLogger("test-logger", writer, WithLevel("warn"), WithModuleLevel("gokit/logger", "debug"))
+	Debug(ctx, "debug of the module")
+	NewLogger().Debug(ctx, "debug of the logger")
+	require.Contains(t, writer.String(), "debug of the module")
+	require.Contains(t, writer.String(), "debug of the logger")
+
+	writer.Reset()
+	SetupDefaultLogger("test-logger", writer, WithLevel("warn"), WithModuleLevel("storage", "debug"))
+	Debug(ctx, "debug of another module")
+	Info(ctx, "info")
+	Warn(ctx, "warn")
+	require.NotContains(t, writer.String(), "debug of another module")
+	require.NotContains(t, writer.String(), "info")
+	require.Contains(t, writer.String(), "warn")
+
+	// The environment variable overrides options
+	t.Setenv(EnvLogLevel, "error,storage=warn")
+	SetupDefaultLogger("test-logger", writer, WithLevel("debug"), WithModuleLevel("storage", "debug"), WithModuleLevel("auth", "info"))
+	require.Equal(t, Levels{Level: "error", Modules: map[string]string{"storage": "warn", "auth": "info"}}, GetLevels())
+
+	// Invalid levels fall back to the default level
+	t.Setenv(EnvLogLevel, "verbose")
+	writer.Reset()
+	SetupDefaultLogger("test-logger", writer, WithLevel("debug"))
+	require.Equal(t, Levels{Level: "debug", Modules: map[string]string{}}, GetLevels())
+	require.Contains(t, writer.String(), "invalid log levels")
+}
+
+func TestSetLevelsFor(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+	SetupDefaultLogger("test-logger", &bytes.Buffer{}, WithLevel("warn"))
+
+	require.Error(t, SetLevelsFor(Levels{Level: "verbose"}, time.Minute))
+	require.Equal(t, "warn", GetLevels().Level)
+
+	require.NoError(t, SetLevelsFor(Levels{Level: "debug"}, 50*time.Millisecond))
+	require.Equal(t, "debug", GetLevels().Level)
+	require.Eventually(t, func() bool { return GetLevels().Level == "warn" }, time.Second, 10*time.Millisecond)
+	require.Equal(t, zerolog.WarnLevel, zerolog.GlobalLevel())
+
+	// Stacked temporary levels revert to the last permanent levels
+	require.NoError(t, SetLevelsFor(Levels{Level: "debug"}, time.Hour))
+	require.NoError(t, SetLevelsFor(Levels{Level: "error"}, 50*time.Millisecond))
+	require.Equal(t, "error", GetLevels().Level)
+	require.Eventually(t, func() bool { return GetLevels().Level == "warn" }, time.Second, 10*time.Millisecond)
+
+	// A later change cancels the pending revert
+	require.NoError(t, SetLevelsFor(Levels{Level: "debug"}, 50*time.Millisecond))
+	require.NoError(t, SetLevels(Levels{Level: "error"}))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, "error", GetLevels().Level)
+}
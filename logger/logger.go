@@ -13,8 +13,8 @@ var defaultLogger Logger = func() Logger {
 }()
 
 // SetupDefaultLogger setup default value
-func SetupDefaultLogger(module string, writer io.Writer) {
-	Setup(module, writer)
+func SetupDefaultLogger(module string, writer io.Writer, options ...Option) {
+	Setup(module, writer, options...)
 	defaultLogger = NewLogger().AddCallDepth(1)
 }
 
@@ -61,3 +61,8 @@ func Fields(ctx context.Context, keysAndValues ...interface{}) Logger {
 func WithContextualValues(ctx context.Context, keysAndValues ...interface{}) context.Context {
 	return defaultLogger.WithContextualValues(ctx, keysAndValues...)
 }
+
+// SetDefault replaces the default logger of package functions, e.g. with NewSlogLogger
+func SetDefault(l Logger) {
+	defaultLogger = l.AddCallDepth(1)
+}
@@ -0,0 +1,290 @@
+package logger
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Mask replaces redacted values
+const Mask = "[REDACTED]"
+
+// maxRedactDepth limits nested values which are walked for redaction, deeper values are logged as is
+const maxRedactDepth = 8
+
+// DefaultRedactedFields are names of fields whose values are masked, see WithRedactedFields
+var DefaultRedactedFields = []string{"password", "secret", "token", "authorization", "cookie", "email"}
+
+// Patterns of values which are masked in messages and string fields
+// Card numbers are only masked with WithRedactedCardNumbers since IDs and timestamps may pass their check digits
+var (
+	JWTPattern        = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	CardNumberPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+)
+
+var activeRedactor atomic.Pointer[redactor]
+
+func init() {
+	activeRedactor.Store(newRedactor(nil, nil, false))
+}
+
+// redactor masks values of sensitive fields, struct fields tagged with `log:"redact"` and matches of patterns
+type redactor struct {
+	fields   []string
+	patterns []redactPattern
+}
+
+type redactPattern struct {
+	re    *regexp.Regexp
+	valid func(string) bool // Reduces false positives, nil masks every match
+}
+
+// newRedactor creates a redactor with default fields and patterns plus the given ones
+func newRedactor(fields []string, patterns []*regexp.Regexp, cardNumbers bool) *redactor {
+	r := &redactor{patterns: []redactPattern{{re: JWTPattern}}}
+	if cardNumbers {
+		r.patterns = append(r.patterns, redactPattern{re: CardNumberPattern, valid: isLuhnValid})
+	}
+
+	for _, field := range append(DefaultRedactedFields, fields...) {
+		r.fields = append(r.fields, normalizeFieldName(field))
+	}
+
+	for _, re := range patterns {
+		r.patterns = append(r.patterns, redactPattern{re: re})
+	}
+
+	return r
+}
+
+func getRedactor() *redactor {
+	return activeRedactor.Load()
+}
+
+// isSensitive checks if a field name contains a sensitive name, e.g. access_token or X-Authorization
+func (r *redactor) isSensitive(name string) bool {
+	name = normalizeFieldName(name)
+	for _, field := range r.fields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactString masks matches of patterns
+func (r *redactor) redactString(s string) string {
+	for _, p := range r.patterns {
+		s = p.re.ReplaceAllStringFunc(s, func(match string) string {
+			if p.valid != nil && !p.valid(match) {
+				return match
+			}
+
+			return Mask
+		})
+	}
+
+	return s
+}
+
+// redactKeysAndValues returns a copy of keys and values whose sensitive values are masked
+func (r *redactor) redactKeysAndValues(keysAndValues []interface{}) []interface{} {
+	redacted := make([]interface{}, len(keysAndValues))
+	copy(redacted, keysAndValues)
+	for i := 0; i+1 < len(redacted); i += 2 {
+		redacted[i+1] = r.redactField(redacted[i], redacted[i+1])
+	}
+
+	return redacted
+}
+
+// redactField masks the value of a sensitive key or the sensitive parts of the value
+func (r *redactor) redactField(key interface{}, value interface{}) interface{} {
+	if name, ok := key.(string); ok && r.isSensitive(name) {
+		return Mask
+	}
+
+	redacted, _ := r.redactValue(value, 0)
+	return redacted
+}
+
+// redactArgs replaces arguments of messages which have sensitive fields, strings are masked after formatting
+func (r *redactor) redactArgs(v []interface{}) []interface{} {
+	var redacted []interface{}
+	for i, arg := range v {
+		switch arg.(type) {
+		case string, error, fmt.Stringer:
+			continue
+		}
+
+		value, changed := r.redactValue(arg, 0)
+		if !changed {
+			continue
+		}
+
+		if redacted == nil {
+			redacted = append([]interface{}{}, v...)
+		}
+
+		redacted[i] = value
+	}
+
+	if redacted == nil {
+		return v
+	}
+
+	return redacted
+}
+
+// redactValue returns a masked copy of a value if it has sensitive parts, otherwise the value as is
+// Structs, maps and slices with sensitive parts are copied to maps and slices of their JSON names
+func (r *redactor) redactValue(v interface{}, depth int) (interface{}, bool) {
+	switch x := v.(type) {
+	case nil:
+		return v, false
+	case string:
+		redacted := r.redactString(x)
+		return redacted, redacted != x
+	case error:
+		message := errorMessage(x)
+		if redacted := r.redactString(message); redacted != message {
+			return redacted, true
+		}
+
+		return v, false
+	}
+
+	if depth >= maxRedactDepth {
+		return v, false
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return v, false
+		}
+
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		return r.redactStruct(v, rv, depth)
+	case reflect.Map:
+		return r.redactMap(v, rv, depth)
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false
+		}
+
+		items := make([]interface{}, rv.Len())
+		changed := false
+		for i := range items {
+			item, itemChanged := r.redactValue(rv.Index(i).Interface(), depth+1)
+			items[i], changed = item, changed || itemChanged
+		}
+
+		if changed {
+			return items, true
+		}
+	}
+
+	return v, false
+}
+
+func (r *redactor) redactStruct(v interface{}, rv reflect.Value, depth int) (interface{}, bool) {
+	fields := map[string]interface{}{}
+	changed := false
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		if field.Tag.Get("log") == "redact" || r.isSensitive(name) {
+			fields[name], changed = Mask, true
+			continue
+		}
+
+		value, valueChanged := r.redactValue(rv.Field(i).Interface(), depth+1)
+		fields[name], changed = value, changed || valueChanged
+	}
+
+	if changed {
+		return fields, true
+	}
+
+	return v, false
+}
+
+func (r *redactor) redactMap(v interface{}, rv reflect.Value, depth int) (interface{}, bool) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return v, false
+	}
+
+	items := make(map[string]interface{}, rv.Len())
+	changed := false
+	iter := rv.MapRange()
+	for iter.Next() {
+		key := iter.Key().String()
+		if r.isSensitive(key) {
+			items[key], changed = Mask, true
+			continue
+		}
+
+		value, valueChanged := r.redactValue(iter.Value().Interface(), depth+1)
+		items[key], changed = value, changed || valueChanged
+	}
+
+	if changed {
+		return items, true
+	}
+
+	return v, false
+}
+
+func normalizeFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '_', '-', '.', ' ':
+			return -1
+		}
+
+		return r
+	}, strings.ToLower(name))
+}
+
+// isLuhnValid checks the check digit of card numbers which may have spaces or dashes
+func isLuhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+
+		d := int(s[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
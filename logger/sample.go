@@ -0,0 +1,291 @@
+package logger
+
+import (
+	"container/list"
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	rs "github.com/rs/zerolog/log"
+)
+
+const (
+	// maxSamplingKeys bounds the memory of counters of a level, suppressed counts of evicted keys are reported at eviction
+	maxSamplingKeys = 1024
+
+	defaultSamplingTick           = time.Second
+	defaultSamplingReportInterval = 10 * time.Second
+)
+
+// SamplingPolicy limits logs of the same key, e.g. the same error of every request while a downstream is down
+// The first logs of a key are written in each tick, then every Thereafter-th. Zero Thereafter drops the rest
+type SamplingPolicy struct {
+	First      int
+	Thereafter int
+	Tick       time.Duration // Defaults to a second
+	ByCaller   bool          // Keys are call sites instead of messages
+}
+
+// WithSampling samples logs of every level with the policy
+func WithSampling(policy SamplingPolicy) Option {
+	return func(o *options) {
+		o.sampling = &policy
+	}
+}
+
+// WithLevelSampling samples logs of a level with the policy, it overrides the policy of WithSampling
+func WithLevelSampling(level string, policy SamplingPolicy) Option {
+	return func(o *options) {
+		if o.levelSampling == nil {
+			o.levelSampling = map[string]SamplingPolicy{}
+		}
+
+		o.levelSampling[level] = policy
+	}
+}
+
+// WithUnsampledErrors never samples logs of error level
+func WithUnsampledErrors() Option {
+	return func(o *options) {
+		o.unsampledErrors = true
+	}
+}
+
+// WithSamplingReportInterval sets the interval of reports of suppressed logs, it defaults to 10 seconds
+func WithSamplingReportInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.samplingReportInterval = interval
+	}
+}
+
+var activeSampler atomic.Pointer[sampler]
+
+// sampler counts logs of each level and key, suppressed counts are reported periodically by a goroutine
+type sampler struct {
+	levels map[zerolog.Level]*levelSampler
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// levelSampler counts logs of a level by key, the least recently used keys are evicted beyond maxSamplingKeys
+type levelSampler struct {
+	level    zerolog.Level
+	policy   SamplingPolicy
+	mu       sync.Mutex
+	counters map[sampleKey]*list.Element // Values of elements are *sampleCounter
+	lru      *list.List                  // Most recently used first
+}
+
+// sampleKey is the message of sampling by message or the call site of sampling by caller
+type sampleKey struct {
+	message string
+	pc      uintptr
+}
+
+type sampleCounter struct {
+	key        sampleKey
+	resetAt    int64
+	count      int
+	suppressed int64
+}
+
+// setupSampling starts a sampler if policies are configured
+func setupSampling(o *options) error {
+	policies := map[zerolog.Level]SamplingPolicy{}
+	if o.sampling != nil {
+		for _, level := range []zerolog.Level{zerolog.TraceLevel, zerolog.DebugLevel, zerolog.InfoLevel, zerolog.WarnLevel, zerolog.ErrorLevel} {
+			policies[level] = *o.sampling
+		}
+	}
+
+	var err error
+	for value, policy := range o.levelSampling {
+		level, parseErr := parseLevel(value)
+		if parseErr != nil {
+			err = parseErr
+			continue
+		}
+
+		policies[level] = policy
+	}
+
+	if o.unsampledErrors {
+		for level := range policies {
+			if level >= zerolog.ErrorLevel {
+				delete(policies, level)
+			}
+		}
+	}
+
+	var s *sampler
+	if len(policies) > 0 {
+		s = &sampler{levels: map[zerolog.Level]*levelSampler{}, stop: make(chan struct{}), done: make(chan struct{})}
+		for level, policy := range policies {
+			if policy.Tick <= 0 {
+				policy.Tick = defaultSamplingTick
+			}
+
+			s.levels[level] = &levelSampler{level: level, policy: policy, counters: map[sampleKey]*list.Element{}, lru: list.New()}
+		}
+
+		interval := o.samplingReportInterval
+		if interval <= 0 {
+			interval = defaultSamplingReportInterval
+		}
+
+		go s.run(interval)
+	}
+
+	activeSampler.Store(s)
+	return err
+}
+
+// stopSampling stops the sampler, it reports its suppressed logs before Setup replaces the writer
+func stopSampling() {
+	if s := activeSampler.Swap(nil); s != nil {
+		close(s.stop)
+		<-s.done
+	}
+}
+
+// samplesByCaller checks if logs of a level need their call sites for sampling
+func samplesByCaller(level zerolog.Level) bool {
+	s := activeSampler.Load()
+	if s == nil {
+		return false
+	}
+
+	ls, ok := s.levels[level]
+	return ok && ls.policy.ByCaller
+}
+
+// sample checks if a log of a level is written, pc is the call site
+func sample(level zerolog.Level, message string, pc uintptr) bool {
+	s := activeSampler.Load()
+	if s == nil {
+		return true
+	}
+
+	ls, ok := s.levels[level]
+	if !ok {
+		return true
+	}
+
+	return ls.allow(message, pc)
+}
+
+func (ls *levelSampler) allow(message string, pc uintptr) bool {
+	key := sampleKey{message: message}
+	if ls.policy.ByCaller {
+		key = sampleKey{pc: pc}
+	}
+
+	allowed, evicted := ls.count(key, time.Now().UnixNano())
+	if evicted != nil {
+		ls.report(evicted.key, evicted.suppressed)
+	}
+
+	return allowed
+}
+
+// count counts a log of the key, it returns the counter which is evicted if it has suppressed logs
+func (ls *levelSampler) count(key sampleKey, now int64) (bool, *sampleCounter) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var evicted *sampleCounter
+	elem, ok := ls.counters[key]
+	if ok {
+		ls.lru.MoveToFront(elem)
+	} else {
+		if ls.lru.Len() >= maxSamplingKeys {
+			oldest := ls.lru.Remove(ls.lru.Back()).(*sampleCounter)
+			delete(ls.counters, oldest.key)
+			if oldest.suppressed > 0 {
+				evicted = oldest
+			}
+		}
+
+		elem = ls.lru.PushFront(&sampleCounter{key: key})
+		ls.counters[key] = elem
+	}
+
+	c := elem.Value.(*sampleCounter)
+	if now >= c.resetAt {
+		c.count, c.resetAt = 0, now+ls.policy.Tick.Nanoseconds()
+	}
+
+	c.count++
+	if c.count <= ls.policy.First || (ls.policy.Thereafter > 0 && (c.count-ls.policy.First)%ls.policy.Thereafter == 0) {
+		return true, evicted
+	}
+
+	c.suppressed++
+	return false, evicted
+}
+
+// collect returns counters with suppressed logs and resets them, counters of ended ticks without suppressed logs are removed
+func (ls *levelSampler) collect(now int64) []sampleCounter {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var suppressed []sampleCounter
+	for elem := ls.lru.Front(); elem != nil; {
+		next := elem.Next()
+		c := elem.Value.(*sampleCounter)
+		switch {
+		case c.suppressed > 0:
+			suppressed = append(suppressed, *c)
+			c.suppressed = 0
+		case now >= c.resetAt:
+			ls.lru.Remove(elem)
+			delete(ls.counters, c.key)
+		}
+
+		elem = next
+	}
+
+	return suppressed
+}
+
+func (s *sampler) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.report()
+		case <-s.stop:
+			s.report()
+			return
+		}
+	}
+}
+
+// report writes suppressed counts at the level of the suppressed logs, reports are not sampled
+func (s *sampler) report() {
+	now := time.Now().UnixNano()
+	for _, ls := range s.levels {
+		for _, c := range ls.collect(now) {
+			ls.report(c.key, c.suppressed)
+		}
+	}
+}
+
+func (ls *levelSampler) report(key sampleKey, suppressed int64) {
+	e := rs.Ctx(context.Background()).WithLevel(ls.level).Int64("sampling.suppressed", suppressed)
+	if ls.policy.ByCaller {
+		frame, _ := runtime.CallersFrames([]uintptr{key.pc}).Next()
+		e = e.Str("sampling.caller", zerolog.CallerMarshalFunc(key.pc, frame.File, frame.Line))
+	} else {
+		e = e.Str("sampling.message", key.message)
+	}
+
+	e.Msg("suppressed logs")
+}
@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hungdv136/gokit/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampling(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+
+	ctx := context.Background()
+	writer := &syncBuffer{}
+	SetupDefaultLogger("test-logger", writer,
+		WithSampling(SamplingPolicy{First: 2, Thereafter: 5, Tick: time.Hour}),
+		WithLevelSampling("warn", SamplingPolicy{First: 1, Tick: time.Hour, ByCaller: true}),
+		WithUnsampledErrors(),
+		WithSamplingReportInterval(time.Hour),
+	)
+
+	err := errors.New("downstream is down")
+	for i := 0; i < 12; i++ {
+		Info(ctx, "unable to call downstream", err)
+		Error(ctx, "unable to call downstream", err)
+		Warn(ctx, "retrying", i)
+	}
+
+	Info(ctx, "another message")
+	Warn(ctx, "another call site")
+
+	logs := writer.getLogs(t)
+	require.Equal(t, 4, countLogs(logs, "info", "unable to call downstream downstream is down"))
+	require.Equal(t, 12, countLogs(logs, "error", "unable to call downstream downstream is down"))
+	require.Equal(t, 1, countLogs(logs, "warn", "retrying 0"))
+	require.Equal(t, 1, countLogs(logs, "info", "another message"))
+	require.Equal(t, 1, countLogs(logs, "warn", "another call site"))
+	require.Len(t, logs, 19)
+
+	// Suppressed counts are reported when the sampler stops
+	writer.reset()
+	SetupDefaultLogger("test-logger", writer)
+	logs = writer.getLogs(t)
+	require.Len(t, logs, 2)
+	for _, log := range logs {
+		require.Equal(t, "suppressed logs", log["message"])
+		switch log["level"] {
+		case "info":
+			require.Equal(t, 8.0, log["sampling.suppressed"])
+			require.Equal(t, "unable to call downstream downstream is down", log["sampling.message"])
+		case "warn":
+			require.Equal(t, 11.0, log["sampling.suppressed"])
+			require.True(t, strings.HasPrefix(log["sampling.caller"].(string), "sample_test.go:"), log["sampling.caller"])
+		default:
+			require.Fail(t, "unexpected report", log)
+		}
+	}
+
+	// Sampling stops with the sampler
+	for i := 0; i < 5; i++ {
+		Info(ctx, "unsampled")
+	}
+
+	require.Equal(t, 5, countLogs(writer.getLogs(t), "info", "unsampled"))
+}
+
+func TestSampling_Tick(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+
+	ctx := context.Background()
+	writer := &syncBuffer{}
+	SetupDefaultLogger("test-logger", writer,
+		WithSampling(SamplingPolicy{First: 1, Tick: 50 * time.Millisecond}),
+		WithSamplingReportInterval(20*time.Millisecond),
+	)
+
+	Info(ctx, "tick")
+	Info(ctx, "tick")
+	require.Eventually(t, func() bool {
+		return writer.contains(`"sampling.suppressed":1`)
+	}, time.Second, 10*time.Millisecond, "suppressed counts are reported periodically")
+
+	time.Sleep(50 * time.Millisecond)
+	Info(ctx, "tick")
+	require.Equal(t, 2, countLogs(writer.getLogs(t), "info", "tick"))
+}
+
+func TestSampling_Keys(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+
+	ctx := context.Background()
+	writer := &syncBuffer{}
+	SetupDefaultLogger("test-logger", writer,
+		WithSampling(SamplingPolicy{First: 1, Tick: time.Hour}),
+		WithSamplingReportInterval(time.Hour),
+	)
+
+	// A storm of a message does not suppress other messages
+	for i := 0; i < 3; i++ {
+		Info(ctx, "storm")
+	}
+
+	for i := 0; i < maxSamplingKeys; i++ {
+		Info(ctx, "message", i)
+	}
+
+	logs := writer.getLogs(t)
+	require.Equal(t, 1, countLogs(logs, "info", "storm"))
+	require.Len(t, logs, maxSamplingKeys+2)
+
+	// The least recently used key is evicted with a report of its suppressed logs
+	require.Equal(t, 1, countLogs(logs, "info", "suppressed logs"))
+	for _, log := range logs {
+		if log["message"] == "suppressed logs" {
+			require.Equal(t, "storm", log["sampling.message"])
+			require.Equal(t, 2.0, log["sampling.suppressed"])
+		}
+	}
+
+	// Evicted keys start over
+	writer.reset()
+	Info(ctx, "storm")
+	SetupDefaultLogger("test-logger", writer)
+	logs = writer.getLogs(t)
+	require.Equal(t, 1, countLogs(logs, "info", "storm"))
+	require.Len(t, logs, 1)
+}
+
+func countLogs(logs []types.Map, level string, message string) int {
+	count := 0
+	for _, log := range logs {
+		if log["level"] == level && log["message"] == message {
+			count++
+		}
+	}
+
+	return count
+}
+
+// syncBuffer is written by the goroutine which reports suppressed logs
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Reset()
+}
+
+func (b *syncBuffer) contains(s string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return strings.Contains(b.buf.String(), s)
+}
+
+func (b *syncBuffer) getLogs(t *testing.T) []types.Map {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	logs := []types.Map{}
+	for i, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		log := types.Map{}
+		require.NoError(t, json.Unmarshal([]byte(line), &log), "line "+strconv.Itoa(i))
+		logs = append(logs, log)
+	}
+
+	return logs
+}
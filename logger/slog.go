@@ -0,0 +1,306 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog"
+	rs "github.com/rs/zerolog/log"
+)
+
+var ctxKeySlogAttrs = &struct{ name string }{"slog_attrs"}
+
+// SlogHandler is a slog.Handler which writes records with the zerolog logger of Setup
+// Records carry contextual values of WithContextualValues and the request ID of SaveID, and follow levels of SetLevels
+// Attributes of groups are logged with dotted keys, e.g. http.method. Errors are logged as fields like Error does
+// Sensitive attributes and messages are redacted and records are sampled like logs of Logger
+//
+//	slog.SetDefault(slog.New(logger.NewSlogHandler()))
+type SlogHandler struct {
+	group string // Prefix of keys of attributes, e.g. http.
+	attrs []prefixedAttr
+}
+
+type prefixedAttr struct {
+	prefix string
+	attr   slog.Attr
+}
+
+// NewSlogHandler returns a handler which writes records with the zerolog logger of Setup
+func NewSlogHandler() *SlogHandler {
+	return &SlogHandler{}
+}
+
+// Enabled checks the most verbose level, levels of modules are checked by Handle with the caller of the record
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return toZerologLevel(level) >= zerolog.GlobalLevel()
+}
+
+// Handle writes a record, the logger of the context carries contextual values
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	level := toZerologLevel(record.Level)
+	if !enabledAt(level, record.PC) {
+		return nil
+	}
+
+	message := getRedactor().redactString(record.Message)
+	if !sample(level, message, record.PC) {
+		return nil
+	}
+
+	e := rs.Ctx(UnwrapContext(ctx)).WithLevel(level)
+	if e == nil {
+		return nil
+	}
+
+	event := &slogEvent{e: e}
+	for _, a := range h.attrs {
+		event.add(a.prefix, a.attr)
+	}
+
+	record.Attrs(func(a slog.Attr) bool {
+		event.add(h.group, a)
+		return true
+	})
+
+	if record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		e.Str(zerolog.CallerFieldName, zerolog.CallerMarshalFunc(record.PC, frame.File, frame.Line))
+	}
+
+	e.Msg(message)
+	return nil
+}
+
+// WithAttrs returns a handler which adds the attributes to every record
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	clone := &SlogHandler{group: h.group, attrs: make([]prefixedAttr, 0, len(h.attrs)+len(attrs))}
+	clone.attrs = append(clone.attrs, h.attrs...)
+	for _, a := range attrs {
+		clone.attrs = append(clone.attrs, prefixedAttr{prefix: h.group, attr: a})
+	}
+
+	return clone
+}
+
+// WithGroup returns a handler which prefixes keys of later attributes with the group
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+
+	return &SlogHandler{group: h.group + name + ".", attrs: h.attrs}
+}
+
+// slogEvent adds attributes to an event, the first error is logged as fields too
+type slogEvent struct {
+	e        *zerolog.Event
+	hasError bool
+}
+
+func (s *slogEvent) add(prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if len(a.Key) > 0 {
+			prefix += a.Key + "."
+		}
+
+		for _, attr := range a.Value.Group() {
+			s.add(prefix, attr)
+		}
+
+		return
+	}
+
+	key := prefix + a.Key
+	r := getRedactor()
+	if r.isSensitive(a.Key) {
+		s.e.Str(key, Mask)
+		return
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		s.e.Str(key, r.redactString(a.Value.String()))
+	case slog.KindInt64:
+		s.e.Int64(key, a.Value.Int64())
+	case slog.KindUint64:
+		s.e.Uint64(key, a.Value.Uint64())
+	case slog.KindFloat64:
+		s.e.Float64(key, a.Value.Float64())
+	case slog.KindBool:
+		s.e.Bool(key, a.Value.Bool())
+	case slog.KindDuration:
+		s.e.Dur(key, a.Value.Duration())
+	case slog.KindTime:
+		s.e.Time(key, a.Value.Time())
+	default:
+		if err, ok := a.Value.Any().(error); ok {
+			s.e.Str(key, r.redactString(errorMessage(err)))
+			if !s.hasError {
+				s.hasError = true
+				addErrorFields(s.e, err)
+			}
+
+			return
+		}
+
+		value, _ := r.redactValue(a.Value.Any(), 0)
+		s.e.Interface(key, value)
+	}
+}
+
+func toZerologLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level < slog.LevelDebug:
+		return zerolog.TraceLevel
+	case level < slog.LevelInfo:
+		return zerolog.DebugLevel
+	case level < slog.LevelWarn:
+		return zerolog.InfoLevel
+	case level < slog.LevelError:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.ErrorLevel
+	}
+}
+
+// NewSlogLogger returns a Logger which writes records to a slog.Handler, e.g. the handler of a third-party library
+// Use SetDefault to write logs of package functions to the handler too
+func NewSlogLogger(handler slog.Handler) Logger {
+	return &slogLogger{handler: handler, callDepth: outputCallDepth}
+}
+
+// slogLogger implements Logger with a slog.Handler
+// Contextual values are attributes stored in contexts, loggers of Fields keep the values of their context
+type slogLogger struct {
+	handler   slog.Handler
+	attrs     []slog.Attr
+	fields    bool
+	callDepth int
+}
+
+// Info logs with info level
+func (l *slogLogger) Info(ctx context.Context, v ...interface{}) {
+	l.log(ctx, slog.LevelInfo, v)
+}
+
+// Warn logs with warn level
+func (l *slogLogger) Warn(ctx context.Context, v ...interface{}) {
+	l.log(ctx, slog.LevelWarn, v)
+}
+
+// Debug logs with debug level
+func (l *slogLogger) Debug(ctx context.Context, v ...interface{}) {
+	l.log(ctx, slog.LevelDebug, v)
+}
+
+// Error logs with error level
+func (l *slogLogger) Error(ctx context.Context, v ...interface{}) {
+	l.log(ctx, slog.LevelError, v)
+}
+
+// Fields sets log fields
+func (l *slogLogger) Fields(ctx context.Context, keysAndValues ...interface{}) Logger {
+	attrs := append(getSlogAttrs(l.getAttrs(ctx)), toSlogAttrs(keysAndValues)...)
+	return &slogLogger{handler: l.handler, attrs: attrs, fields: true, callDepth: outputCallDepth}
+}
+
+// AddCallDepth adds call depth level
+func (l *slogLogger) AddCallDepth(i int) Logger {
+	l.callDepth = outputCallDepth + i
+	return l
+}
+
+// WithContextualValues stores keys and values in the context, they are added to records of downstream functions
+func (l *slogLogger) WithContextualValues(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	attrs := toSlogAttrs(keysAndValues)
+	if l.fields {
+		l.attrs = append(getSlogAttrs(l.attrs), attrs...)
+	}
+
+	ctx = UnwrapContext(ctx)
+	return context.WithValue(ctx, ctxKeySlogAttrs, append(getSlogAttrs(getContextAttrs(ctx)), attrs...))
+}
+
+func (l *slogLogger) log(ctx context.Context, level slog.Level, v []interface{}) {
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+
+	// Skip runtime.Callers, log and the log function
+	var pcs [1]uintptr
+	runtime.Callers(l.callDepth+2, pcs[:])
+
+	r := getRedactor()
+	message := ""
+	if len(v) > 0 {
+		message = fmt.Sprintln(r.redactArgs(v)...)
+		message = r.redactString(message[:len(message)-1])
+	}
+
+	// SlogHandler samples records itself, they would be counted twice
+	if _, ok := l.handler.(*SlogHandler); !ok && !sample(toZerologLevel(level), message, pcs[0]) {
+		return
+	}
+
+	record := slog.NewRecord(time.Now(), level, message, pcs[0])
+	record.AddAttrs(l.getAttrs(ctx)...)
+	if err := firstError(v); err != nil {
+		fields := getErrorFields(err)
+		record.AddAttrs(slog.String(ErrorMessageKey, fields.message))
+		if len(fields.chain) > 0 {
+			record.AddAttrs(slog.String(ErrorTypeKey, fields.chain[0].Type))
+		}
+
+		record.AddAttrs(slog.Any(ErrorChainKey, fields.chain))
+		if len(fields.stack) > 0 {
+			record.AddAttrs(slog.Any(ErrorStackKey, fields.stack))
+		}
+	}
+
+	_ = l.handler.Handle(ctx, record)
+}
+
+func (l *slogLogger) getAttrs(ctx context.Context) []slog.Attr {
+	if l.fields {
+		return l.attrs
+	}
+
+	return getContextAttrs(UnwrapContext(ctx))
+}
+
+func getContextAttrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(ctxKeySlogAttrs).([]slog.Attr)
+	return attrs
+}
+
+// getSlogAttrs copies attributes so appending to them does not change attributes of other loggers or contexts
+func getSlogAttrs(attrs []slog.Attr) []slog.Attr {
+	return append(make([]slog.Attr, 0, len(attrs)), attrs...)
+}
+
+// toSlogAttrs converts string keys and arbitrary values, extraneous ones are ignored as zerolog does
+// Sensitive values are masked
+func toSlogAttrs(keysAndValues []interface{}) []slog.Attr {
+	r := getRedactor()
+	attrs := make([]slog.Attr, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if key, ok := keysAndValues[i].(string); ok {
+			attrs = append(attrs, slog.Any(key, r.redactField(key, keysAndValues[i+1])))
+		}
+	}
+
+	return attrs
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hungdv136/gokit/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogHandler(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+
+	writer := &bytes.Buffer{}
+	Setup("test-logger", writer)
+
+	id := uuid.NewString()
+	ctx := SaveID(context.Background(), id)
+	ctx = WithContextualValues(ctx, "user_id", 7)
+	err := fmt.Errorf("unable to read, %w", fs.ErrNotExist)
+
+	l := slog.New(NewSlogHandler()).With("component", "test").WithGroup("http")
+	l.InfoContext(ctx, "handled", "method", "GET", slog.Group("response", "status", 404), "error", err)
+	l.DebugContext(ctx, "hidden")
+
+	output := types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.Equal(t, "handled", output["message"])
+	require.Equal(t, "info", output["level"])
+	require.Equal(t, id, output["request_id"])
+	require.Equal(t, 7.0, output["user_id"])
+	require.Equal(t, "test", output["component"])
+	require.Equal(t, "GET", output["http.method"])
+	require.Equal(t, 404.0, output["http.response.status"])
+	require.Equal(t, err.Error(), output["http.error"])
+	require.Equal(t, "*fmt.wrapError", output[ErrorTypeKey])
+	require.True(t, strings.HasPrefix(output["caller"].(string), "slog_test.go:"), output["caller"])
+
+	// Records follow levels of modules
+	require.NoError(t, SetLevels(Levels{Level: "info", Modules: map[string]string{"gokit/logger": "debug"}}))
+	writer.Reset()
+	l.DebugContext(ctx, "visible")
+	require.Contains(t, writer.String(), "visible")
+}
+
+func TestSlogLogger(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+
+	writer := &bytes.Buffer{}
+	handler := slog.NewJSONHandler(writer, &slog.HandlerOptions{AddSource: true})
+	SetDefault(NewSlogLogger(handler))
+
+	id := uuid.NewString()
+	ctx := SaveID(context.Background(), id)
+	ctx = WithContextualValues(ctx, "user_id", 7)
+
+	Info(ctx, "hello", "world")
+	Debug(ctx, "hidden")
+	output := types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.Equal(t, "hello world", output["msg"])
+	require.Equal(t, "INFO", output["level"])
+	require.Equal(t, id, output["request_id"])
+	require.Equal(t, 7.0, output["user_id"])
+	require.Contains(t, output["source"].(map[string]interface{})["file"], "slog_test.go")
+
+	// Loggers of fields keep values of their context
+	writer.Reset()
+	err := errors.New("failed")
+	Fields(ctx, "key", "value").Error(context.Background(), "request failed", err)
+	output = types.Map{}
+	require.NoError(t, json.Unmarshal(writer.Bytes(), &output))
+	require.Equal(t, "request failed failed", output["msg"])
+	require.Equal(t, id, output["request_id"])
+	require.Equal(t, "value", output["key"])
+	require.Equal(t, "failed", output[ErrorMessageKey])
+	require.Equal(t, "*errors.errorString", output[ErrorTypeKey])
+	require.Contains(t, output["source"].(map[string]interface{})["file"], "slog_test.go")
+}
+
+func TestSlogLogger_Sampling(t *testing.T) {
+	t.Cleanup(func() { SetupDefaultLogger("default", &bytes.Buffer{}) })
+
+	// Logs of a logger of SlogHandler are sampled once
+	ctx := context.Background()
+	writer := &syncBuffer{}
+	Setup("test-logger", writer, WithSampling(SamplingPolicy{First: 1, Tick: time.Hour}), WithSamplingReportInterval(time.Hour))
+	SetDefault(NewSlogLogger(NewSlogHandler()))
+
+	for i := 0; i < 3; i++ {
+		Info(ctx, "storm")
+	}
+
+	require.Equal(t, 1, countLogs(writer.getLogs(t), "info", "storm"))
+
+	writer.reset()
+	stopSampling()
+	logs := writer.getLogs(t)
+	require.Len(t, logs, 1)
+	require.Equal(t, "suppressed logs", logs[0]["message"])
+	require.Equal(t, 2.0, logs[0]["sampling.suppressed"])
+}
@@ -2,9 +2,14 @@ package logger
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"regexp"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/rs/zerolog"
 	rs "github.com/rs/zerolog/log"
@@ -17,8 +22,66 @@ const (
 	outputCallDepth = 1
 )
 
+// Option modifies options of Setup
+type Option func(*options)
+
+type options struct {
+	levels                 Levels
+	redactFields           []string
+	redactPatterns         []*regexp.Regexp
+	redactCardNumbers      bool
+	sampling               *SamplingPolicy
+	levelSampling          map[string]SamplingPolicy
+	unsampledErrors        bool
+	samplingReportInterval time.Duration
+}
+
+// WithLevel sets the minimum level of logs, e.g. debug. The default level is info
+func WithLevel(level string) Option {
+	return func(o *options) {
+		o.levels.Level = level
+	}
+}
+
+// WithModuleLevel overrides the level of logs of a module, e.g. storage or netkit/ginkit
+func WithModuleLevel(module string, level string) Option {
+	return func(o *options) {
+		if o.levels.Modules == nil {
+			o.levels.Modules = map[string]string{}
+		}
+
+		o.levels.Modules[module] = level
+	}
+}
+
+// WithRedactedFields masks values of fields whose names contain one of the names, in addition to DefaultRedactedFields
+// Names are case-insensitive and ignore separators, e.g. accesstoken matches access_token and Access-Token
+func WithRedactedFields(names ...string) Option {
+	return func(o *options) {
+		o.redactFields = append(o.redactFields, names...)
+	}
+}
+
+// WithRedactedPatterns masks matches of patterns in messages and string values, in addition to JWTs
+func WithRedactedPatterns(patterns ...*regexp.Regexp) Option {
+	return func(o *options) {
+		o.redactPatterns = append(o.redactPatterns, patterns...)
+	}
+}
+
+// WithRedactedCardNumbers masks matches of CardNumberPattern which pass the Luhn check in messages and string values
+// Numeric IDs of 13 to 19 digits pass the check one time out of ten, so they may be masked too
+func WithRedactedCardNumbers() Option {
+	return func(o *options) {
+		o.redactCardNumbers = true
+	}
+}
+
 // Setup setups logger
-func Setup(module string, writer io.Writer) {
+// Levels of the environment variable LOG_LEVEL override levels of options
+// Sampling of the previous setup stops and reports its suppressed logs
+func Setup(module string, writer io.Writer, opts ...Option) {
+	stopSampling()
 	rs.Logger = zerolog.New(writer).With().Str("service", module).Timestamp().Logger()
 	defaultContextLogger := zerolog.New(writer).With().Str("service", module).Timestamp().Logger()
 	zerolog.DefaultContextLogger = &defaultContextLogger
@@ -33,7 +96,60 @@ func Setup(module string, writer io.Writer) {
 		file = short
 		return file + ":" + strconv.Itoa(line)
 	}
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	setupOptions(opts)
+}
+
+// setupOptions sets levels, redaction and sampling of options
+// It falls back to the default level if levels are invalid, errors are logged after levels are set
+func setupOptions(opts []Option) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	activeRedactor.Store(newRedactor(o.redactFields, o.redactPatterns, o.redactCardNumbers))
+	levels, envErr := getEnvLevels(o.levels)
+	err := SetLevels(levels)
+	if err != nil {
+		_ = SetLevels(Levels{})
+	}
+
+	if err = errors.Join(envErr, err); err != nil {
+		NewLogger().Error(context.Background(), "invalid log levels", err)
+	}
+
+	if err := setupSampling(o); err != nil {
+		NewLogger().Error(context.Background(), "invalid log sampling", err)
+	}
+}
+
+// getEnvLevels merges levels of the environment variable into levels of options
+func getEnvLevels(levels Levels) (Levels, error) {
+	value, ok := os.LookupEnv(EnvLogLevel)
+	if !ok {
+		return levels, nil
+	}
+
+	envLevels, err := ParseLevels(value)
+	if err != nil {
+		return levels, fmt.Errorf("%s: %w", EnvLogLevel, err)
+	}
+
+	if len(envLevels.Level) > 0 {
+		levels.Level = envLevels.Level
+	}
+
+	modules := make(map[string]string, len(levels.Modules)+len(envLevels.Modules))
+	for module, level := range levels.Modules {
+		modules[module] = level
+	}
+
+	for module, level := range envLevels.Modules {
+		modules[module] = level
+	}
+
+	levels.Modules = modules
+	return levels, nil
 }
 
 // NewLogger returns new instance
@@ -49,27 +165,43 @@ type logger struct {
 
 // Info calls Output to print to the standard logger with info tag
 func (f *logger) Info(ctx context.Context, v ...interface{}) {
-	f.msg(f.getLogger(ctx).Info(), v...)
+	if !enabled(zerolog.InfoLevel, f.callDepth) {
+		return
+	}
+
+	f.msg(ctx, zerolog.InfoLevel, v...)
 }
 
 // Warn calls Output to print to the standard logger with info tag
 func (f *logger) Warn(ctx context.Context, v ...interface{}) {
-	f.msg(f.getLogger(ctx).Warn(), v...)
+	if !enabled(zerolog.WarnLevel, f.callDepth) {
+		return
+	}
+
+	f.msg(ctx, zerolog.WarnLevel, v...)
 }
 
 // Debug calls Output to print to the standard logger with info tag
 func (f *logger) Debug(ctx context.Context, v ...interface{}) {
-	f.msg(f.getLogger(ctx).Debug(), v...)
+	if !enabled(zerolog.DebugLevel, f.callDepth) {
+		return
+	}
+
+	f.msg(ctx, zerolog.DebugLevel, v...)
 }
 
 // Error calls Output to print to the standard logger with error tag
 func (f *logger) Error(ctx context.Context, v ...interface{}) {
-	f.msg(f.getLogger(ctx).Error(), v...)
+	if !enabled(zerolog.ErrorLevel, f.callDepth) {
+		return
+	}
+
+	f.msg(ctx, zerolog.ErrorLevel, v...)
 }
 
 // Fields sets log fields
 func (f *logger) Fields(ctx context.Context, keysAndValues ...interface{}) Logger {
-	l := f.getLogger(ctx).With().Fields(keysAndValues).Logger()
+	l := f.getLogger(ctx).With().Fields(getRedactor().redactKeysAndValues(keysAndValues)).Logger()
 	return &logger{rs: &l, callDepth: outputCallDepth}
 }
 
@@ -83,6 +215,7 @@ func (f *logger) AddCallDepth(i int) Logger {
 // Pass keys/values in log function if you want to write keys/values for a single log, don't use this function
 // keysAndValues must be string keys and arbitrary values, and extraneous ones are ignored
 func (f *logger) WithContextualValues(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	keysAndValues = getRedactor().redactKeysAndValues(keysAndValues)
 	if f.rs != nil {
 		l := f.rs.With().Fields(keysAndValues).Logger()
 		f.rs = &l
@@ -100,13 +233,29 @@ func (f *logger) getLogger(ctx context.Context) *zerolog.Logger {
 	return rs.Ctx(UnwrapContext(ctx))
 }
 
-func (f *logger) msg(e *zerolog.Event, v ...interface{}) {
-	if len(v) == 0 {
-		e.Caller(f.callDepth + 1).Send()
+// msg logs the redacted arguments as the message, the first error is logged as fields too
+func (f *logger) msg(ctx context.Context, level zerolog.Level, v ...interface{}) {
+	r := getRedactor()
+	message := ""
+	if len(v) > 0 {
+		// TODO: Find a proper print function to avoid printing with new line
+		s := fmt.Sprintln(r.redactArgs(v)...)
+		message = r.redactString(s[:len(s)-1])
+	}
+
+	var pc uintptr
+	if samplesByCaller(level) {
+		// Skip runtime.Callers, msg and the log function
+		var pcs [1]uintptr
+		runtime.Callers(f.callDepth+2, pcs[:])
+		pc = pcs[0]
+	}
+
+	if !sample(level, message, pc) {
 		return
 	}
 
-	// TODO: Find a proper print function to avoid printing with new line
-	s := fmt.Sprintln(v...)
-	e.Caller(f.callDepth + 1).Msg(s[:len(s)-1])
+	e := f.getLogger(ctx).WithLevel(level)
+	addErrorFields(e, firstError(v))
+	e.Caller(f.callDepth + 1).Msg(message)
 }
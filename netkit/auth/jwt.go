@@ -107,7 +107,7 @@ func (a *Jwt) Verify(ctx context.Context, tokenString string) (*UserClaims, erro
 			return &claims, err
 		}
 
-		logger.Error(ctx, err, tokenString)
+		logger.Error(ctx, "invalid token", err)
 		return &claims, err
 	}
 
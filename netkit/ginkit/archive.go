@@ -0,0 +1,47 @@
+package ginkit
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/storage"
+)
+
+// ServeArchive streams an archive of the objects as an attachment, e.g. to download all attachments of a ticket
+// Objects which cannot be fetched are skipped, add storage.WithArchiveErrorsFile to list them in the archive
+// Failures after the response is started cannot be reported, the client receives a truncated archive
+func ServeArchive(ctx *gin.Context, s storage.Storage, filename string, objectKeys []string, options ...storage.ArchiveOption) {
+	serveArchive(ctx, filename, options, func(w io.Writer) error {
+		_, err := storage.WriteArchive(ctx.Request.Context(), w, s, objectKeys, options...)
+		return err
+	})
+}
+
+// ServePrefixArchive streams an archive of the objects which have the prefix as an attachment, see ServeArchive
+func ServePrefixArchive(ctx *gin.Context, s storage.Storage, filename string, prefix string, options ...storage.ArchiveOption) {
+	serveArchive(ctx, filename, options, func(w io.Writer) error {
+		_, err := storage.WritePrefixArchive(ctx.Request.Context(), w, s, prefix, options...)
+		return err
+	})
+}
+
+func serveArchive(ctx *gin.Context, filename string, options []storage.ArchiveOption, write func(w io.Writer) error) {
+	opts := &storage.ArchiveOptions{Format: storage.ArchiveZip}
+	for _, option := range options {
+		option(opts)
+	}
+
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", opts.Format.ContentType())
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	header.Set("Cache-Control", "no-store")
+	ctx.Status(http.StatusOK)
+
+	if err := write(ctx.Writer); err != nil && !ctx.Writer.Written() {
+		header.Del("Content-Type")
+		header.Del("Content-Disposition")
+		SendError(ctx, err)
+	}
+}
@@ -0,0 +1,79 @@
+package ginkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeArchive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	for _, objectKey := range []string{"tickets/1/a.txt", "tickets/1/b.txt", "tickets/2/c.txt"} {
+		_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(objectKey)))
+		require.NoError(t, err)
+	}
+
+	engine := gin.New()
+	engine.GET("/tickets/:id/attachments", func(ctx *gin.Context) {
+		ServePrefixArchive(ctx, s, "ticket "+ctx.Param("id")+".zip", "tickets/"+ctx.Param("id")+"/")
+	})
+	engine.GET("/attachments", func(ctx *gin.Context) {
+		ServeArchive(ctx, s, "attachments.zip", ctx.QueryArray("key"), storage.WithArchiveErrorsFile("errors.txt"))
+	})
+
+	testCases := []struct {
+		Name       string
+		Path       string
+		StatusCode int
+		Filename   string
+		Entries    []string
+	}{
+		{"prefix", "/tickets/1/attachments", http.StatusOK, `attachment; filename="ticket 1.zip"`, []string{"a.txt", "b.txt"}},
+		{"keys", "/attachments?key=tickets/2/c.txt&key=missing.txt", http.StatusOK, `attachment; filename=attachments.zip`, []string{"tickets/2/c.txt", "errors.txt"}},
+		{"storage down", "/tickets/3/attachments", http.StatusInternalServerError, "", nil},
+	}
+
+	s.InjectFault(storage.Fault{Operation: storage.OpList, KeyPrefix: "tickets/3/", Err: errors.New("storage is down")})
+	for _, testCase := range testCases {
+		tc := testCase
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.Path, nil))
+			res := recorder.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tc.StatusCode, res.StatusCode)
+			require.Equal(t, tc.Filename, res.Header.Get("Content-Disposition"))
+			if tc.Entries == nil {
+				return
+			}
+
+			require.Equal(t, "application/zip", res.Header.Get("Content-Type"))
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			require.NoError(t, err)
+			names := []string{}
+			for _, file := range reader.File {
+				names = append(names, file.Name)
+			}
+
+			require.Equal(t, tc.Entries, names)
+		})
+	}
+}
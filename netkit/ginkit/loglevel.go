@@ -0,0 +1,79 @@
+package ginkit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/logger"
+	"github.com/hungdv136/gokit/netkit"
+)
+
+// logLevelsRequest changes log levels, an empty level keeps the current level and nil modules keep current overrides
+// RevertAfter is a duration, e.g. 15m, after which the previous levels are restored
+type logLevelsRequest struct {
+	Level       string            `json:"level"`
+	Modules     map[string]string `json:"modules"`
+	RevertAfter string            `json:"revert_after"`
+}
+
+type logLevelsResponse struct {
+	logger.Levels
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// LogLevelHandler reads log levels with GET and changes them with PUT, mount it on an internal and authenticated route
+//
+//	engine.Match([]string{http.MethodGet, http.MethodPut}, "/internal/log-levels", ginkit.LogLevelHandler())
+//	curl -X PUT -d '{"level":"info","modules":{"storage":"debug"},"revert_after":"15m"}' .../internal/log-levels
+func LogLevelHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodPut {
+			SendSuccess(ctx, "log levels", logLevelsResponse{Levels: logger.GetLevels()})
+			return
+		}
+
+		req := logLevelsRequest{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			logger.Warn(ctx, "invalid log levels", err)
+			SendInvalidParameters(ctx, []string{"body"})
+			return
+		}
+
+		var revertAfter time.Duration
+		if len(req.RevertAfter) > 0 {
+			d, err := time.ParseDuration(req.RevertAfter)
+			if err != nil || d <= 0 {
+				logger.Warn(ctx, "invalid revert duration", req.RevertAfter)
+				SendInvalidParameters(ctx, []string{"revert_after"})
+				return
+			}
+
+			revertAfter = d
+		}
+
+		levels := logger.GetLevels()
+		if len(req.Level) > 0 {
+			levels.Level = req.Level
+		}
+
+		if req.Modules != nil {
+			levels.Modules = req.Modules
+		}
+
+		if err := logger.SetLevelsFor(levels, revertAfter); err != nil {
+			logger.Warn(ctx, err.Error())
+			SendJSON(ctx, http.StatusBadRequest, netkit.VerdictInvalidParameters, err.Error(), struct{}{})
+			return
+		}
+
+		resp := logLevelsResponse{Levels: logger.GetLevels()}
+		if revertAfter > 0 {
+			revertAt := time.Now().Add(revertAfter)
+			resp.RevertAt = &revertAt
+		}
+
+		logger.Fields(ctx, "levels", resp.Levels.String(), "revert_after", req.RevertAfter).Info(ctx, "changed log levels")
+		SendSuccess(ctx, "log levels", resp)
+	}
+}
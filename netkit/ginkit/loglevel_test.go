@@ -0,0 +1,64 @@
+package ginkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	require.NoError(t, logger.SetLevels(logger.Levels{Level: "info"}))
+	t.Cleanup(func() { _ = logger.SetLevels(logger.Levels{}) })
+
+	engine := gin.New()
+	engine.Match([]string{http.MethodGet, http.MethodPut}, "/log-levels", LogLevelHandler())
+
+	send := func(method string, body string) (int, logLevelsResponse) {
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(method, "/log-levels", strings.NewReader(body)))
+
+		resp := struct {
+			Data logLevelsResponse `json:"data"`
+		}{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		return recorder.Code, resp.Data
+	}
+
+	code, resp := send(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "info", resp.Level)
+
+	code, resp = send(http.MethodPut, `{"modules":{"storage":"debug"}}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "info", resp.Level, "empty levels keep the current level")
+	require.Equal(t, map[string]string{"storage": "debug"}, resp.Modules)
+	require.Nil(t, resp.RevertAt)
+
+	code, resp = send(http.MethodPut, `{"level":"debug","revert_after":"50ms"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "debug", resp.Level)
+	require.Equal(t, map[string]string{"storage": "debug"}, resp.Modules, "nil modules keep current overrides")
+	require.NotNil(t, resp.RevertAt)
+	require.Eventually(t, func() bool { return logger.GetLevels().Level == "info" }, time.Second, 10*time.Millisecond)
+
+	// Stacked temporary levels revert to the last permanent levels
+	_, resp = send(http.MethodPut, `{"level":"debug","revert_after":"1h"}`)
+	require.Equal(t, "debug", resp.Level)
+	_, resp = send(http.MethodPut, `{"level":"warn","revert_after":"50ms"}`)
+	require.Equal(t, "warn", resp.Level)
+	require.Eventually(t, func() bool { return logger.GetLevels().Level == "info" }, time.Second, 10*time.Millisecond)
+
+	for _, body := range []string{`{"level":"verbose"}`, `{"revert_after":"soon"}`, `{"revert_after":"-1m"}`, `[]`} {
+		code, _ = send(http.MethodPut, body)
+		require.Equal(t, http.StatusBadRequest, code, body)
+	}
+
+	require.Equal(t, logger.Levels{Level: "info", Modules: map[string]string{"storage": "debug"}}, logger.GetLevels())
+}
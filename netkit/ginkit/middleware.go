@@ -6,7 +6,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"runtime/debug"
 	"strings"
 	"time"
 
@@ -68,7 +67,7 @@ func Recovery() gin.HandlerFunc {
 					err = fmt.Errorf("invalid recover error %v", rErr)
 				}
 
-				logger.Fields(ctx, "error.stack", debug.Stack()).Error(ctx, "panic recovered:", err)
+				logger.Error(ctx, "panic recovered:", logger.WithStack(err))
 
 				// If the connection is dead, we can't write a status to it.
 				if isBrokenPipeError(rErr) {
@@ -87,11 +86,16 @@ func Recovery() gin.HandlerFunc {
 
 // MaxBody checks maxbody payload
 func MaxBody(maxBytes int64) gin.HandlerFunc {
+	return limitBody(maxBytes, http.StatusBadRequest)
+}
+
+// limitBody rejects bodies which exceed the limit with the status code and limits reads of the others
+func limitBody(maxBytes int64, statusCode int) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		if ctx.Request.ContentLength > maxBytes {
 			msg := fmt.Sprintf("body size exceeds %d bytes", maxBytes)
-			logger.Warn(ctx, "invalid token")
-			AbortJSON(ctx, http.StatusBadRequest, netkit.VerdictInvalidParameters, msg, struct{}{})
+			logger.Warn(ctx, msg)
+			AbortJSON(ctx, statusCode, netkit.VerdictInvalidParameters, msg, struct{}{})
 			return
 		}
 
@@ -0,0 +1,49 @@
+package ginkit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/netkit"
+	"github.com/hungdv136/gokit/storage"
+	"github.com/hungdv136/gokit/util"
+)
+
+// ServeObject streams an object from storage with HTTP range support
+// Satisfiable ranges are responded with 206 Partial Content and Content-Range
+// Only the requested ranges are downloaded from the storage. Missing objects are responded with 404
+func ServeObject(ctx *gin.Context, s storage.Storage, objectKey string) {
+	reader, err := storage.NewObjectReader(ctx.Request.Context(), s, objectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		SendJSON(ctx, http.StatusNotFound, netkit.VerdictNotFound, "object not found", struct{}{})
+		return
+	}
+
+	if err != nil {
+		SendError(ctx, err)
+		return
+	}
+
+	defer util.CloseSilently(ctx, reader.Close)
+
+	info := reader.Info()
+	header := ctx.Writer.Header()
+	header.Set("Accept-Ranges", "bytes")
+	setHeaderIfNotEmpty(header, "Content-Type", info.ContentType)
+	setHeaderIfNotEmpty(header, "Content-Disposition", info.ContentDisposition)
+	setHeaderIfNotEmpty(header, "Cache-Control", info.CacheControl)
+	setHeaderIfNotEmpty(header, "Content-Encoding", info.ContentEncoding)
+	if len(info.ETag) > 0 {
+		header.Set("ETag", strconv.Quote(info.ETag))
+	}
+
+	http.ServeContent(ctx.Writer, ctx.Request, "", info.LastModified, reader)
+}
+
+func setHeaderIfNotEmpty(header http.Header, key string, value string) {
+	if len(value) > 0 {
+		header.Set(key, value)
+	}
+}
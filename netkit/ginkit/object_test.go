@@ -0,0 +1,76 @@
+package ginkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeObject(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	content := []byte("0123456789abcdefghij")
+	_, err := s.UploadFile(ctx, "videos/a.txt", bytes.NewReader(content), storage.WithCacheControl("max-age=60"))
+	require.NoError(t, err)
+
+	engine := gin.New()
+	engine.GET("/objects/*key", func(ctx *gin.Context) {
+		ServeObject(ctx, s, ctx.Param("key")[1:])
+	})
+
+	testCases := []struct {
+		Name         string
+		Path         string
+		Range        string
+		StatusCode   int
+		Body         []byte
+		ContentRange string
+	}{
+		{"full", "/objects/videos/a.txt", "", http.StatusOK, content, ""},
+		{"range", "/objects/videos/a.txt", "bytes=5-9", http.StatusPartialContent, content[5:10], "bytes 5-9/20"},
+		{"suffix", "/objects/videos/a.txt", "bytes=-4", http.StatusPartialContent, content[16:], "bytes 16-19/20"},
+		{"open_end", "/objects/videos/a.txt", "bytes=18-", http.StatusPartialContent, content[18:], "bytes 18-19/20"},
+		{"unsatisfiable", "/objects/videos/a.txt", "bytes=30-40", http.StatusRequestedRangeNotSatisfiable, nil, "bytes */20"},
+		{"missing", "/objects/videos/missing.txt", "", http.StatusNotFound, nil, ""},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+			if len(tc.Range) > 0 {
+				req.Header.Set("Range", tc.Range)
+			}
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+			res := recorder.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tc.StatusCode, res.StatusCode)
+			require.Equal(t, tc.ContentRange, res.Header.Get("Content-Range"))
+			if tc.Body == nil {
+				return
+			}
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.Body, body)
+			require.Equal(t, "bytes", res.Header.Get("Accept-Ranges"))
+			require.Equal(t, "max-age=60", res.Header.Get("Cache-Control"))
+			require.NotEmpty(t, res.Header.Get("ETag"))
+		})
+	}
+}
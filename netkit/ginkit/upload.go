@@ -0,0 +1,42 @@
+package ginkit
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/netkit"
+	"github.com/hungdv136/gokit/storage"
+)
+
+// multipartOverhead is the allowance for boundaries, headers and other fields of multipart forms
+const multipartOverhead = 64 << 10
+
+// MaxUploadBody limits request bodies to the maximum upload size of the storage plus an allowance for multipart forms
+// Bodies which exceed the limit are rejected with 413 as SendUploadError rejects files which exceed the maximum upload size
+func MaxUploadBody(s *storage.ValidatingStorage) gin.HandlerFunc {
+	if s.MaxUploadSize() <= 0 {
+		return func(ctx *gin.Context) {}
+	}
+
+	return limitBody(s.MaxUploadSize()+multipartOverhead, http.StatusRequestEntityTooLarge)
+}
+
+// SendUploadError sends uploads rejected by storage.ValidatingStorage as invalid parameters, other errors with SendError
+func SendUploadError(ctx *gin.Context, err error) {
+	var validationErr *storage.ValidationError
+	if !errors.As(err, &validationErr) {
+		SendError(ctx, err)
+		return
+	}
+
+	statusCode := http.StatusUnprocessableEntity
+	switch {
+	case errors.Is(err, storage.ErrFileTooLarge):
+		statusCode = http.StatusRequestEntityTooLarge
+	case errors.Is(err, storage.ErrContentTypeNotAllowed), errors.Is(err, storage.ErrExtensionNotAllowed):
+		statusCode = http.StatusUnsupportedMediaType
+	}
+
+	SendJSON(ctx, statusCode, netkit.VerdictInvalidParameters, validationErr.Err.Error(), struct{}{})
+}
@@ -0,0 +1,77 @@
+package ginkit
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hungdv136/gokit/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendUploadError(t *testing.T) {
+	t.Parallel()
+
+	s := storage.NewValidatingStorage(storage.NewMemoryStorage(),
+		storage.WithMaxUploadSize(1024),
+		storage.WithAllowedContentTypes("text/plain"),
+		storage.WithAllowedExtensions(".txt"),
+	)
+
+	engine := gin.New()
+	engine.POST("/files", MaxUploadBody(s), func(ctx *gin.Context) {
+		file, header, err := ctx.Request.FormFile("file")
+		if err != nil {
+			SendError(ctx, err)
+			return
+		}
+
+		defer file.Close()
+
+		if _, err := s.UploadFile(ctx, header.Filename, file); err != nil {
+			SendUploadError(ctx, err)
+			return
+		}
+
+		SendSuccess(ctx, "uploaded", struct{}{})
+	})
+
+	testCases := []struct {
+		Name       string
+		Filename   string
+		Content    string
+		StatusCode int
+	}{
+		{"allowed", "a.txt", "hello", http.StatusOK},
+		{"extension", "a.exe", "hello", http.StatusUnsupportedMediaType},
+		{"content type", "a.txt", "<html></html>", http.StatusUnsupportedMediaType},
+		{"too large", "a.txt", strings.Repeat("x", 2048), http.StatusRequestEntityTooLarge},
+		{"body too large", "a.txt", strings.Repeat("x", multipartOverhead+2048), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, err := writer.CreateFormFile("file", tc.Filename)
+			require.NoError(t, err)
+			_, err = part.Write([]byte(tc.Content))
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			req := httptest.NewRequest(http.MethodPost, "/files", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+			require.Equal(t, tc.StatusCode, recorder.Code, recorder.Body.String())
+		})
+	}
+}
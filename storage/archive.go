@@ -0,0 +1,406 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hungdv136/gokit/logger"
+	"github.com/hungdv136/gokit/util"
+)
+
+// ErrUnknownArchiveFormat is returned if the archive format is not supported
+var ErrUnknownArchiveFormat = errors.New("unknown archive format")
+
+// ArchiveFormat is the format of archives written by WriteArchive
+type ArchiveFormat string
+
+// Supported archive formats
+const (
+	ArchiveZip   ArchiveFormat = "zip"
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+)
+
+const defaultArchiveConcurrency = 4
+
+// ArchiveOptions defines options of archives
+type ArchiveOptions struct {
+	Format ArchiveFormat
+
+	// Maximum number of objects downloaded at the same time, including the one being written
+	Concurrency int
+
+	// EntryName returns the name of an object in the archive. Empty names are skipped
+	EntryName func(objectKey string) string
+
+	// Name of a text entry which lists the objects which could not be archived. Empty means no entry
+	ErrorsFile string
+}
+
+// ArchiveOption modifies archive options
+type ArchiveOption func(*ArchiveOptions)
+
+// WithArchiveFormat sets the format of the archive. Default: zip
+func WithArchiveFormat(format ArchiveFormat) ArchiveOption {
+	return func(o *ArchiveOptions) {
+		o.Format = format
+	}
+}
+
+// WithArchiveConcurrency sets the maximum number of objects downloaded at the same time. Default: 4
+func WithArchiveConcurrency(n int) ArchiveOption {
+	return func(o *ArchiveOptions) {
+		o.Concurrency = max(n, 1)
+	}
+}
+
+// WithArchiveEntryName sets the names of objects in the archive
+// Default: the key, without the prefix for archives of a prefix
+func WithArchiveEntryName(fn func(objectKey string) string) ArchiveOption {
+	return func(o *ArchiveOptions) {
+		o.EntryName = fn
+	}
+}
+
+// WithArchiveErrorsFile adds an entry which lists the objects which could not be archived, if there is any
+// It reports errors to the receiver of an archive streamed over HTTP
+func WithArchiveErrorsFile(name string) ArchiveOption {
+	return func(o *ArchiveOptions) {
+		o.ErrorsFile = name
+	}
+}
+
+// ArchiveResult reports the archived objects and the objects which could not be fetched
+// Objects which fail are skipped, e.g. ErrNotFound if an object is deleted while the archive is written
+type ArchiveResult struct {
+	Entries int
+	Size    int64
+	Errors  map[string]error
+}
+
+// WriteArchive streams an archive of the objects to the writer in the order of the keys
+// Objects are downloaded ahead with bounded concurrency and written one by one, they are not buffered
+// Tar entries are sized by Stat, objects which change between Stat and their download are spooled to temporary files
+// Objects which cannot be fetched are reported in the result. Failures of writing stop the archive
+func WriteArchive(ctx context.Context, w io.Writer, s Storage, objectKeys []string, options ...ArchiveOption) (*ArchiveResult, error) {
+	opts := newArchiveOptions("", options)
+	return writeArchive(ctx, w, s, opts, func(ctx context.Context, yield func(string, *ObjectInfo) bool) error {
+		for _, objectKey := range objectKeys {
+			if !yield(objectKey, nil) {
+				return nil
+			}
+		}
+
+		return nil
+	})
+}
+
+// WritePrefixArchive streams an archive of the objects which have the prefix, see WriteArchive
+// Entries are named by their keys without the prefix unless WithArchiveEntryName is set
+func WritePrefixArchive(ctx context.Context, w io.Writer, s Storage, prefix string, options ...ArchiveOption) (*ArchiveResult, error) {
+	opts := newArchiveOptions(prefix, options)
+	return writeArchive(ctx, w, s, opts, func(ctx context.Context, yield func(string, *ObjectInfo) bool) error {
+		it := NewObjectIterator(s, prefix)
+		for it.Next(ctx) {
+			if obj := it.Object(); !yield(obj.Key, obj) {
+				return nil
+			}
+		}
+
+		return it.Err()
+	})
+}
+
+// ContentType returns the MIME type of the format
+func (f ArchiveFormat) ContentType() string {
+	if f == ArchiveTarGz {
+		return "application/gzip"
+	}
+
+	return "application/zip"
+}
+
+func newArchiveOptions(prefix string, options []ArchiveOption) *ArchiveOptions {
+	o := &ArchiveOptions{
+		Format:      ArchiveZip,
+		Concurrency: defaultArchiveConcurrency,
+		EntryName: func(objectKey string) string {
+			return strings.TrimPrefix(objectKey, prefix)
+		},
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return o
+}
+
+// archiveSource calls yield for every object in order until yield returns false
+// The info may be nil, objects without info are stat-ed before being downloaded
+type archiveSource func(ctx context.Context, yield func(objectKey string, info *ObjectInfo) bool) error
+
+type archiveEntry struct {
+	key    string
+	name   string
+	info   *ObjectInfo
+	size   int64 // Size of the downloaded content, sizes of listed objects differ for decorators like EncryptedStorage
+	reader io.ReadCloser
+	err    error
+}
+
+// writeArchive fetches objects of the source in a pipeline: a queue of fetches in the order of the source
+// The queue holds Concurrency-1 fetches while one entry is written, so downloads overlap without reordering
+func writeArchive(ctx context.Context, w io.Writer, s Storage, opts *ArchiveOptions, source archiveSource) (*ArchiveResult, error) {
+	archive, err := newArchiveWriter(w, opts.Format)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pending := make(chan chan *archiveEntry, opts.Concurrency-1)
+	var sourceErr error
+	go func() {
+		defer close(pending)
+		sourceErr = source(ctx, func(objectKey string, info *ObjectInfo) bool {
+			name := cleanEntryName(opts.EntryName(objectKey))
+			if len(name) == 0 {
+				return true
+			}
+
+			fetched := make(chan *archiveEntry, 1)
+			select {
+			case pending <- fetched:
+			case <-ctx.Done():
+				return false
+			}
+
+			go func() {
+				fetched <- fetchArchiveEntry(ctx, s, objectKey, name, info, opts.Format == ArchiveTarGz)
+			}()
+			return true
+		})
+	}()
+
+	result := &ArchiveResult{Errors: map[string]error{}}
+	err = func() error {
+		for fetched := range pending {
+			if err := writeArchiveEntry(ctx, archive, <-fetched, result); err != nil {
+				return err
+			}
+		}
+
+		if sourceErr != nil {
+			return sourceErr
+		}
+
+		// The source stops early if the context is done
+		return ctx.Err()
+	}()
+
+	if err != nil {
+		cancel()
+		for fetched := range pending {
+			if entry := <-fetched; entry.reader != nil {
+				util.CloseSilently(ctx, entry.reader.Close)
+			}
+		}
+
+		logger.Error(ctx, fmt.Errorf("unable to write archive, %w", err))
+		return result, err
+	}
+
+	if err := writeArchiveErrors(archive, opts.ErrorsFile, result.Errors); err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to write archive errors, %w", err))
+		return result, err
+	}
+
+	if err := archive.Close(); err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to close archive, %w", err))
+		return result, err
+	}
+
+	return result, nil
+}
+
+// fetchArchiveEntry downloads an object. Archives which need exact sizes stat objects instead of using listed sizes,
+// which differ from sizes of downloads for decorators like EncryptedStorage
+func fetchArchiveEntry(ctx context.Context, s Storage, objectKey string, name string, info *ObjectInfo, exactSize bool) *archiveEntry {
+	entry := &archiveEntry{key: objectKey, name: name, info: info}
+	if entry.info == nil || exactSize {
+		if entry.info, entry.err = s.Stat(ctx, objectKey); entry.err != nil {
+			return entry
+		}
+	}
+
+	download, err := s.DownloadFile(ctx, objectKey)
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+
+	entry.reader, entry.size = download, entry.info.Size
+
+	// The object is overwritten between Stat and DownloadFile if the ETags differ, its size is only known by reading it
+	if exactSize && (len(download.ETag) == 0 || download.ETag != entry.info.ETag) {
+		entry.reader, entry.size, entry.err = spoolArchiveEntry(ctx, download)
+	}
+
+	return entry
+}
+
+// spoolArchiveEntry copies a download to a temporary file which is removed when the returned reader is closed
+func spoolArchiveEntry(ctx context.Context, download io.ReadCloser) (io.ReadCloser, int64, error) {
+	defer util.CloseSilently(ctx, download.Close)
+
+	file, err := os.CreateTemp("", "archive-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	spooled := &spooledFile{File: file}
+	size, err := io.Copy(file, download)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		util.CloseSilently(ctx, spooled.Close)
+		return nil, 0, err
+	}
+
+	return spooled, size, nil
+}
+
+// spooledFile is a temporary file which is removed when it is closed
+type spooledFile struct {
+	*os.File
+}
+
+func (f *spooledFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); removeErr != nil {
+		return errors.Join(err, removeErr)
+	}
+
+	return err
+}
+
+// writeArchiveEntry copies a fetched object into the archive or records why it could not be fetched
+func writeArchiveEntry(ctx context.Context, archive archiveWriter, entry *archiveEntry, result *ArchiveResult) error {
+	if entry.err != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		logError(ctx, fmt.Errorf("unable to archive %q, %w", entry.key, entry.err))
+		result.Errors[entry.key] = entry.err
+		return nil
+	}
+
+	defer util.CloseSilently(ctx, entry.reader.Close)
+
+	dst, err := archive.Create(entry.name, entry.size, entry.info.LastModified)
+	if err != nil {
+		return fmt.Errorf("%q, %w", entry.key, err)
+	}
+
+	n, err := io.Copy(dst, entry.reader)
+	if err != nil {
+		return fmt.Errorf("%q, %w", entry.key, err)
+	}
+
+	result.Entries++
+	result.Size += n
+	return nil
+}
+
+func writeArchiveErrors(archive archiveWriter, name string, keyErrors map[string]error) error {
+	if len(name) == 0 || len(keyErrors) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(keyErrors))
+	for objectKey := range keyErrors {
+		keys = append(keys, objectKey)
+	}
+
+	sort.Strings(keys)
+	buf := &bytes.Buffer{}
+	for _, objectKey := range keys {
+		fmt.Fprintf(buf, "%s: %v\n", objectKey, keyErrors[objectKey])
+	}
+
+	dst, err := archive.Create(name, int64(buf.Len()), time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(dst)
+	return err
+}
+
+// cleanEntryName makes the name relative and removes dot segments so the entry cannot be extracted outside of a directory
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// archiveWriter writes entries of an archive one after another
+type archiveWriter interface {
+	Create(name string, size int64, modified time.Time) (io.Writer, error)
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case ArchiveZip:
+		return &zipArchive{Writer: zip.NewWriter(w)}, nil
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarGzArchive{gz: gz, tar: tar.NewWriter(gz)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownArchiveFormat, format)
+	}
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a *zipArchive) Create(name string, _ int64, modified time.Time) (io.Writer, error) {
+	return a.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+}
+
+type tarGzArchive struct {
+	gz  *gzip.Writer
+	tar *tar.Writer
+}
+
+func (a *tarGzArchive) Create(name string, size int64, modified time.Time) (io.Writer, error) {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o644, ModTime: modified}
+	if err := a.tar.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	return a.tar, nil
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tar.Close(); err != nil {
+		return err
+	}
+
+	return a.gz.Close()
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteArchive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	files := map[string]string{
+		"attachments/1/a.txt":       "hello",
+		"attachments/1/docs/b.json": `{"b":1}`,
+		"attachments/2/c.txt":       "other",
+	}
+	for objectKey, content := range files {
+		_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(content)))
+		require.NoError(t, err)
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		t.Parallel()
+
+		buf := &bytes.Buffer{}
+		keys := []string{"attachments/1/a.txt", "attachments/1/missing.txt", "attachments/2/c.txt"}
+		result, err := WriteArchive(ctx, buf, s, keys, WithArchiveErrorsFile("errors.txt"))
+		require.NoError(t, err)
+		require.Equal(t, 2, result.Entries)
+		require.Equal(t, int64(10), result.Size)
+		require.Len(t, result.Errors, 1)
+		require.ErrorIs(t, result.Errors["attachments/1/missing.txt"], ErrNotFound)
+
+		entries := readZip(t, buf.Bytes())
+		require.Equal(t, []string{"attachments/1/a.txt", "attachments/2/c.txt", "errors.txt"}, entries.names)
+		require.Equal(t, "hello", entries.contents["attachments/1/a.txt"])
+		require.Contains(t, entries.contents["errors.txt"], "attachments/1/missing.txt: ")
+	})
+
+	t.Run("tar.gz of prefix", func(t *testing.T) {
+		t.Parallel()
+
+		buf := &bytes.Buffer{}
+		result, err := WritePrefixArchive(ctx, buf, s, "attachments/1/", WithArchiveFormat(ArchiveTarGz), WithArchiveErrorsFile("errors.txt"))
+		require.NoError(t, err)
+		require.Equal(t, 2, result.Entries)
+		require.Empty(t, result.Errors)
+		require.Equal(t, map[string]string{"a.txt": "hello", "docs/b.json": `{"b":1}`}, readTarGz(t, buf))
+	})
+
+	t.Run("tar.gz of encrypted objects", func(t *testing.T) {
+		t.Parallel()
+
+		// Listed sizes of encrypted objects are sizes of ciphertexts
+		encrypted := newTestEncryptedStorage(t, NewMemoryStorage(), 16)
+		_, err := encrypted.UploadFile(ctx, "secrets/a.txt", bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+
+		buf := &bytes.Buffer{}
+		result, err := WritePrefixArchive(ctx, buf, encrypted, "secrets/", WithArchiveFormat(ArchiveTarGz))
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Entries)
+		require.Equal(t, int64(5), result.Size)
+		require.Equal(t, map[string]string{"a.txt": "hello"}, readTarGz(t, buf))
+	})
+
+	t.Run("tar.gz of overwritten objects", func(t *testing.T) {
+		t.Parallel()
+
+		// Objects which change between Stat and their download are sized by their downloads
+		overwritten := &overwritingStorage{Storage: NewMemoryStorage(), content: "hello world"}
+		_, err := overwritten.UploadFile(ctx, "a.txt", bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+
+		buf := &bytes.Buffer{}
+		result, err := WriteArchive(ctx, buf, overwritten, []string{"a.txt"}, WithArchiveFormat(ArchiveTarGz))
+		require.NoError(t, err)
+		require.Equal(t, int64(11), result.Size)
+		require.Equal(t, map[string]string{"a.txt": "hello world"}, readTarGz(t, buf))
+	})
+
+	t.Run("entry names", func(t *testing.T) {
+		t.Parallel()
+
+		buf := &bytes.Buffer{}
+		rename := func(objectKey string) string {
+			if objectKey == "attachments/2/c.txt" {
+				return ""
+			}
+
+			return "../../" + objectKey
+		}
+
+		_, err := WriteArchive(ctx, buf, s, []string{"attachments/1/a.txt", "attachments/2/c.txt"}, WithArchiveEntryName(rename))
+		require.NoError(t, err)
+		require.Equal(t, []string{"attachments/1/a.txt"}, readZip(t, buf.Bytes()).names)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := WriteArchive(ctx, io.Discard, s, nil, WithArchiveFormat("rar"))
+		require.ErrorIs(t, err, ErrUnknownArchiveFormat)
+	})
+}
+
+func TestWriteArchive_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("files/%d.txt", i)
+		_, err := s.UploadFile(ctx, keys[i], bytes.NewReader([]byte(keys[i])))
+		require.NoError(t, err)
+	}
+
+	// Downloads overlap, sequential downloads would take 800ms
+	s.InjectFault(Fault{Operation: OpDownloadFile, Delay: 100 * time.Millisecond})
+	start := time.Now()
+	buf := &bytes.Buffer{}
+	result, err := WriteArchive(ctx, buf, s, keys, WithArchiveConcurrency(8))
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 400*time.Millisecond)
+	require.Equal(t, 8, result.Entries)
+	require.Equal(t, keys, readZip(t, buf.Bytes()).names)
+}
+
+func TestWriteArchive_Failures(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	keys := make([]string, 20)
+	for i := range keys {
+		// Random contents are not compressed, they reach the writer before the archive is closed
+		content := make([]byte, 64*1024)
+		_, err := rand.Read(content)
+		require.NoError(t, err)
+		keys[i] = fmt.Sprintf("files/%d.bin", i)
+		_, err = s.UploadFile(ctx, keys[i], bytes.NewReader(content))
+		require.NoError(t, err)
+	}
+
+	// Writes which fail stop the archive
+	errBroken := errors.New("broken pipe")
+	_, err := WriteArchive(ctx, &failingWriter{limit: 256 * 1024, err: errBroken}, s, keys, WithArchiveFormat(ArchiveTarGz))
+	require.ErrorIs(t, err, errBroken)
+
+	// Listing failures stop the archive
+	errDown := errors.New("storage is down")
+	s.InjectFault(Fault{Operation: OpList, Err: errDown})
+	_, err = WritePrefixArchive(ctx, io.Discard, s, "files/")
+	require.ErrorIs(t, err, errDown)
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = WriteArchive(cancelledCtx, io.Discard, s, keys)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func readTarGz(t *testing.T, r io.Reader) map[string]string {
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	reader := tar.NewReader(gz)
+	contents := map[string]string{}
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return contents
+		}
+
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		contents[header.Name] = string(content)
+	}
+}
+
+// overwritingStorage overwrites objects before they are downloaded
+type overwritingStorage struct {
+	Storage
+	content string
+}
+
+func (s *overwritingStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	if _, err := s.Storage.UploadFile(ctx, objectKey, bytes.NewReader([]byte(s.content))); err != nil {
+		return nil, err
+	}
+
+	return s.Storage.DownloadFile(ctx, objectKey, options...)
+}
+
+type zipEntries struct {
+	names    []string
+	contents map[string]string
+}
+
+func readZip(t *testing.T, data []byte) *zipEntries {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	entries := &zipEntries{contents: map[string]string{}}
+	for _, file := range reader.File {
+		f, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		entries.names = append(entries.names, file.Name)
+		entries.contents[file.Name] = string(content)
+	}
+
+	return entries
+}
+
+type failingWriter struct {
+	written int
+	limit   int
+	err     error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		return 0, w.err
+	}
+
+	w.written += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"crypto/md5" //nolint:gosec // MD5 is used for integrity as S3 does
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ChecksumAlgorithm is an algorithm of upload checksums
+type ChecksumAlgorithm string
+
+// Supported checksum algorithms
+const (
+	ChecksumMD5    ChecksumAlgorithm = "MD5"
+	ChecksumSHA256 ChecksumAlgorithm = "SHA256"
+	ChecksumCRC32C ChecksumAlgorithm = "CRC32C"
+)
+
+// defaultChecksumAlgorithms are computed if WithChecksums is not set
+var defaultChecksumAlgorithms = []ChecksumAlgorithm{ChecksumMD5, ChecksumSHA256}
+
+// Errors of checksum verification
+var (
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+	ErrChecksumUnavailable = errors.New("checksum is not available")
+)
+
+// Checksums are hex-encoded digests of an object. Empty values are not computed
+type Checksums struct {
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	CRC32C string `json:"crc32c,omitempty"`
+}
+
+// UploadResult describes an uploaded object
+type UploadResult struct {
+	Path      string    `json:"path"` // Location in the backend: S3 key, file path or memory key
+	ETag      string    `json:"etag"`
+	Size      int64     `json:"size"`
+	Checksums Checksums `json:"checksums"`
+}
+
+// ChecksumError is returned by Read of a verified download when the content does not match the stored checksum
+// It matches ErrChecksumMismatch with errors.Is
+type ChecksumError struct {
+	Key       string
+	Algorithm ChecksumAlgorithm
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s of %q: expected %s, actual %s", e.Algorithm, e.Key, e.Expected, e.Actual)
+}
+
+// Is makes errors.Is(err, ErrChecksumMismatch) true
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// checksummer computes checksums of the content written to it
+type checksummer struct {
+	hashes map[ChecksumAlgorithm]hash.Hash
+	size   int64
+}
+
+func newChecksummer(algorithms []ChecksumAlgorithm) *checksummer {
+	if len(algorithms) == 0 {
+		algorithms = defaultChecksumAlgorithms
+	}
+
+	c := &checksummer{hashes: make(map[ChecksumAlgorithm]hash.Hash, len(algorithms))}
+	for _, algorithm := range algorithms {
+		if h := newHash(algorithm); h != nil {
+			c.hashes[algorithm] = h
+		}
+	}
+
+	return c
+}
+
+func (c *checksummer) Write(p []byte) (int, error) {
+	for _, h := range c.hashes {
+		_, _ = h.Write(p)
+	}
+
+	c.size += int64(len(p))
+	return len(p), nil
+}
+
+func (c *checksummer) sum() Checksums {
+	checksums := Checksums{}
+	for algorithm, h := range c.hashes {
+		checksums.set(algorithm, hex.EncodeToString(h.Sum(nil)))
+	}
+
+	return checksums
+}
+
+// verify compares every expected checksum which is computed
+func (c *checksummer) verify(objectKey string, expected Checksums) error {
+	actual := c.sum()
+	for _, algorithm := range []ChecksumAlgorithm{ChecksumSHA256, ChecksumCRC32C, ChecksumMD5} {
+		if e, a := expected.get(algorithm), actual.get(algorithm); len(e) > 0 && len(a) > 0 && e != a {
+			return &ChecksumError{Key: objectKey, Algorithm: algorithm, Expected: e, Actual: a}
+		}
+	}
+
+	return nil
+}
+
+// algorithms returns algorithms of non-empty checksums
+func (c Checksums) algorithms() []ChecksumAlgorithm {
+	algorithms := []ChecksumAlgorithm{}
+	for _, algorithm := range []ChecksumAlgorithm{ChecksumMD5, ChecksumSHA256, ChecksumCRC32C} {
+		if len(c.get(algorithm)) > 0 {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+
+	return algorithms
+}
+
+func (c Checksums) get(algorithm ChecksumAlgorithm) string {
+	switch algorithm {
+	case ChecksumMD5:
+		return c.MD5
+	case ChecksumSHA256:
+		return c.SHA256
+	case ChecksumCRC32C:
+		return c.CRC32C
+	default:
+		return ""
+	}
+}
+
+func (c *Checksums) set(algorithm ChecksumAlgorithm, value string) {
+	switch algorithm {
+	case ChecksumMD5:
+		c.MD5 = value
+	case ChecksumSHA256:
+		c.SHA256 = value
+	case ChecksumCRC32C:
+		c.CRC32C = value
+	}
+}
+
+func newHash(algorithm ChecksumAlgorithm) hash.Hash {
+	switch algorithm {
+	case ChecksumMD5:
+		return md5.New() //nolint:gosec // MD5 is used for integrity as S3 does
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	default:
+		return nil
+	}
+}
+
+// verifier consumes a downloaded content and checks it at EOF
+type verifier interface {
+	io.Writer
+	verify() error
+}
+
+// newChecksumVerifier verifies the content against stored checksums
+func newChecksumVerifier(objectKey string, expected Checksums) (verifier, error) {
+	algorithms := expected.algorithms()
+	if len(algorithms) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrChecksumUnavailable, objectKey)
+	}
+
+	return &checksumVerifier{checksummer: newChecksummer(algorithms), objectKey: objectKey, expected: expected}, nil
+}
+
+type checksumVerifier struct {
+	*checksummer
+	objectKey string
+	expected  Checksums
+}
+
+func (v *checksumVerifier) verify() error {
+	return v.checksummer.verify(v.objectKey, v.expected)
+}
+
+// verifyReader feeds the verifier and returns the verification error instead of io.EOF
+type verifyReader struct {
+	io.ReadCloser
+	verifier verifier
+	err      error
+}
+
+func newVerifyReader(reader io.ReadCloser, v verifier) *verifyReader {
+	return &verifyReader{ReadCloser: reader, verifier: v}
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	_, _ = r.verifier.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		if verifyErr := r.verifier.verify(); verifyErr != nil {
+			r.err = verifyErr
+			return n, verifyErr
+		}
+	}
+
+	return n, err
+}
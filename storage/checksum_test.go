@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // MD5 is used for integrity as S3 does
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadResult_Checksums(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	result, err := s.UploadFile(ctx, "a.txt", bytes.NewReader([]byte("hello")), WithChecksums(ChecksumMD5, ChecksumSHA256, ChecksumCRC32C))
+	require.NoError(t, err)
+	require.Equal(t, "a.txt", result.Path)
+	require.Equal(t, int64(5), result.Size)
+	require.Equal(t, "5d41402abc4b2a76b9719d911017c592", result.ETag)
+	require.Equal(t, Checksums{
+		MD5:    "5d41402abc4b2a76b9719d911017c592",
+		SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		CRC32C: "9a71bb4c",
+	}, result.Checksums)
+
+	result, err = s.UploadFile(ctx, "b.txt", bytes.NewReader([]byte("hello")), WithChecksums(ChecksumCRC32C))
+	require.NoError(t, err)
+	require.Equal(t, Checksums{CRC32C: "9a71bb4c"}, result.Checksums)
+}
+
+func TestDownloadFile_VerifyChecksum(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	memory := NewMemoryStorage()
+	local, err := newLocalStorage(ctx, LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name    string
+		Storage Storage
+		Corrupt func(objectKey string)
+	}{
+		{
+			Name:    "memory",
+			Storage: memory,
+			Corrupt: func(objectKey string) {
+				memory.mu.Lock()
+				memory.objects[objectKey].data = []byte("hellO")
+				memory.mu.Unlock()
+			},
+		},
+		{
+			Name:    "local",
+			Storage: local,
+			Corrupt: func(objectKey string) {
+				path, err := local.getFilePath(objectKey)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, []byte("hellO"), 0o600))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := tc.Storage.UploadFile(ctx, "a.txt", bytes.NewReader([]byte("hello")))
+			require.NoError(t, err)
+
+			reader, err := tc.Storage.DownloadFile(ctx, "a.txt", WithChecksumVerification())
+			require.NoError(t, err)
+			data, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			require.Equal(t, "hello", string(data))
+
+			tc.Corrupt("a.txt")
+			require.Equal(t, "hellO", string(readAll(t, tc.Storage, "a.txt")))
+
+			reader, err = tc.Storage.DownloadFile(ctx, "a.txt", WithChecksumVerification())
+			require.NoError(t, err)
+			_, err = io.ReadAll(reader)
+			require.NoError(t, reader.Close())
+			require.ErrorIs(t, err, ErrChecksumMismatch)
+
+			var checksumErr *ChecksumError
+			require.ErrorAs(t, err, &checksumErr)
+			require.Equal(t, "a.txt", checksumErr.Key)
+			require.Equal(t, ChecksumSHA256, checksumErr.Algorithm)
+		})
+	}
+
+	_, err = local.UploadFile(ctx, "b.txt", bytes.NewReader([]byte("hello")), WithChecksums(ChecksumCRC32C))
+	require.NoError(t, err)
+	reader, err := local.DownloadFile(ctx, "b.txt", WithChecksumVerification())
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+}
+
+func TestMultipartETagVerifier(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789")
+	digests := []byte{}
+	for _, part := range [][]byte{content[:4], content[4:8], content[8:]} {
+		sum := md5.Sum(part) //nolint:gosec // MD5 is used for integrity as S3 does
+		digests = append(digests, sum[:]...)
+	}
+	sum := md5.Sum(digests) //nolint:gosec // MD5 is used for integrity as S3 does
+	etag := hex.EncodeToString(sum[:]) + "-3"
+
+	for _, chunkSize := range []int{1, 3, 4, 10} {
+		v, err := newMultipartETagVerifier("a", etag, 4)
+		require.NoError(t, err)
+		for i := 0; i < len(content); i += chunkSize {
+			_, err := v.Write(content[i:min(i+chunkSize, len(content))])
+			require.NoError(t, err)
+		}
+		require.NoError(t, v.verify())
+	}
+
+	v, err := newMultipartETagVerifier("a", etag, 5)
+	require.NoError(t, err)
+	_, err = v.Write(content)
+	require.NoError(t, err)
+	require.ErrorIs(t, v.verify(), ErrChecksumMismatch)
+}
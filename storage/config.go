@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeConfig sets dst, a pointer to a config struct, from src
+// Src is a value or a pointer of the same type, or a map of fields named by json tags
+func decodeConfig(src interface{}, dst interface{}) error {
+	out := reflect.ValueOf(dst).Elem()
+	in := reflect.ValueOf(src)
+	if in.Kind() == reflect.Pointer && in.Type().Elem() == out.Type() {
+		if in.IsNil() {
+			return fmt.Errorf("expected %s, got nil", out.Type())
+		}
+
+		in = in.Elem()
+	}
+
+	switch {
+	case !in.IsValid():
+		return fmt.Errorf("expected %s or a map, got nil", out.Type())
+	case in.Type() == out.Type():
+		out.Set(in)
+		return nil
+	case in.Kind() == reflect.Map && in.Type().Key().Kind() == reflect.String:
+		return decodeMap(src, dst)
+	default:
+		return fmt.Errorf("expected %s or a map, got %T", out.Type(), src)
+	}
+}
+
+// decodeMap decodes a map of fields with encoding/json, unknown fields are errors
+// Durations may be strings like 15m as in YAML configs, encoding/json only decodes nanoseconds
+func decodeMap(src interface{}, dst interface{}) error {
+	fields, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	fields, err = parseDurations(fields, reflect.TypeOf(dst).Elem(), "")
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(fields))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return toConfigError(err)
+	}
+
+	return nil
+}
+
+// parseDurations replaces duration strings of fields of the struct type with nanoseconds
+func parseDurations(data json.RawMessage, t reflect.Type, path string) (json.RawMessage, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	fields := map[string]json.RawMessage{}
+	if t.Kind() != reflect.Struct || json.Unmarshal(data, &fields) != nil {
+		// Values of other types are checked by encoding/json
+		return data, nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := getFieldName(field)
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		fieldPath := joinFieldPath(path, name)
+		var s string
+		switch {
+		case field.Type == durationType && json.Unmarshal(value, &s) == nil:
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, &ConfigError{Field: fieldPath, Err: fmt.Errorf("expected a duration like 15m, got %q", s)}
+			}
+
+			fields[name] = json.RawMessage(strconv.FormatInt(int64(d), 10))
+		default:
+			parsed, err := parseDurations(value, field.Type, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+
+			fields[name] = parsed
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// toConfigError adds the path of the invalid field to errors of encoding/json
+func toConfigError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &ConfigError{Field: typeErr.Field, Err: fmt.Errorf("expected %s, got %s", describeType(typeErr.Type), typeErr.Value)}
+	}
+
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if field, unquoteErr := strconv.Unquote(name); unquoteErr == nil {
+			return &ConfigError{Field: field, Err: errors.New("unknown field")}
+		}
+	}
+
+	return err
+}
+
+func describeType(t reflect.Type) string {
+	if t == durationType {
+		return "a duration"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
+
+// getFieldName returns the json name of a field as encoding/json does
+func getFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if len(name) == 0 {
+		return field.Name
+	}
+
+	return name
+}
+
+func joinFieldPath(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+
+	return path + "." + name
+}
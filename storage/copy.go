@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/hungdv136/gokit/util"
+)
+
+// CopyBetween copies an object from a storage to another storage. Use Storage.Copy for the same storage
+// Server-side copy is used if both are S3 storages, they may have different buckets or directories
+// Otherwise the content is streamed through this process, content attributes and metadata are preserved
+func CopyBetween(ctx context.Context, src Storage, srcKey string, dst Storage, dstKey string) error {
+	srcS3, srcOK := src.(*S3Storage)
+	dstS3, dstOK := dst.(*S3Storage)
+	if srcOK && dstOK {
+		return srcS3.CopyTo(ctx, srcKey, dstS3, dstKey)
+	}
+
+	info, err := src.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	reader, err := src.DownloadFile(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	defer util.CloseSilently(ctx, reader.Close)
+
+	_, err = dst.UploadFile(ctx, dstKey, reader, withObjectInfo(info))
+	return err
+}
+
+// MoveBetween moves an object from a storage to another storage. Use Storage.Move for the same storage
+func MoveBetween(ctx context.Context, src Storage, srcKey string, dst Storage, dstKey string) error {
+	if err := CopyBetween(ctx, src, srcKey, dst, dstKey); err != nil {
+		return err
+	}
+
+	return src.DeleteFile(ctx, srcKey)
+}
+
+// withObjectInfo sets upload options from the attributes of an existing object
+func withObjectInfo(info *ObjectInfo) UploadOption {
+	return func(o *UploadOptions) {
+		o.ContentType = info.ContentType
+		o.ContentDisposition = info.ContentDisposition
+		o.CacheControl = info.CacheControl
+		o.ContentEncoding = info.ContentEncoding
+		WithMetadata(info.Metadata)(o)
+		WithTags(info.Tags)(o)
+	}
+}
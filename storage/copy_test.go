@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyBetween(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src := NewMemoryStorage()
+	dst, err := newLocalStorage(ctx, LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	_, err = src.UploadFile(ctx, "a.json", bytes.NewReader([]byte(`{"a":1}`)),
+		WithCacheControl("max-age=60"),
+		WithMetadata(map[string]string{"owner": "u1"}),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, CopyBetween(ctx, src, "a.json", dst, "copied/a.json"))
+	info, err := dst.Stat(ctx, "copied/a.json")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), info.Size)
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, "max-age=60", info.CacheControl)
+	require.Equal(t, map[string]string{"owner": "u1"}, info.Metadata)
+
+	require.NoError(t, MoveBetween(ctx, dst, "copied/a.json", src, "moved/a.json"))
+	require.Equal(t, `{"a":1}`, string(readAll(t, src, "moved/a.json")))
+	existed, err := dst.Exist(ctx, "copied/a.json")
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	require.Error(t, CopyBetween(ctx, src, uuid.NewString(), dst, "missing"))
+}
+
+func testCopyMove(t *testing.T, s Storage, prefix string) {
+	ctx := context.Background()
+	_, err := s.UploadFile(ctx, prefix+"a.json", bytes.NewReader([]byte(`{"a":1}`)), WithMetadata(map[string]string{"owner": "u1"}))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Copy(ctx, prefix+"a.json", prefix+"b/b.json"))
+	require.Equal(t, `{"a":1}`, string(readAll(t, s, prefix+"a.json")))
+	require.Equal(t, `{"a":1}`, string(readAll(t, s, prefix+"b/b.json")))
+	info, err := s.Stat(ctx, prefix+"b/b.json")
+	require.NoError(t, err)
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, map[string]string{"owner": "u1"}, info.Metadata)
+
+	require.NoError(t, s.Move(ctx, prefix+"b/b.json", prefix+"c/c.json"))
+	require.Equal(t, `{"a":1}`, string(readAll(t, s, prefix+"c/c.json")))
+	existed, err := s.Exist(ctx, prefix+"b/b.json")
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	require.Error(t, s.Copy(ctx, prefix+uuid.NewString(), prefix+"d.json"))
+
+	keyErrors, err := s.DeleteMany(ctx, []string{prefix + "a.json", prefix + "c/c.json", prefix + "missing.json"})
+	require.NoError(t, err)
+	require.Empty(t, keyErrors)
+
+	objects, err := ListAll(ctx, s, prefix)
+	require.NoError(t, err)
+	require.Empty(t, objects)
+}
+
+func readAll(t *testing.T, s Storage, objectKey string) []byte {
+	reader, err := s.DownloadFile(context.Background(), objectKey)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	return data
+}
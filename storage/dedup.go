@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hungdv136/gokit/logger"
+	"github.com/hungdv136/gokit/util"
+)
+
+// ErrDedupUploadURL is returned by DedupStorage.GetUploadURL
+var ErrDedupUploadURL = errors.New("presigned uploads bypass deduplication")
+
+// Key layout of deduplicated storage
+const (
+	dedupRefPrefix  = "refs/"
+	dedupBlobPrefix = "blobs/"
+)
+
+// DedupOption modifies a deduplicating storage
+type DedupOption func(*DedupStorage)
+
+// WithSpoolDir sets the directory of temporary files used to hash uploads. Default: os.TempDir()
+func WithSpoolDir(dir string) DedupOption {
+	return func(s *DedupStorage) {
+		s.spoolDir = dir
+	}
+}
+
+// DedupStorage stores each distinct content once in the underlying storage
+//
+//	refs/<key>                        reference of a logical key: SHA-256 of the content, size and upload options
+//	blobs/<sha256>/data               content
+//	blobs/<sha256>/refs/<sha256(key)> marker of each logical key which points to the content
+//
+// Uploads are spooled to a temporary file while they are hashed, content which already exists is not uploaded again
+// A blob is deleted when its last marker is deleted. Deleting and uploading the same content concurrently
+// from different processes may race, so run deletes of shared content from a single worker if that matters
+// URLs returned by GetURL serve the blob with the attributes of its first upload
+// ETags are SHA-256 of the content. Conditional uploads are as atomic as conditional writes of the underlying storage
+type DedupStorage struct {
+	storage  Storage
+	spoolDir string
+}
+
+// dedupReference is the content of the reference object of a logical key
+type dedupReference struct {
+	Hash    string         `json:"hash"`
+	Size    int64          `json:"size"`
+	Options *UploadOptions `json:"options"`
+	ETag    string         `json:"-"` // ETag of the reference object in the underlying storage
+}
+
+// NewDedupStorage wraps a storage with content-addressed deduplication
+func NewDedupStorage(s Storage, options ...DedupOption) *DedupStorage {
+	d := &DedupStorage{storage: s}
+	for _, option := range options {
+		option(d)
+	}
+
+	return d
+}
+
+// UploadFile hashes the content, uploads it if no other key has the same content, then points the key to it
+// The result has the checksums of the content, ETag is the SHA-256 of the content
+func (s *DedupStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	opts := newUploadOptions(options)
+	progress := newReaderProgress(opts.Progress, reader)
+	reader, err := opts.detectContentType(objectKey, reader)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	spool, err := os.CreateTemp(s.spoolDir, "dedup-*")
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	defer func() {
+		util.CloseSilently(ctx, spool.Close)
+		_ = os.Remove(spool.Name())
+	}()
+
+	algorithms := opts.Checksums
+	if len(algorithms) > 0 {
+		algorithms = append(algorithms[:len(algorithms):len(algorithms)], ChecksumSHA256)
+	}
+
+	checksums := newChecksummer(algorithms)
+	if _, err := io.Copy(io.MultiWriter(spool, checksums), progress.wrap(reader)); err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	sum := checksums.sum()
+	ref := &dedupReference{Hash: sum.SHA256, Size: checksums.size, Options: opts}
+	path, err := s.link(ctx, objectKey, ref, func() error {
+		existed, err := s.storage.Exist(ctx, getBlobKey(ref.Hash))
+		if err != nil || existed {
+			return err
+		}
+
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			logger.Error(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+			return err
+		}
+
+		_, err = s.storage.UploadFile(ctx, getBlobKey(ref.Hash), spool, WithContentType(opts.ContentType), WithChecksums(opts.Checksums...))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadResult{Path: path, ETag: ref.Hash, Size: ref.Size, Checksums: sum}, nil
+}
+
+// DownloadFile returns the content which the key points to. ETag is the SHA-256 of the content
+func (s *DedupStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	ref, err := s.readReference(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.storage.DownloadFile(ctx, getBlobKey(ref.Hash), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DownloadResult{ReadCloser: result.ReadCloser, ETag: ref.Hash}, nil
+}
+
+// DownloadRange returns length bytes from offset of the content which the key points to
+func (s *DedupStorage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error) {
+	ref, err := s.readReference(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storage.DownloadRange(ctx, getBlobKey(ref.Hash), offset, length)
+}
+
+// DeleteFile deletes the reference of the key and the content if no other key points to it
+func (s *DedupStorage) DeleteFile(ctx context.Context, objectKey string) error {
+	existed, err := s.storage.Exist(ctx, getRefKey(objectKey))
+	if err != nil || !existed {
+		return err
+	}
+
+	ref, err := s.readReference(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.DeleteFile(ctx, getRefKey(objectKey)); err != nil {
+		return err
+	}
+
+	return s.release(ctx, ref.Hash, objectKey)
+}
+
+// DeleteMany deletes keys one by one. Errors of keys which cannot be deleted are returned in the map
+func (s *DedupStorage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	keyErrors := map[string]error{}
+	for _, objectKey := range objectKeys {
+		if err := s.DeleteFile(ctx, objectKey); err != nil {
+			keyErrors[objectKey] = err
+		}
+	}
+
+	return keyErrors, nil
+}
+
+// Copy points another key to the same content, no content is copied
+func (s *DedupStorage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	ref, err := s.readReference(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.link(ctx, dstKey, ref, func() error { return nil })
+	return err
+}
+
+// Move points another key to the same content then deletes the source key
+func (s *DedupStorage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	if srcKey == dstKey {
+		return nil
+	}
+
+	if err := s.Copy(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	return s.DeleteFile(ctx, srcKey)
+}
+
+// GetURL returns the URL of the content which the key points to
+func (s *DedupStorage) GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error) {
+	ref, err := s.readReference(ctx, objectKey)
+	if err != nil {
+		return "", err
+	}
+
+	return s.storage.GetURL(ctx, getBlobKey(ref.Hash), options...)
+}
+
+// GetUploadURL is not supported because uploaded content would not be deduplicated
+func (s *DedupStorage) GetUploadURL(ctx context.Context, objectKey string, _ ...PresignOption) (*PresignedRequest, error) {
+	logger.Error(ctx, fmt.Errorf("unable to presign upload of %q, %w", objectKey, ErrDedupUploadURL))
+	return nil, ErrDedupUploadURL
+}
+
+// Exist checks if the key has a reference
+func (s *DedupStorage) Exist(ctx context.Context, objectKey string) (bool, error) {
+	return s.storage.Exist(ctx, getRefKey(objectKey))
+}
+
+// List returns a page of logical keys. References are read to fill the size and ETag of each object
+func (s *DedupStorage) List(ctx context.Context, prefix string, cursor string) (*ListResult, error) {
+	page, err := s.storage.List(ctx, getRefKey(prefix), cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range page.Objects {
+		obj.Key = strings.TrimPrefix(obj.Key, dedupRefPrefix)
+		ref, err := s.readReference(ctx, obj.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		obj.Size = ref.Size
+		obj.ETag = ref.Hash
+	}
+
+	return page, nil
+}
+
+// Stat returns attributes of the key. ETag is the SHA-256 of the content
+func (s *DedupStorage) Stat(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	refInfo, err := s.storage.Stat(ctx, getRefKey(objectKey))
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := s.readReference(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ObjectInfo{Key: objectKey, Size: ref.Size, ETag: ref.Hash, LastModified: refInfo.LastModified}
+	ref.Options.applyTo(info)
+	return info, nil
+}
+
+// link points the key to the content. ensureBlob is called after the marker is written so the blob is not released meanwhile
+// The content which the key pointed to is released
+// Conditions of ref.Options are checked against the current hash, then the reference is written only if it has not changed since
+func (s *DedupStorage) link(ctx context.Context, objectKey string, ref *dedupReference, ensureBlob func() error) (string, error) {
+	existed, err := s.storage.Exist(ctx, getRefKey(objectKey))
+	if err != nil {
+		return "", err
+	}
+
+	var old *dedupReference
+	if existed {
+		if old, err = s.readReference(ctx, objectKey); err != nil {
+			return "", err
+		}
+	}
+
+	refOptions := []UploadOption{WithContentType("application/json")}
+	if ref.Options.hasConditions() {
+		oldHash := ""
+		if old != nil {
+			oldHash = old.Hash
+			refOptions = append(refOptions, WithIfMatch(old.ETag))
+		} else {
+			refOptions = append(refOptions, WithIfNoneMatch("*"))
+		}
+
+		if err := ref.Options.checkConditions(objectKey, old != nil, oldHash); err != nil {
+			logError(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+			return "", err
+		}
+	}
+
+	if _, err := s.storage.UploadFile(ctx, getMarkerKey(ref.Hash, objectKey), strings.NewReader(objectKey), WithContentType("text/plain")); err != nil {
+		return "", err
+	}
+
+	if err := ensureBlob(); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(ref)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return "", err
+	}
+
+	result, err := s.storage.UploadFile(ctx, getRefKey(objectKey), bytes.NewReader(data), refOptions...)
+	if err != nil {
+		if old == nil || old.Hash != ref.Hash {
+			s.unlink(ctx, objectKey, ref.Hash)
+		}
+
+		return "", err
+	}
+
+	if old != nil && old.Hash != ref.Hash {
+		if err := s.release(ctx, old.Hash, objectKey); err != nil {
+			return "", err
+		}
+	}
+
+	return result.Path, nil
+}
+
+// release deletes the marker of the key and deletes the blob if it has no other marker
+func (s *DedupStorage) release(ctx context.Context, hash string, objectKey string) error {
+	if err := s.storage.DeleteFile(ctx, getMarkerKey(hash, objectKey)); err != nil {
+		return err
+	}
+
+	markers, err := s.storage.List(ctx, dedupBlobPrefix+hash+"/refs/", "")
+	if err != nil || len(markers.Objects) > 0 {
+		return err
+	}
+
+	return s.storage.DeleteFile(ctx, getBlobKey(hash))
+}
+
+// unlink releases the content after the reference could not be written, unless a concurrent upload pointed the key to it
+func (s *DedupStorage) unlink(ctx context.Context, objectKey string, hash string) {
+	current, err := s.readReference(ctx, objectKey)
+	if err == nil && current.Hash == hash {
+		return
+	}
+
+	_ = s.release(ctx, hash, objectKey)
+}
+
+func (s *DedupStorage) readReference(ctx context.Context, objectKey string) (*dedupReference, error) {
+	reader, err := s.storage.DownloadFile(ctx, getRefKey(objectKey))
+	if err != nil {
+		return nil, err
+	}
+
+	defer util.CloseSilently(ctx, reader.Close)
+
+	ref := &dedupReference{Options: &UploadOptions{}, ETag: reader.ETag}
+	if err := json.NewDecoder(reader).Decode(ref); err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to read reference of %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	return ref, nil
+}
+
+func getRefKey(objectKey string) string {
+	return dedupRefPrefix + objectKey
+}
+
+func getBlobKey(hash string) string {
+	return dedupBlobPrefix + hash + "/data"
+}
+
+func getMarkerKey(hash string, objectKey string) string {
+	sum := sha256.Sum256([]byte(objectKey))
+	return dedupBlobPrefix + hash + "/refs/" + hex.EncodeToString(sum[:])
+}
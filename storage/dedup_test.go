@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	inner := NewMemoryStorage()
+	s := NewDedupStorage(inner, WithSpoolDir(t.TempDir()))
+	content := []byte(`{"a":1}`)
+
+	for _, key := range []string{"u1/a.json", "u2/a.json"} {
+		_, err := s.UploadFile(ctx, key, bytes.NewReader(content), WithMetadata(map[string]string{"owner": key[:2]}))
+		require.NoError(t, err)
+		require.Equal(t, string(content), string(readAll(t, s, key)))
+	}
+
+	blobs, err := ListAll(ctx, inner, dedupBlobPrefix)
+	require.NoError(t, err)
+	require.Len(t, blobs, 3)
+	require.Len(t, inner.Calls(OpUploadFile), 5)
+
+	info, err := s.Stat(ctx, "u2/a.json")
+	require.NoError(t, err)
+	require.Equal(t, "u2/a.json", info.Key)
+	require.Equal(t, int64(len(content)), info.Size)
+	require.Equal(t, "015abd7f5cc57a2dd94b7590f04ad8084273905ee33ec5cebeae62276a97f862", info.ETag)
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, map[string]string{"owner": "u2"}, info.Metadata)
+
+	objects, err := ListAll(ctx, s, "u")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	require.Equal(t, "u1/a.json", objects[0].Key)
+	require.Equal(t, info.ETag, objects[0].ETag)
+	require.Equal(t, info.Size, objects[0].Size)
+
+	require.NoError(t, s.DeleteFile(ctx, "u1/a.json"))
+	require.Equal(t, string(content), string(readAll(t, s, "u2/a.json")))
+
+	_, err = s.UploadFile(ctx, "u2/a.json", bytes.NewReader([]byte(`{"a":2}`)))
+	require.NoError(t, err)
+	existed, err := inner.Exist(ctx, getBlobKey(info.ETag))
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	require.NoError(t, s.DeleteFile(ctx, "u2/a.json"))
+	require.NoError(t, s.DeleteFile(ctx, "u2/a.json"))
+	remaining, err := ListAll(ctx, inner, "")
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+
+	_, err = s.GetUploadURL(ctx, "u1/a.json")
+	require.ErrorIs(t, err, ErrDedupUploadURL)
+}
+
+func TestDedupStorage_CopyMove(t *testing.T) {
+	t.Parallel()
+
+	inner := NewMemoryStorage()
+	testCopyMove(t, NewDedupStorage(inner, WithSpoolDir(t.TempDir())), "copy/")
+
+	remaining, err := ListAll(context.Background(), inner, "")
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
+func TestDedupStorage_DownloadRange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewDedupStorage(NewMemoryStorage(), WithSpoolDir(t.TempDir()))
+	_, err := s.UploadFile(ctx, "ranges/a", bytes.NewReader([]byte("0123456789")))
+	require.NoError(t, err)
+
+	testDownloadRange(t, s, "ranges/a")
+}
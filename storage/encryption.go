@@ -0,0 +1,513 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/hungdv136/gokit/logger"
+	"github.com/hungdv136/gokit/util"
+)
+
+// Errors of EncryptedStorage
+var (
+	ErrDecryptionFailed   = errors.New("unable to decrypt object")
+	ErrEncryptedUploadURL = errors.New("presigned uploads bypass client-side encryption")
+	ErrInvalidChunkSize   = errors.New("invalid encryption chunk size")
+)
+
+// Layout of encrypted objects:
+//
+//	magic (4) | chunk size (4) | header size (4) | nonce prefix (7) | key ID size (2) | key ID | wrapped key size (2) | wrapped key
+//	chunk 0 | chunk 1 | ... | final chunk
+//
+// Each chunk is sealed with AES-256-GCM using the nonce "nonce prefix | chunk index (4) | final flag (1)"
+// and the header as additional data, so reordered, truncated or extended objects fail to decrypt
+const (
+	encryptionMagic         = "GKE\x01"
+	encryptionPrefixSize    = 12
+	encryptionNoncePrefix   = 7
+	maxEncryptionHeaderSize = 4096
+	dataKeySize             = 32
+	gcmTagSize              = 16
+
+	defaultEncryptionChunkSize = 64 << 10
+	maxEncryptionChunkSize     = 16 << 20
+)
+
+// EncryptionOption modifies an encrypted storage
+type EncryptionOption func(*EncryptedStorage)
+
+// WithChunkSize sets the plaintext size of encrypted chunks. Default: 64KiB
+// Memory usage of uploads and downloads is about two chunks
+func WithChunkSize(n int) EncryptionOption {
+	return func(s *EncryptedStorage) {
+		s.chunkSize = n
+	}
+}
+
+// EncryptedStorage encrypts objects on the client side with envelope encryption
+// Each object is encrypted by a random data key which is wrapped by the key provider and stored in the object header
+// Stat and DownloadRange report and address plaintext bytes. Sizes returned by List are sizes of stored objects
+// URLs returned by GetURL serve encrypted content
+type EncryptedStorage struct {
+	Storage
+	keys      KeyProvider
+	chunkSize int
+}
+
+// NewEncryptedStorage wraps a storage with client-side encryption
+func NewEncryptedStorage(s Storage, keys KeyProvider, options ...EncryptionOption) (*EncryptedStorage, error) {
+	e := &EncryptedStorage{Storage: s, keys: keys, chunkSize: defaultEncryptionChunkSize}
+	for _, option := range options {
+		option(e)
+	}
+
+	if e.chunkSize <= 0 || e.chunkSize > maxEncryptionChunkSize {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidChunkSize, e.chunkSize)
+	}
+
+	return e, nil
+}
+
+// UploadFile encrypts the content while it is streamed to the underlying storage
+// Content type is detected from the plaintext and progress reports plaintext bytes. The result describes the stored ciphertext
+func (s *EncryptedStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	opts := newUploadOptions(options)
+	progress := newReaderProgress(opts.Progress, reader)
+	reader, err := opts.detectContentType(objectKey, reader)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to encrypt %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	noncePrefix := make([]byte, encryptionNoncePrefix)
+	for _, b := range [][]byte{dataKey, noncePrefix} {
+		if _, err := rand.Read(b); err != nil {
+			logger.Error(ctx, fmt.Errorf("unable to encrypt %q, %w", objectKey, err))
+			return nil, err
+		}
+	}
+
+	wrappedKey, err := s.keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to wrap data key of %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	header, err := newEncryptionHeader(s.chunkSize, noncePrefix, wrappedKey)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to encrypt %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to encrypt %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	uploadOptions := make([]UploadOption, 0, len(options)+1)
+	uploadOptions = append(uploadOptions, options...)
+	uploadOptions = append(uploadOptions, WithContentType(opts.ContentType), WithProgress(nil))
+	return s.Storage.UploadFile(ctx, objectKey, newEncryptReader(progress.wrap(reader), aead, header), uploadOptions...)
+}
+
+// DownloadFile returns a reader which decrypts the object while it is read
+// Read returns ErrDecryptionFailed if the object has been modified. Checksums are verified against the ciphertext
+// ETag is the ETag of the ciphertext which the underlying storage returns
+func (s *EncryptedStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	body, err := s.Storage.DownloadFile(ctx, objectKey, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	src := bufio.NewReaderSize(body, maxEncryptionHeaderSize)
+	header, err := readEncryptionHeader(src)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to decrypt %q, %w", objectKey, err))
+		_ = body.Close()
+		return nil, err
+	}
+
+	aead, err := s.unwrapKey(ctx, objectKey, header)
+	if err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+
+	return &DownloadResult{ReadCloser: readCloser{Reader: newDecryptReader(src, aead, header, 0, -1), Closer: body}, ETag: body.ETag}, nil
+}
+
+// DownloadRange decrypts only the chunks which cover the range. Offset and length are positions of plaintext
+func (s *EncryptedStorage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error) {
+	info, header, err := s.stat(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRange(info.Size, offset, length); err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to download %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	if length < 0 || offset+length > info.Size {
+		length = info.Size - offset
+	}
+
+	aead, err := s.unwrapKey(ctx, objectKey, header)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := int64(header.chunkSize)
+	sealedSize := chunkSize + gcmTagSize
+	firstChunk, endChunk := offset/chunkSize, (offset+length-1)/chunkSize
+	body, err := s.Storage.DownloadRange(ctx, objectKey, int64(len(header.raw))+firstChunk*sealedSize, (endChunk-firstChunk+1)*sealedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newDecryptReader(bufio.NewReader(body), aead, header, firstChunk, endChunk)
+	reader.lastChunk = countChunks(info.Size, chunkSize) - 1
+	if _, err := io.CopyN(io.Discard, reader, offset-firstChunk*chunkSize); err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to decrypt %q, %w", objectKey, err))
+		_ = body.Close()
+		return nil, err
+	}
+
+	return readCloser{Reader: io.LimitReader(reader, length), Closer: body}, nil
+}
+
+// Stat returns attributes of the object with the plaintext size
+func (s *EncryptedStorage) Stat(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	info, _, err := s.stat(ctx, objectKey)
+	return info, err
+}
+
+// GetUploadURL is not supported because uploaded content would not be encrypted
+func (s *EncryptedStorage) GetUploadURL(ctx context.Context, objectKey string, _ ...PresignOption) (*PresignedRequest, error) {
+	logger.Error(ctx, fmt.Errorf("unable to presign upload of %q, %w", objectKey, ErrEncryptedUploadURL))
+	return nil, ErrEncryptedUploadURL
+}
+
+func (s *EncryptedStorage) stat(ctx context.Context, objectKey string) (*ObjectInfo, *encryptionHeader, error) {
+	info, err := s.Storage.Stat(ctx, objectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := s.Storage.DownloadRange(ctx, objectKey, 0, maxEncryptionHeaderSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer util.CloseSilently(ctx, body.Close)
+
+	header, err := readEncryptionHeader(bufio.NewReaderSize(body, maxEncryptionHeaderSize))
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to decrypt %q, %w", objectKey, err))
+		return nil, nil, err
+	}
+
+	size, err := header.plaintextSize(info.Size)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to decrypt %q, %w", objectKey, err))
+		return nil, nil, err
+	}
+
+	info.Size = size
+	return info, header, nil
+}
+
+func (s *EncryptedStorage) unwrapKey(ctx context.Context, objectKey string, header *encryptionHeader) (cipher.AEAD, error) {
+	dataKey, err := s.keys.UnwrapKey(ctx, header.key)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to unwrap data key of %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+		logger.Error(ctx, fmt.Errorf("unable to decrypt %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	return aead, nil
+}
+
+// encryptionHeader is the header of an encrypted object. raw is used as additional data of every chunk
+type encryptionHeader struct {
+	chunkSize   int
+	noncePrefix []byte
+	key         *WrappedKey
+	raw         []byte
+}
+
+func newEncryptionHeader(chunkSize int, noncePrefix []byte, key *WrappedKey) (*encryptionHeader, error) {
+	size := encryptionPrefixSize + encryptionNoncePrefix + 2 + len(key.KeyID) + 2 + len(key.Ciphertext)
+	if size > maxEncryptionHeaderSize {
+		return nil, fmt.Errorf("wrapped key is too large, header size %d", size)
+	}
+
+	raw := make([]byte, 0, size)
+	raw = append(raw, encryptionMagic...)
+	raw = binary.BigEndian.AppendUint32(raw, uint32(chunkSize)) //nolint:gosec // chunk size is validated
+	raw = binary.BigEndian.AppendUint32(raw, uint32(size))      //nolint:gosec // header size is validated
+	raw = append(raw, noncePrefix...)
+	raw = binary.BigEndian.AppendUint16(raw, uint16(len(key.KeyID))) //nolint:gosec // header size is validated
+	raw = append(raw, key.KeyID...)
+	raw = binary.BigEndian.AppendUint16(raw, uint16(len(key.Ciphertext))) //nolint:gosec // header size is validated
+	raw = append(raw, key.Ciphertext...)
+
+	return &encryptionHeader{chunkSize: chunkSize, noncePrefix: noncePrefix, key: key, raw: raw}, nil
+}
+
+// readEncryptionHeader reads the header from the beginning of an encrypted object
+// The buffer size of the reader must be at least maxEncryptionHeaderSize
+func readEncryptionHeader(r *bufio.Reader) (*encryptionHeader, error) {
+	prefix, err := r.Peek(encryptionPrefixSize)
+	if err != nil || !bytes.Equal(prefix[:len(encryptionMagic)], []byte(encryptionMagic)) {
+		return nil, fmt.Errorf("%w: object is not encrypted", ErrDecryptionFailed)
+	}
+
+	chunkSize := int(binary.BigEndian.Uint32(prefix[4:8]))
+	size := int(binary.BigEndian.Uint32(prefix[8:12]))
+	if chunkSize <= 0 || chunkSize > maxEncryptionChunkSize || size < encryptionPrefixSize+encryptionNoncePrefix+4 || size > maxEncryptionHeaderSize {
+		return nil, fmt.Errorf("%w: invalid header", ErrDecryptionFailed)
+	}
+
+	raw, err := r.Peek(size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid header, %w", ErrDecryptionFailed, err)
+	}
+
+	raw = bytes.Clone(raw)
+	if _, err := r.Discard(size); err != nil {
+		return nil, err
+	}
+
+	rest := raw[encryptionPrefixSize:]
+	noncePrefix, rest := rest[:encryptionNoncePrefix], rest[encryptionNoncePrefix:]
+	keyID, rest, ok := readSizedField(rest)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid header", ErrDecryptionFailed)
+	}
+
+	ciphertext, rest, ok := readSizedField(rest)
+	if !ok || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid header", ErrDecryptionFailed)
+	}
+
+	return &encryptionHeader{
+		chunkSize:   chunkSize,
+		noncePrefix: noncePrefix,
+		key:         &WrappedKey{KeyID: string(keyID), Ciphertext: ciphertext},
+		raw:         raw,
+	}, nil
+}
+
+// plaintextSize computes the plaintext size from the size of the stored object
+func (h *encryptionHeader) plaintextSize(storedSize int64) (int64, error) {
+	sealedSize := int64(h.chunkSize) + gcmTagSize
+	size := storedSize - int64(len(h.raw))
+	chunks, rest := size/sealedSize, size%sealedSize
+	switch {
+	case size < gcmTagSize:
+		return 0, fmt.Errorf("%w: object is truncated", ErrDecryptionFailed)
+	case rest == 0:
+		return chunks * int64(h.chunkSize), nil
+	case rest < gcmTagSize:
+		return 0, fmt.Errorf("%w: object is truncated", ErrDecryptionFailed)
+	default:
+		return chunks*int64(h.chunkSize) + rest - gcmTagSize, nil
+	}
+}
+
+func (h *encryptionHeader) nonce(counter int64, final bool) []byte {
+	nonce := make([]byte, 0, encryptionNoncePrefix+5)
+	nonce = append(nonce, h.noncePrefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, uint32(counter)) //nolint:gosec // counter is checked by readers
+	if final {
+		return append(nonce, 1)
+	}
+
+	return append(nonce, 0)
+}
+
+func readSizedField(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 2 {
+		return nil, nil, false
+	}
+
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, false
+	}
+
+	return b[2 : 2+n], b[2+n:], true
+}
+
+// countChunks returns the number of chunks of a plaintext. Empty plaintext has a single empty chunk
+func countChunks(size int64, chunkSize int64) int64 {
+	if size == 0 {
+		return 1
+	}
+
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// encryptReader emits the header then seals the source chunk by chunk
+type encryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  *encryptionHeader
+	counter int64
+	chunk   []byte
+	sealed  []byte
+	out     []byte
+	done    bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD, header *encryptionHeader) *encryptReader {
+	return &encryptReader{
+		src:    bufio.NewReader(src),
+		aead:   aead,
+		header: header,
+		chunk:  make([]byte, header.chunkSize),
+		sealed: make([]byte, 0, header.chunkSize+gcmTagSize),
+		out:    header.raw,
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *encryptReader) next() error {
+	if r.counter > math.MaxUint32 {
+		return errors.New("object is too large to encrypt")
+	}
+
+	n, err := io.ReadFull(r.src, r.chunk)
+	final := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !final {
+		return err
+	}
+
+	if !final {
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out = r.aead.Seal(r.sealed[:0], r.header.nonce(r.counter, final), r.chunk[:n], r.header.raw)
+	r.counter++
+	r.done = final
+	return nil
+}
+
+// decryptReader opens chunks from counter to endChunk, or to the final chunk if endChunk is negative
+// lastChunk is the index of the final chunk if the object size is known, otherwise the end of the stream marks the final chunk
+type decryptReader struct {
+	src       *bufio.Reader
+	aead      cipher.AEAD
+	header    *encryptionHeader
+	counter   int64
+	endChunk  int64
+	lastChunk int64
+	sealed    []byte
+	chunk     []byte
+	out       []byte
+	done      bool
+}
+
+func newDecryptReader(src *bufio.Reader, aead cipher.AEAD, header *encryptionHeader, counter int64, endChunk int64) *decryptReader {
+	return &decryptReader{
+		src:       src,
+		aead:      aead,
+		header:    header,
+		counter:   counter,
+		endChunk:  endChunk,
+		lastChunk: -1,
+		sealed:    make([]byte, header.chunkSize+gcmTagSize),
+		chunk:     make([]byte, 0, header.chunkSize),
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) next() error {
+	if r.endChunk >= 0 && r.counter > r.endChunk {
+		r.done = true
+		return nil
+	}
+
+	if r.counter > math.MaxUint32 {
+		return fmt.Errorf("%w: too many chunks", ErrDecryptionFailed)
+	}
+
+	n, err := io.ReadFull(r.src, r.sealed)
+	final := errors.Is(err, io.ErrUnexpectedEOF)
+	switch {
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: object is truncated", ErrDecryptionFailed)
+	case err != nil && !final:
+		return err
+	case r.lastChunk >= 0:
+		final = r.counter == r.lastChunk
+	case !final:
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	chunk, err := r.aead.Open(r.chunk[:0], r.header.nonce(r.counter, final), r.sealed[:n], r.header.raw)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d, %w", ErrDecryptionFailed, r.counter, err)
+	}
+
+	r.out = chunk
+	r.counter++
+	r.done = final
+	return nil
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/hungdv136/gokit/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	inner := NewMemoryStorage()
+	s := newTestEncryptedStorage(t, inner, 16)
+
+	for _, size := range []int{0, 1, 15, 16, 17, 48, 100} {
+		content := []byte(util.RandomString(size, util.AlphaNumericCharacters))
+		objectKey := "pii/" + util.ToString(size) + ".txt"
+		_, err := s.UploadFile(ctx, objectKey, bytes.NewReader(content))
+		require.NoError(t, err)
+
+		stored := readAll(t, inner, objectKey)
+		require.Greater(t, len(stored), size)
+		if size >= 8 {
+			require.False(t, bytes.Contains(stored, content))
+		}
+
+		require.Equal(t, content, readAll(t, s, objectKey))
+
+		info, err := s.Stat(ctx, objectKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(size), info.Size)
+		require.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+	}
+
+	_, err := s.GetUploadURL(ctx, "pii/a.txt")
+	require.ErrorIs(t, err, ErrEncryptedUploadURL)
+
+	_, err = NewEncryptedStorage(inner, nil, WithChunkSize(0))
+	require.ErrorIs(t, err, ErrInvalidChunkSize)
+}
+
+func TestEncryptedStorage_DownloadRange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newTestEncryptedStorage(t, NewMemoryStorage(), 3)
+	objectKey := "ranges/a"
+	_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte("0123456789")))
+	require.NoError(t, err)
+
+	testDownloadRange(t, s, objectKey)
+
+	reader, err := NewObjectReader(ctx, s, objectKey)
+	require.NoError(t, err)
+	_, err = reader.Seek(5, io.SeekStart)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "56789", string(data))
+	require.NoError(t, reader.Close())
+}
+
+func TestEncryptedStorage_Tampered(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	inner := NewMemoryStorage()
+	s := newTestEncryptedStorage(t, inner, 4)
+	_, err := s.UploadFile(ctx, "a", bytes.NewReader([]byte("0123456789")))
+	require.NoError(t, err)
+	stored := readAll(t, inner, "a")
+	headerSize := len(stored) - 3*gcmTagSize - 10
+
+	testCases := []struct {
+		Name string
+		Data []byte
+	}{
+		{"flipped bit", append(append([]byte{}, stored[:len(stored)-1]...), stored[len(stored)-1]^1)},
+		{"truncated at chunk boundary", stored[:headerSize+2*(4+gcmTagSize)]},
+		{"extended", append(append([]byte{}, stored...), stored[headerSize:headerSize+4+gcmTagSize]...)},
+		{"not encrypted", []byte("0123456789")},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := inner.UploadFile(ctx, "a", bytes.NewReader(tc.Data))
+			require.NoError(t, err)
+
+			reader, err := s.DownloadFile(ctx, "a")
+			if err == nil {
+				_, err = io.ReadAll(reader)
+				require.NoError(t, reader.Close())
+			}
+			require.ErrorIs(t, err, ErrDecryptionFailed)
+		})
+	}
+}
+
+func TestStaticKeyProvider(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	inner := NewMemoryStorage()
+	oldKeys, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	s, err := NewEncryptedStorage(inner, oldKeys)
+	require.NoError(t, err)
+	_, err = s.UploadFile(ctx, "a", bytes.NewReader([]byte("secret")))
+	require.NoError(t, err)
+
+	newKeys, err := NewStaticKeyProvider("v2", map[string][]byte{"v1": bytes.Repeat([]byte{1}, 32), "v2": bytes.Repeat([]byte{2}, 32)})
+	require.NoError(t, err)
+	rotated, err := NewEncryptedStorage(inner, newKeys)
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(readAll(t, rotated, "a")))
+
+	wrapped, err := newKeys.WrapKey(ctx, []byte("data key"))
+	require.NoError(t, err)
+	require.Equal(t, "v2", wrapped.KeyID)
+	_, err = oldKeys.UnwrapKey(ctx, wrapped)
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	wrapped.KeyID = "v1"
+	_, err = newKeys.UnwrapKey(ctx, wrapped)
+	require.ErrorIs(t, err, ErrDecryptionFailed)
+
+	_, err = NewStaticKeyProvider("v1", map[string][]byte{"v1": []byte("short")})
+	require.Error(t, err)
+	_, err = NewStaticKeyProvider("v3", map[string][]byte{"v1": bytes.Repeat([]byte{1}, 32)})
+	require.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func newTestEncryptedStorage(t *testing.T, s Storage, chunkSize int) *EncryptedStorage {
+	keys, err := NewStaticKeyProvider("test", map[string][]byte{"test": bytes.Repeat([]byte{7}, 32)})
+	require.NoError(t, err)
+	e, err := NewEncryptedStorage(s, keys, WithChunkSize(chunkSize))
+	require.NoError(t, err)
+	return e
+}
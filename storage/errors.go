@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/hungdv136/gokit/logger"
+)
+
+// Errors returned by every backend. The original error is kept in the chain, use errors.Is to check them
+var (
+	ErrNotFound           = errors.New("object not found")
+	ErrAccessDenied       = errors.New("access denied")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrQuotaExceeded      = errors.New("quota exceeded")
+	ErrTimeout            = errors.New("storage timeout")
+)
+
+// s3ErrorCodes maps error codes of S3 and S3-compatible services
+var s3ErrorCodes = map[string]error{
+	"NoSuchKey":                  ErrNotFound,
+	"NoSuchBucket":               ErrNotFound,
+	"NoSuchUpload":               ErrNotFound,
+	"NoSuchVersion":              ErrNotFound,
+	"NotFound":                   ErrNotFound,
+	"AccessDenied":               ErrAccessDenied,
+	"AllAccessDisabled":          ErrAccessDenied,
+	"Forbidden":                  ErrAccessDenied,
+	"InvalidAccessKeyId":         ErrAccessDenied,
+	"SignatureDoesNotMatch":      ErrAccessDenied,
+	"AccountProblem":             ErrAccessDenied,
+	"PreconditionFailed":         ErrPreconditionFailed,
+	"ConditionalRequestConflict": ErrPreconditionFailed,
+	"QuotaExceeded":              ErrQuotaExceeded,
+	"TooManyBuckets":             ErrQuotaExceeded,
+	"SlowDown":                   ErrQuotaExceeded,
+	"Throttling":                 ErrQuotaExceeded,
+	"ThrottlingException":        ErrQuotaExceeded,
+	"RequestLimitExceeded":       ErrQuotaExceeded,
+	"RequestTimeout":             ErrTimeout,
+	"InvalidRange":               ErrInvalidRange,
+}
+
+// s3StatusCodes maps status codes of responses which do not have an error code, e.g. responses of HEAD requests
+var s3StatusCodes = map[int]error{
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusForbidden:          ErrAccessDenied,
+	http.StatusPreconditionFailed: ErrPreconditionFailed,
+	http.StatusTooManyRequests:    ErrQuotaExceeded,
+	http.StatusRequestTimeout:     ErrTimeout,
+}
+
+// mapError maps errors of the file system, the network and the context to storage errors
+func mapError(err error) error {
+	var netErr net.Error
+	switch {
+	case err == nil || isStorageError(err):
+		return err
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+	case errors.Is(err, syscall.ENOSPC):
+		return fmt.Errorf("%w: %w", ErrQuotaExceeded, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	default:
+		return err
+	}
+}
+
+// mapS3Error maps errors of the AWS SDK to storage errors
+func mapS3Error(err error) error {
+	var awsErr awserr.Error
+	if err == nil || isStorageError(err) || !errors.As(err, &awsErr) {
+		return mapError(err)
+	}
+
+	if target, ok := s3ErrorCodes[awsErr.Code()]; ok {
+		return fmt.Errorf("%w: %w", target, err)
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		if target, ok := s3StatusCodes[reqErr.StatusCode()]; ok {
+			return fmt.Errorf("%w: %w", target, err)
+		}
+	}
+
+	// Failures of sending requests wrap the cause, e.g. an expired context or a network timeout
+	if awsErr.Code() == request.ErrCodeResponseTimeout || errors.Is(mapError(awsErr.OrigErr()), ErrTimeout) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	return err
+}
+
+func isStorageError(err error) bool {
+	for _, target := range []error{ErrNotFound, ErrAccessDenied, ErrPreconditionFailed, ErrQuotaExceeded, ErrTimeout} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorLogger reports the caller of logError
+var errorLogger = logger.NewLogger().AddCallDepth(1)
+
+// logError logs a failed operation. Not-found is an expected outcome, it is logged at debug level
+func logError(ctx context.Context, err error) {
+	if errors.Is(err, ErrNotFound) {
+		errorLogger.Debug(ctx, err)
+		return
+	}
+
+	errorLogger.Error(ctx, err)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapS3Error(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name     string
+		Err      error
+		Expected error
+	}{
+		{"no such key", awserr.New("NoSuchKey", "missing", nil), ErrNotFound},
+		{"head not found", awserr.NewRequestFailure(awserr.New("NotFound", "", nil), http.StatusNotFound, "id"), ErrNotFound},
+		{"forbidden status", awserr.NewRequestFailure(awserr.New("Unknown", "", nil), http.StatusForbidden, "id"), ErrAccessDenied},
+		{"access denied", awserr.New("AccessDenied", "denied", nil), ErrAccessDenied},
+		{"precondition", awserr.NewRequestFailure(awserr.New("PreconditionFailed", "", nil), http.StatusPreconditionFailed, "id"), ErrPreconditionFailed},
+		{"slow down", awserr.New("SlowDown", "reduce your request rate", nil), ErrQuotaExceeded},
+		{"deadline", awserr.New(request.CanceledErrorCode, "canceled", context.DeadlineExceeded), ErrTimeout},
+		{"response timeout", awserr.New(request.ErrCodeResponseTimeout, "timeout", nil), ErrTimeout},
+		{"file not found", fmt.Errorf("open: %w", os.ErrNotExist), ErrNotFound},
+		{"permission", &os.PathError{Op: "open", Path: "a", Err: syscall.EACCES}, ErrAccessDenied},
+		{"disk full", &os.PathError{Op: "write", Path: "a", Err: syscall.ENOSPC}, ErrQuotaExceeded},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			err := mapS3Error(tc.Err)
+			require.ErrorIs(t, err, tc.Expected)
+			require.ErrorIs(t, err, tc.Err)
+		})
+	}
+
+	unknown := awserr.New("InternalError", "internal", nil)
+	require.Equal(t, unknown, mapS3Error(unknown))
+	require.False(t, isStorageError(mapS3Error(errors.New("unexpected"))))
+	require.NoError(t, mapS3Error(nil))
+}
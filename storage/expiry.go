@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hungdv136/gokit/logger"
+)
+
+// MetadataExpiresAt is the metadata key of the expiry of an object, an RFC 3339 timestamp in UTC
+const MetadataExpiresAt = "expires-at"
+
+// defaultJanitorInterval is the interval between sweeps if it is not configured
+const defaultJanitorInterval = time.Hour
+
+// WithExpiry expires the object after ttl. Expired objects are deleted by a Janitor
+func WithExpiry(ttl time.Duration) UploadOption {
+	return WithExpiresAt(time.Now().Add(ttl))
+}
+
+// WithExpiresAt expires the object at the given time. Expired objects are deleted by a Janitor
+func WithExpiresAt(expiresAt time.Time) UploadOption {
+	return WithMetadata(map[string]string{MetadataExpiresAt: expiresAt.UTC().Format(time.RFC3339)})
+}
+
+// ExpiresAt returns the expiry set at upload. It is zero if the object does not expire
+// Metadata is only returned by Stat, objects returned by List never expire
+func (o *ObjectInfo) ExpiresAt() time.Time {
+	expiresAt, err := time.Parse(time.RFC3339, o.Metadata[MetadataExpiresAt])
+	if err != nil {
+		return time.Time{}
+	}
+
+	return expiresAt
+}
+
+// JanitorOption modifies a janitor
+type JanitorOption func(*Janitor)
+
+// WithJanitorInterval sets the interval between sweeps. Default: 1 hour, non-positive intervals keep the default
+func WithJanitorInterval(interval time.Duration) JanitorOption {
+	return func(j *Janitor) {
+		if interval > 0 {
+			j.interval = interval
+		}
+	}
+}
+
+// WithJanitorClock sets the clock which expiries are compared with. Default: time.Now
+func WithJanitorClock(now func() time.Time) JanitorOption {
+	return func(j *Janitor) {
+		j.now = now
+	}
+}
+
+// Janitor deletes expired objects under a prefix on a schedule
+// Every object is read by Stat to get its expiry, keep temporary objects under a dedicated prefix
+// An object which is uploaded again without expiry between Stat and delete of a sweep may be deleted
+type Janitor struct {
+	storage  Storage
+	prefix   string
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewJanitor creates a janitor of objects which have the prefix
+func NewJanitor(s Storage, prefix string, options ...JanitorOption) *Janitor {
+	j := &Janitor{storage: s, prefix: prefix, interval: defaultJanitorInterval, now: time.Now}
+	for _, option := range options {
+		option(j)
+	}
+
+	return j
+}
+
+// Run sweeps immediately then at every interval until the context is done
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = j.Sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes expired objects once and returns the number of deleted objects
+// Objects which cannot be read or deleted are logged and skipped, the sweep stops if listing fails
+func (j *Janitor) Sweep(ctx context.Context) (int, error) {
+	now := j.now()
+	deleted := 0
+	expired := []string{}
+	it := NewObjectIterator(j.storage, j.prefix)
+	for it.Next(ctx) {
+		info, err := j.storage.Stat(ctx, it.Object().Key)
+		if err != nil {
+			logError(ctx, fmt.Errorf("unable to read expiry of %q, %w", it.Object().Key, err))
+			continue
+		}
+
+		if expiresAt := info.ExpiresAt(); expiresAt.IsZero() || expiresAt.After(now) {
+			continue
+		}
+
+		expired = append(expired, info.Key)
+		if len(expired) == maxDeleteObjects {
+			deleted += j.delete(ctx, expired)
+			expired = expired[:0]
+		}
+	}
+
+	deleted += j.delete(ctx, expired)
+	if deleted > 0 {
+		logger.Fields(ctx, "prefix", j.prefix, "deleted", deleted).Info(ctx, "deleted expired objects")
+	}
+
+	if err := it.Err(); err != nil {
+		logError(ctx, fmt.Errorf("unable to sweep %q, %w", j.prefix, err))
+		return deleted, err
+	}
+
+	return deleted, nil
+}
+
+// delete deletes the keys and returns the number of deleted keys
+func (j *Janitor) delete(ctx context.Context, objectKeys []string) int {
+	if len(objectKeys) == 0 {
+		return 0
+	}
+
+	keyErrors, err := j.storage.DeleteMany(ctx, objectKeys)
+	if err != nil {
+		return 0
+	}
+
+	for objectKey, keyErr := range keyErrors {
+		if !errors.Is(keyErr, ErrNotFound) {
+			logError(ctx, fmt.Errorf("unable to delete expired %q, %w", objectKey, keyErr))
+		}
+	}
+
+	return len(objectKeys) - len(keyErrors)
+}
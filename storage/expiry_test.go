@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJanitor_Sweep(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	local, err := newLocalStorage(ctx, LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name    string
+		Storage Storage
+	}{
+		{Name: "memory", Storage: NewMemoryStorage()},
+		{Name: "local", Storage: local},
+		{Name: "encrypted", Storage: newTestEncryptedStorage(t, NewMemoryStorage(), 16)},
+		{Name: "dedup", Storage: NewDedupStorage(NewMemoryStorage(), WithSpoolDir(t.TempDir()))},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			testJanitorSweep(t, tc.Storage, "exports/")
+		})
+	}
+}
+
+func TestJanitor_Run(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewMemoryStorage()
+	_, err := s.UploadFile(ctx, "tmp/a.csv", bytes.NewReader([]byte("a")), WithExpiry(-time.Second))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewJanitor(s, "tmp/", WithJanitorInterval(10*time.Millisecond)).Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		existed, err := s.Exist(ctx, "tmp/a.csv")
+		return err == nil && !existed
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	// Non-positive intervals keep the default interval
+	require.Equal(t, defaultJanitorInterval, NewJanitor(s, "tmp/", WithJanitorInterval(0)).interval)
+	NewJanitor(s, "tmp/", WithJanitorInterval(-time.Second)).Run(ctx)
+}
+
+func TestObjectInfo_ExpiresAt(t *testing.T) {
+	t.Parallel()
+
+	expiresAt := time.Date(2023, 6, 1, 10, 0, 0, 0, time.FixedZone("ICT", 7*3600))
+	opts := newUploadOptions([]UploadOption{WithExpiresAt(expiresAt)})
+	require.Equal(t, map[string]string{MetadataExpiresAt: "2023-06-01T03:00:00Z"}, opts.Metadata)
+
+	info := &ObjectInfo{Metadata: opts.Metadata}
+	require.True(t, expiresAt.Equal(info.ExpiresAt()))
+	require.True(t, (&ObjectInfo{}).ExpiresAt().IsZero())
+	require.True(t, (&ObjectInfo{Metadata: map[string]string{MetadataExpiresAt: "tomorrow"}}).ExpiresAt().IsZero())
+}
+
+func testJanitorSweep(t *testing.T, s Storage, prefix string) {
+	ctx := context.Background()
+	now := time.Now()
+	uploads := map[string][]UploadOption{
+		prefix + "expired.csv":    {WithExpiresAt(now.Add(-time.Minute))},
+		prefix + "a/expiring.csv": {WithExpiry(time.Hour), WithMetadata(map[string]string{"owner": "u1"})},
+		prefix + "kept.csv":       nil,
+		"other/expired.csv":       {WithExpiresAt(now.Add(-time.Minute))},
+	}
+
+	for objectKey, options := range uploads {
+		_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte("a,b")), options...)
+		require.NoError(t, err)
+	}
+
+	janitor := NewJanitor(s, prefix, WithJanitorClock(func() time.Time { return now }))
+	deleted, err := janitor.Sweep(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	info, err := s.Stat(ctx, prefix+"a/expiring.csv")
+	require.NoError(t, err)
+	require.Equal(t, "u1", info.Metadata["owner"])
+
+	now = now.Add(2 * time.Hour)
+	deleted, err = janitor.Sweep(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	objects, err := ListAll(ctx, s, prefix)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, prefix+"kept.csv", objects[0].Key)
+
+	existed, err := s.Exist(ctx, "other/expired.csv")
+	require.NoError(t, err)
+	require.True(t, existed)
+}
@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hungdv136/gokit/logger"
+	"github.com/hungdv136/gokit/util"
+)
+
+// Errors of image processing
+var (
+	ErrImageTooLarge  = errors.New("image is too large")
+	ErrInvalidImage   = errors.New("invalid image")
+	ErrUnknownVariant = errors.New("unknown image variant")
+)
+
+// Defaults of image processing
+const (
+	defaultJPEGQuality    = 85
+	defaultMaxImagePixels = 50_000_000
+	defaultMaxImageSize   = 50 << 20
+	defaultVariantPrefix  = "_variants/"
+)
+
+// ImageVariant is a resized copy of uploaded images
+// The image is scaled to fit within Width x Height, or to fill it and cropped if Crop is set. Images are never enlarged
+type ImageVariant struct {
+	Name   string `json:"name" yaml:"name"`
+	Width  int    `json:"width" yaml:"width"`
+	Height int    `json:"height" yaml:"height"`
+	Crop   bool   `json:"crop" yaml:"crop"`
+}
+
+// ImageOption modifies an image storage
+type ImageOption func(*ImageStorage)
+
+// WithImageVariants adds variants generated for every uploaded image
+func WithImageVariants(variants ...ImageVariant) ImageOption {
+	return func(s *ImageStorage) {
+		s.variants = append(s.variants, variants...)
+	}
+}
+
+// WithJPEGQuality sets the quality of re-encoded JPEG images. Default: 85
+func WithJPEGQuality(quality int) ImageOption {
+	return func(s *ImageStorage) {
+		s.quality = quality
+	}
+}
+
+// WithMaxImagePixels rejects images which have more pixels, it protects against decompression bombs. Default: 50 megapixels
+func WithMaxImagePixels(n int) ImageOption {
+	return func(s *ImageStorage) {
+		s.maxPixels = n
+	}
+}
+
+// WithMaxImageSize rejects images which are larger, images are processed in memory. Default: 50MiB
+func WithMaxImageSize(n int64) ImageOption {
+	return func(s *ImageStorage) {
+		s.maxSize = n
+	}
+}
+
+// WithVariantPrefix sets the prefix of variant keys. Default: _variants/
+func WithVariantPrefix(prefix string) ImageOption {
+	return func(s *ImageStorage) {
+		s.variantPrefix = prefix
+	}
+}
+
+// ImageStorage processes JPEG, PNG and GIF uploads: it strips metadata and generates variants
+//
+//	<key>                      original without EXIF, XMP, IPTC and text metadata
+//	_variants/<name>/<key>     variant of the original
+//
+// JPEG images are only re-encoded to apply their EXIF orientation, otherwise metadata is removed without decoding
+// GIF images are stored as they are and their variants are PNG images of the first frame
+// Other contents are stored as they are. Variants of an image are deleted, copied and moved with it
+type ImageStorage struct {
+	Storage
+	variants      []ImageVariant
+	quality       int
+	maxPixels     int
+	maxSize       int64
+	variantPrefix string
+}
+
+// NewImageStorage wraps a storage with image processing
+func NewImageStorage(s Storage, options ...ImageOption) *ImageStorage {
+	i := &ImageStorage{
+		Storage:       s,
+		quality:       defaultJPEGQuality,
+		maxPixels:     defaultMaxImagePixels,
+		maxSize:       defaultMaxImageSize,
+		variantPrefix: defaultVariantPrefix,
+	}
+	for _, option := range options {
+		option(i)
+	}
+
+	return i
+}
+
+// VariantKey returns the key of a variant of the object
+func (s *ImageStorage) VariantKey(objectKey string, variant string) string {
+	return s.variantPrefix + variant + "/" + objectKey
+}
+
+// UploadFile strips metadata of images, uploads them then uploads their variants
+// Returns the result of the original. Variants of the same key uploaded before are replaced
+// Contents which are not sniffed as images are streamed as they are, images which cannot be decoded are rejected
+func (s *ImageStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		logger.Error(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	reader = io.MultiReader(bytes.NewReader(head[:n]), reader)
+	if !isImageContentType(http.DetectContentType(head[:n])) {
+		return s.Storage.UploadFile(ctx, objectKey, reader, options...)
+	}
+
+	data, err := readAllLimited(reader, s.maxSize, ErrImageTooLarge)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	img, format, err := s.process(objectKey, data)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to process image %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	opts := newUploadOptions(options)
+	if len(opts.ContentType) == 0 {
+		options = append(options, WithContentType("image/"+format))
+	}
+
+	result, err := s.Storage.UploadFile(ctx, objectKey, bytes.NewReader(img.data), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.uploadVariants(ctx, objectKey, img, opts); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GenerateVariants generates the variants of a stored image, e.g. after a variant is added to the config
+func (s *ImageStorage) GenerateVariants(ctx context.Context, objectKey string) error {
+	reader, err := s.Storage.DownloadFile(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+
+	defer util.CloseSilently(ctx, reader.Close)
+
+	info, err := s.Storage.Stat(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+
+	data, err := readAllLimited(reader, s.maxSize, ErrImageTooLarge)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to read image %q, %w", objectKey, err))
+		return err
+	}
+
+	img, _, err := s.process(objectKey, data)
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to process image %q, %w", objectKey, err))
+		return err
+	}
+
+	return s.uploadVariants(ctx, objectKey, img, newUploadOptions([]UploadOption{withObjectInfo(info)}))
+}
+
+// DeleteFile deletes the object and its variants
+func (s *ImageStorage) DeleteFile(ctx context.Context, objectKey string) error {
+	if err := s.Storage.DeleteFile(ctx, objectKey); err != nil {
+		return err
+	}
+
+	return s.deleteVariants(ctx, []string{objectKey})
+}
+
+// DeleteMany deletes the objects and their variants. Errors of variants are logged
+func (s *ImageStorage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	keyErrors, err := s.Storage.DeleteMany(ctx, objectKeys)
+	if err != nil {
+		return keyErrors, err
+	}
+
+	deleted := make([]string, 0, len(objectKeys))
+	for _, objectKey := range objectKeys {
+		if _, failed := keyErrors[objectKey]; !failed {
+			deleted = append(deleted, objectKey)
+		}
+	}
+
+	return keyErrors, s.deleteVariants(ctx, deleted)
+}
+
+// Copy copies the object and its variants
+func (s *ImageStorage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	if err := s.Storage.Copy(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	for _, variant := range s.variants {
+		err := s.Storage.Copy(ctx, s.VariantKey(srcKey, variant.Name), s.VariantKey(dstKey, variant.Name))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Move moves the object and its variants
+func (s *ImageStorage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	if err := s.Storage.Move(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	for _, variant := range s.variants {
+		err := s.Storage.Move(ctx, s.VariantKey(srcKey, variant.Name), s.VariantKey(dstKey, variant.Name))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetURL returns the URL of the object, or of a variant with WithVariant
+// The variant is not checked for existence, objects which are not images have no variants
+func (s *ImageStorage) GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error) {
+	variant := newPresignOptions(0, options).Variant
+	if len(variant) == 0 {
+		return s.Storage.GetURL(ctx, objectKey, options...)
+	}
+
+	if !s.hasVariant(variant) {
+		err := fmt.Errorf("%w: %q", ErrUnknownVariant, variant)
+		logger.Error(ctx, err)
+		return "", err
+	}
+
+	return s.Storage.GetURL(ctx, s.VariantKey(objectKey, variant), options...)
+}
+
+// List lists objects without variants
+func (s *ImageStorage) List(ctx context.Context, prefix string, cursor string) (*ListResult, error) {
+	page, err := s.Storage.List(ctx, prefix, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := page.Objects[:0]
+	for _, obj := range page.Objects {
+		if !strings.HasPrefix(obj.Key, s.variantPrefix) {
+			objects = append(objects, obj)
+		}
+	}
+
+	page.Objects = objects
+	return page, nil
+}
+
+// processedImage is an upright image and the stored content of its original
+type processedImage struct {
+	data   []byte
+	format string
+	rgba   *image.RGBA
+}
+
+// process strips metadata and decodes the image
+// Contents which cannot be decoded return ErrInvalidImage, storing them as they are would keep their metadata
+func (s *ImageStorage) process(objectKey string, data []byte) (*processedImage, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %q cannot be decoded, %v", ErrInvalidImage, objectKey, err)
+	}
+
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, "", fmt.Errorf("%w: %q has unsupported format %q", ErrInvalidImage, objectKey, format)
+	}
+
+	if config.Width*config.Height > s.maxPixels {
+		return nil, "", fmt.Errorf("%w: %q has %dx%d pixels", ErrImageTooLarge, objectKey, config.Width, config.Height)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %q cannot be decoded, %v", ErrInvalidImage, objectKey, err)
+	}
+
+	img := &processedImage{data: data, format: format, rgba: toRGBA(decoded)}
+	switch format {
+	case "jpeg":
+		if orientation := readJPEGOrientation(data); orientation > 1 {
+			img.rgba = orient(img.rgba, orientation)
+			img.data, err = s.encode(img.rgba, format)
+		} else {
+			img.data, err = stripJPEGMetadata(data)
+		}
+	case "png":
+		img.data, err = stripPNGMetadata(data)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, format, nil
+}
+
+func (s *ImageStorage) uploadVariants(ctx context.Context, objectKey string, img *processedImage, opts *UploadOptions) error {
+	format := img.format
+	if format == "gif" {
+		format = "png"
+	}
+
+	for _, variant := range s.variants {
+		data, err := s.encode(fitVariant(img.rgba, variant.Width, variant.Height, variant.Crop), format)
+		if err != nil {
+			logger.Error(ctx, fmt.Errorf("unable to encode variant %q of %q, %w", variant.Name, objectKey, err))
+			return err
+		}
+
+		_, err = s.Storage.UploadFile(ctx, s.VariantKey(objectKey, variant.Name), bytes.NewReader(data),
+			WithContentType("image/"+format),
+			WithCacheControl(opts.CacheControl),
+			WithMetadata(opts.Metadata),
+			WithTags(opts.Tags),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ImageStorage) deleteVariants(ctx context.Context, objectKeys []string) error {
+	variantKeys := make([]string, 0, len(objectKeys)*len(s.variants))
+	for _, objectKey := range objectKeys {
+		for _, variant := range s.variants {
+			variantKeys = append(variantKeys, s.VariantKey(objectKey, variant.Name))
+		}
+	}
+
+	if len(variantKeys) == 0 {
+		return nil
+	}
+
+	keyErrors, err := s.Storage.DeleteMany(ctx, variantKeys)
+	if err != nil {
+		return err
+	}
+
+	for variantKey, keyErr := range keyErrors {
+		logError(ctx, fmt.Errorf("unable to delete variant %q, %w", variantKey, keyErr))
+	}
+
+	return nil
+}
+
+func (s *ImageStorage) encode(img image.Image, format string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: s.quality})
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	default:
+		err = png.Encode(buf, img)
+	}
+
+	return buf.Bytes(), err
+}
+
+func isImageContentType(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/gif"
+}
+
+func (s *ImageStorage) hasVariant(name string) bool {
+	for _, variant := range s.variants {
+		if variant.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// Errors of stripping image metadata
+var errMalformedImage = errors.New("malformed image")
+
+// JPEG markers
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerAPP0 = 0xE0
+	jpegMarkerAPP1 = 0xE1
+	jpegMarkerAPPD = 0xED
+	jpegMarkerCOM  = 0xFE
+)
+
+// exifOrientationTag is the tag of the orientation in IFD0 of EXIF
+const exifOrientationTag = 0x0112
+
+// pngMetadataChunks are ancillary PNG chunks which carry metadata
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripJPEGMetadata removes EXIF, XMP, IPTC and comment segments without decoding the image
+// JFIF, ICC profiles and Adobe segments are kept since they affect how the image is rendered
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return nil, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	for i := 2; i < len(data); {
+		if data[i] != 0xFF {
+			return nil, errMalformedImage
+		}
+
+		// Markers may be preceded by fill bytes
+		if i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, errMalformedImage
+		}
+
+		marker := data[i+1]
+		if marker == jpegMarkerSOS {
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			return nil, errMalformedImage
+		}
+
+		if marker != jpegMarkerAPP1 && marker != jpegMarkerAPPD && marker != jpegMarkerCOM {
+			out.Write(data[i:end])
+		}
+
+		i = end
+	}
+
+	return nil, errMalformedImage
+}
+
+// readJPEGOrientation returns the EXIF orientation of a JPEG, 1 if it is missing
+func readJPEGOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == jpegMarkerSOS {
+			break
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			break
+		}
+
+		if segment := data[i+4 : end]; marker == jpegMarkerAPP1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return readEXIFOrientation(segment[6:])
+		}
+
+		i = end
+	}
+
+	return 1
+}
+
+// readEXIFOrientation reads the orientation from IFD0 of a TIFF structure
+func readEXIFOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+
+			return 1
+		}
+	}
+
+	return 1
+}
+
+// stripPNGMetadata removes text, time and EXIF chunks without decoding the image
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	const signatureLength = 8
+	if len(data) < signatureLength {
+		return nil, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:signatureLength])
+	for i := signatureLength; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformedImage
+		}
+
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, errMalformedImage
+		}
+
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+
+		i = end
+	}
+
+	return out.Bytes(), nil
+}
+
+// toRGBA converts an image to premultiplied RGBA with origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// orient applies an EXIF orientation so the image is displayed upright without metadata
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+
+	return dst
+}
+
+// fitVariant scales the image to fit within width x height, or to cover it then crops the center if crop is set
+// Images are never enlarged. A zero width or height is not constrained
+func fitVariant(src *image.RGBA, width int, height int, crop bool) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if width <= 0 {
+		width = w
+	}
+
+	if height <= 0 {
+		height = h
+	}
+
+	scaleX, scaleY := float64(width)/float64(w), float64(height)/float64(h)
+	scale := min(scaleX, scaleY)
+	if crop {
+		scale = max(scaleX, scaleY)
+	}
+
+	if crop {
+		// Crop the source to the aspect ratio of the target so the scaled image covers it exactly
+		cw, ch := max(min(w, int(float64(width)/scale+0.5)), 1), max(min(h, int(float64(height)/scale+0.5)), 1)
+		x0, y0 := (w-cw)/2, (h-ch)/2
+		src = src.SubImage(image.Rect(x0, y0, x0+cw, y0+ch)).(*image.RGBA)
+		w, h = cw, ch
+	}
+
+	scale = min(scale, 1)
+	return resize(src, max(int(float64(w)*scale+0.5), 1), max(int(float64(h)*scale+0.5), 1))
+}
+
+// resize downscales with an area-averaging box filter, applied horizontally then vertically
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == width && h == height {
+		return toRGBA(src)
+	}
+
+	tmp := make([]float32, width*h*4)
+	xWeights := getBoxWeights(w, width)
+	for y := 0; y < h; y++ {
+		row := src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		for x, weights := range xWeights {
+			out := tmp[(y*width+x)*4:]
+			for _, wt := range weights {
+				for c := 0; c < 4; c++ {
+					out[c] += float32(row[wt.index*4+c]) * wt.weight
+				}
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range getBoxWeights(h, height) {
+		for x := 0; x < width; x++ {
+			var sum [4]float32
+			for _, wt := range weights {
+				in := tmp[(wt.index*width+x)*4:]
+				for c := 0; c < 4; c++ {
+					sum[c] += in[c] * wt.weight
+				}
+			}
+
+			out := dst.Pix[dst.PixOffset(x, y):]
+			for c := 0; c < 4; c++ {
+				out[c] = uint8(min(max(sum[c]+0.5, 0), 255))
+			}
+		}
+	}
+
+	return dst
+}
+
+type boxWeight struct {
+	index  int
+	weight float32
+}
+
+// getBoxWeights returns, for each destination pixel, the source pixels it covers and their share of it
+func getBoxWeights(srcSize int, dstSize int) [][]boxWeight {
+	scale := float64(srcSize) / float64(dstSize)
+	weights := make([][]boxWeight, dstSize)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			if coverage := min(end, float64(j+1)) - max(start, float64(j)); coverage > 0 {
+				weights[i] = append(weights[i], boxWeight{index: j, weight: float32(coverage / scale)})
+			}
+		}
+	}
+
+	return weights
+}
+
+// readAllLimited reads at most limit bytes, larger contents fail with errTooLarge
+func readAllLimited(reader io.Reader, limit int64, errTooLarge error) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, errTooLarge
+	}
+
+	return data, nil
+}
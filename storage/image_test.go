@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := NewMemoryStorage()
+	s := NewImageStorage(backend, WithImageVariants(
+		ImageVariant{Name: "thumbnail", Width: 10, Height: 10, Crop: true},
+		ImageVariant{Name: "medium", Width: 20, Height: 20},
+	))
+
+	testCases := []struct {
+		name           string
+		key            string
+		data           []byte
+		width          int
+		height         int
+		contentType    string
+		variantType    string
+		mediumWidth    int
+		mediumHeight   int
+		thumbnailWidth int
+	}{
+		{
+			name:        "jpeg with orientation",
+			key:         "avatars/a.jpg",
+			data:        withEXIFOrientation(t, encodeTestImage(t, "jpeg", 40, 20), 6),
+			width:       20,
+			height:      40,
+			contentType: "image/jpeg",
+			variantType: "image/jpeg",
+			mediumWidth: 10, mediumHeight: 20,
+		},
+		{
+			name:        "jpeg",
+			key:         "avatars/b.jpg",
+			data:        withEXIFOrientation(t, encodeTestImage(t, "jpeg", 40, 20), 1),
+			width:       40,
+			height:      20,
+			contentType: "image/jpeg",
+			variantType: "image/jpeg",
+			mediumWidth: 20, mediumHeight: 10,
+		},
+		{
+			name:        "png",
+			key:         "avatars/c.png",
+			data:        encodeTestImage(t, "png", 8, 8),
+			width:       8,
+			height:      8,
+			contentType: "image/png",
+			variantType: "image/png",
+			mediumWidth: 8, mediumHeight: 8,
+		},
+		{
+			name:        "gif",
+			key:         "avatars/d.gif",
+			data:        encodeTestImage(t, "gif", 30, 60),
+			width:       30,
+			height:      60,
+			contentType: "image/gif",
+			variantType: "image/png",
+			mediumWidth: 10, mediumHeight: 20,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := s.UploadFile(ctx, tc.key, bytes.NewReader(tc.data), WithMetadata(map[string]string{"owner": "u1"}))
+			require.NoError(t, err)
+
+			original := readAll(t, backend, tc.key)
+			require.NotContains(t, string(original), "Exif")
+			config, _, err := image.DecodeConfig(bytes.NewReader(original))
+			require.NoError(t, err)
+			require.Equal(t, tc.width, config.Width)
+			require.Equal(t, tc.height, config.Height)
+			info, err := backend.Stat(ctx, tc.key)
+			require.NoError(t, err)
+			require.Equal(t, tc.contentType, info.ContentType)
+
+			medium := readAll(t, backend, s.VariantKey(tc.key, "medium"))
+			config, _, err = image.DecodeConfig(bytes.NewReader(medium))
+			require.NoError(t, err)
+			require.Equal(t, tc.mediumWidth, config.Width)
+			require.Equal(t, tc.mediumHeight, config.Height)
+			info, err = backend.Stat(ctx, s.VariantKey(tc.key, "medium"))
+			require.NoError(t, err)
+			require.Equal(t, tc.variantType, info.ContentType)
+			require.Equal(t, "u1", info.Metadata["owner"])
+
+			thumbnail := readAll(t, backend, s.VariantKey(tc.key, "thumbnail"))
+			config, _, err = image.DecodeConfig(bytes.NewReader(thumbnail))
+			require.NoError(t, err)
+			require.Equal(t, min(10, tc.width, tc.height), config.Width)
+			require.Equal(t, min(10, tc.width, tc.height), config.Height)
+		})
+	}
+}
+
+func TestImageStorage_Objects(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := NewMemoryStorage()
+	s := NewImageStorage(backend, WithImageVariants(ImageVariant{Name: "thumbnail", Width: 4, Height: 4}))
+
+	// Other contents are stored as they are and have no variants
+	_, err := s.UploadFile(ctx, "docs/a.txt", bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(readAll(t, backend, "docs/a.txt")))
+	existed, err := backend.Exist(ctx, s.VariantKey("docs/a.txt", "thumbnail"))
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	_, err = s.UploadFile(ctx, "avatars/a.png", bytes.NewReader(encodeTestImage(t, "png", 16, 16)))
+	require.NoError(t, err)
+
+	url, err := s.GetURL(ctx, "avatars/a.png", WithVariant("thumbnail"))
+	require.NoError(t, err)
+	require.Equal(t, getMemoryURL(s.VariantKey("avatars/a.png", "thumbnail")), url)
+	_, err = s.GetURL(ctx, "avatars/a.png", WithVariant("large"))
+	require.ErrorIs(t, err, ErrUnknownVariant)
+
+	objects, err := ListAll(ctx, s, "")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+
+	require.NoError(t, s.Copy(ctx, "avatars/a.png", "avatars/b.png"))
+	require.NoError(t, s.Move(ctx, "avatars/b.png", "avatars/c.png"))
+	readAll(t, backend, s.VariantKey("avatars/c.png", "thumbnail"))
+	require.NoError(t, s.Copy(ctx, "docs/a.txt", "docs/b.txt"))
+
+	require.NoError(t, s.DeleteFile(ctx, "avatars/a.png"))
+	keyErrors, err := s.DeleteMany(ctx, []string{"avatars/c.png", "docs/a.txt", "docs/b.txt"})
+	require.NoError(t, err)
+	require.Empty(t, keyErrors)
+	objects, err = ListAll(ctx, backend, "")
+	require.NoError(t, err)
+	require.Empty(t, objects)
+
+	// Variants which are added later are generated from stored images
+	_, err = backend.UploadFile(ctx, "avatars/d.png", bytes.NewReader(encodeTestImage(t, "png", 16, 16)), WithContentType("image/png"))
+	require.NoError(t, err)
+	require.NoError(t, s.GenerateVariants(ctx, "avatars/d.png"))
+	readAll(t, backend, s.VariantKey("avatars/d.png", "thumbnail"))
+	require.Error(t, s.GenerateVariants(ctx, "docs/none.png"))
+}
+
+func TestImageStorage_TooLarge(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := encodeTestImage(t, "png", 100, 100)
+
+	s := NewImageStorage(NewMemoryStorage(), WithMaxImagePixels(100*99))
+	_, err := s.UploadFile(ctx, "a.png", bytes.NewReader(data))
+	require.ErrorIs(t, err, ErrImageTooLarge)
+
+	s = NewImageStorage(NewMemoryStorage(), WithMaxImageSize(int64(len(data)-1)))
+	_, err = s.UploadFile(ctx, "a.png", bytes.NewReader(data))
+	require.ErrorIs(t, err, ErrImageTooLarge)
+
+	// Other contents are not limited
+	_, err = s.UploadFile(ctx, "a.bin", bytes.NewReader(make([]byte, len(data))))
+	require.NoError(t, err)
+}
+
+func TestImageStorage_InvalidImage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := NewMemoryStorage()
+	s := NewImageStorage(backend)
+
+	// Contents sniffed as images which cannot be decoded would be stored with their metadata
+	truncated := withEXIFOrientation(t, encodeTestImage(t, "jpeg", 16, 16), 6)[:200]
+	_, err := s.UploadFile(ctx, "a.jpg", bytes.NewReader(truncated))
+	require.ErrorIs(t, err, ErrInvalidImage)
+
+	_, err = s.UploadFile(ctx, "b.png", bytes.NewReader(append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)))
+	require.ErrorIs(t, err, ErrInvalidImage)
+
+	// Headers of truncated images are decoded but their pixels are not
+	jpeg := encodeTestImage(t, "jpeg", 16, 16)
+	_, err = s.UploadFile(ctx, "c.jpg", bytes.NewReader(jpeg[:len(jpeg)-10]))
+	require.ErrorIs(t, err, ErrInvalidImage)
+
+	_, err = s.UploadFile(ctx, "d.png", bytes.NewReader(encodeTestImage(t, "png", 16, 16)[:100]))
+	require.ErrorIs(t, err, ErrInvalidImage)
+
+	for _, key := range []string{"a.jpg", "b.png", "c.jpg", "d.png"} {
+		existed, err := backend.Exist(ctx, key)
+		require.NoError(t, err)
+		require.False(t, existed)
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	t.Parallel()
+
+	data := encodeTestImage(t, "png", 4, 4)
+	// Insert a tEXt chunk after IHDR, which is 8+25 bytes
+	text := []byte("Comment\x00secret")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(append(append(chunk, "tEXt"...), text...), 0, 0, 0, 0)
+	withText := append(append(append([]byte{}, data[:33]...), chunk...), data[33:]...)
+
+	stripped, err := stripPNGMetadata(withText)
+	require.NoError(t, err)
+	require.Equal(t, data, stripped)
+
+	_, err = stripPNGMetadata(withText[:40])
+	require.ErrorIs(t, err, errMalformedImage)
+}
+
+func TestOrient(t *testing.T) {
+	t.Parallel()
+
+	// A 2x1 image of red then blue
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	testCases := []struct {
+		orientation int
+		expected    [][]color.RGBA
+	}{
+		{orientation: 1, expected: [][]color.RGBA{{red, blue}}},
+		{orientation: 2, expected: [][]color.RGBA{{blue, red}}},
+		{orientation: 3, expected: [][]color.RGBA{{blue, red}}},
+		{orientation: 6, expected: [][]color.RGBA{{red}, {blue}}},
+		{orientation: 8, expected: [][]color.RGBA{{blue}, {red}}},
+	}
+
+	for _, tc := range testCases {
+		dst := orient(src, tc.orientation)
+		require.Equal(t, len(tc.expected), dst.Bounds().Dy(), tc.orientation)
+		for y, row := range tc.expected {
+			for x, c := range row {
+				require.Equal(t, c, dst.RGBAAt(x, y), tc.orientation)
+			}
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+
+	// A 4x2 checkerboard of black and white averages to gray
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			src.Set(x, y, color.Gray{Y: uint8(255 * ((x + y) % 2))})
+		}
+	}
+
+	dst := resize(src, 2, 1)
+	require.Equal(t, image.Rect(0, 0, 2, 1), dst.Bounds())
+	require.Equal(t, color.RGBA{R: 128, G: 128, B: 128, A: 255}, dst.RGBAAt(0, 0))
+
+	// Images are not enlarged and cropped to the aspect ratio of the variant
+	require.Equal(t, image.Rect(0, 0, 4, 2), fitVariant(src, 8, 8, false).Bounds())
+	require.Equal(t, image.Rect(0, 0, 2, 2), fitVariant(src, 8, 8, true).Bounds())
+	require.Equal(t, image.Rect(0, 0, 1, 1), fitVariant(src, 1, 1, true).Bounds())
+	require.Equal(t, image.Rect(0, 0, 2, 1), fitVariant(src, 2, 0, false).Bounds())
+}
+
+func encodeTestImage(t *testing.T, format string, width int, height int) []byte {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetColorIndex(x, y, uint8((x/4+y/4)%2))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(buf, img, nil)
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	default:
+		err = png.Encode(buf, img)
+	}
+
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// withEXIFOrientation inserts an APP1 segment with a big endian EXIF orientation after SOI
+func withEXIFOrientation(t *testing.T, data []byte, orientation uint16) []byte {
+	require.Equal(t, []byte{0xFF, jpegMarkerSOI}, data[:2])
+
+	tiff := []byte("MM\x00\x2A\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, exifOrientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xFF, jpegMarkerAPP1}, binary.BigEndian.AppendUint16(nil, uint16(len(segment)+2))...)
+	app1 = append(app1, segment...)
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+)
+
+// ObjectIterator walks through all pages returned by Storage.List
+//
+//	it := storage.NewObjectIterator(s, "exports/")
+//	for it.Next(ctx) {
+//		obj := it.Object()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type ObjectIterator struct {
+	storage Storage
+	prefix  string
+	cursor  string
+	page    []*ObjectInfo
+	index   int
+	started bool
+	err     error
+}
+
+// NewObjectIterator creates an iterator for objects which have the prefix
+func NewObjectIterator(s Storage, prefix string) *ObjectIterator {
+	return &ObjectIterator{storage: s, prefix: prefix, index: -1}
+}
+
+// Next moves to the next object, fetches the next page if needed
+// Returns false when there is no more object or an error occurs
+func (it *ObjectIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	for it.index >= len(it.page) {
+		if it.started && len(it.cursor) == 0 {
+			return false
+		}
+
+		result, err := it.storage.List(ctx, it.prefix, it.cursor)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.started = true
+		it.page = result.Objects
+		it.cursor = result.NextCursor
+		it.index = 0
+	}
+
+	return true
+}
+
+// Object returns the current object
+func (it *ObjectIterator) Object() *ObjectInfo {
+	if it.index < 0 || it.index >= len(it.page) {
+		return nil
+	}
+
+	return it.page[it.index]
+}
+
+// Err returns the error which stopped the iteration
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
+
+// ListAll returns all objects which have the prefix
+func ListAll(ctx context.Context, s Storage, prefix string) ([]*ObjectInfo, error) {
+	objects := []*ObjectInfo{}
+	it := NewObjectIterator(s, prefix)
+	for it.Next(ctx) {
+		objects = append(objects, it.Object())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
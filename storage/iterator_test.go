@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectIterator(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newMemoryStorage(MemoryConfig{MaxKeys: 2})
+	keys := []string{"exports/a.csv", "exports/b.csv", "exports/c.csv", "exports/d.csv", "exports/e.csv", "images/a.png"}
+	for _, key := range keys {
+		_, err := s.UploadFile(ctx, key, bytes.NewReader([]byte(key)))
+		require.NoError(t, err)
+	}
+
+	page, err := s.List(ctx, "exports/", "")
+	require.NoError(t, err)
+	require.Len(t, page.Objects, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	objects, err := ListAll(ctx, s, "exports/")
+	require.NoError(t, err)
+	require.Len(t, objects, 5)
+	for i, obj := range objects {
+		require.Equal(t, keys[i], obj.Key)
+		require.Equal(t, int64(len(keys[i])), obj.Size)
+		require.NotEmpty(t, obj.ETag)
+	}
+
+	require.Len(t, s.Calls(OpList), 4)
+
+	objects, err = ListAll(ctx, s, "unknown/")
+	require.NoError(t, err)
+	require.Empty(t, objects)
+
+	errList := errors.New("list failed")
+	s.InjectFault(Fault{Operation: OpList, Nth: 2, Err: errList})
+
+	it := NewObjectIterator(s, "")
+	count := 0
+	for it.Next(ctx) {
+		count++
+	}
+
+	require.ErrorIs(t, it.Err(), errList)
+	require.Equal(t, 2, count)
+	require.Nil(t, it.Object())
+}
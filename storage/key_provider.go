@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// ErrKeyNotFound is returned when a key provider does not have the key which wrapped a data key
+var ErrKeyNotFound = errors.New("key not found")
+
+// WrappedKey is a data key encrypted by a master key of a key provider
+type WrappedKey struct {
+	KeyID      string
+	Ciphertext []byte
+}
+
+// KeyProvider wraps and unwraps per-object data keys of EncryptedStorage
+// Implementations may delegate to a KMS, the master keys never leave the provider
+type KeyProvider interface {
+	WrapKey(ctx context.Context, dataKey []byte) (*WrappedKey, error)
+	UnwrapKey(ctx context.Context, key *WrappedKey) ([]byte, error)
+}
+
+// StaticKeyProvider wraps data keys with AES-GCM using master keys held in memory
+// New data keys are wrapped by the current key, other keys are kept to unwrap existing objects after a rotation
+type StaticKeyProvider struct {
+	currentKeyID string
+	keys         map[string]cipher.AEAD
+}
+
+// NewStaticKeyProvider creates a provider from master keys indexed by key ID
+// Keys must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256
+func NewStaticKeyProvider(currentKeyID string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, currentKeyID)
+	}
+
+	p := &StaticKeyProvider{currentKeyID: currentKeyID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for keyID, key := range keys {
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q, %w", keyID, err)
+		}
+
+		p.keys[keyID] = aead
+	}
+
+	return p, nil
+}
+
+// WrapKey encrypts a data key with the current master key
+func (p *StaticKeyProvider) WrapKey(_ context.Context, dataKey []byte) (*WrappedKey, error) {
+	aead := p.keys[p.currentKeyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := aead.Seal(nonce, nonce, dataKey, []byte(p.currentKeyID))
+	return &WrappedKey{KeyID: p.currentKeyID, Ciphertext: ciphertext}, nil
+}
+
+// UnwrapKey decrypts a data key with the master key which wrapped it
+func (p *StaticKeyProvider) UnwrapKey(_ context.Context, key *WrappedKey) ([]byte, error) {
+	aead, ok := p.keys[key.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, key.KeyID)
+	}
+
+	if len(key.Ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: wrapped key is too short", ErrDecryptionFailed)
+	}
+
+	nonce, ciphertext := key.Ciphertext[:aead.NonceSize()], key.Ciphertext[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, []byte(key.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,686 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hungdv136/gokit/logger"
+)
+
+// Errors returned by local storage
+var (
+	ErrInvalidObjectKey = errors.New("invalid object key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrURLExpired       = errors.New("url is expired")
+)
+
+// LocalConfig defines config for local file system storage
+type LocalConfig struct {
+	RootDir              string        `json:"root_dir" yaml:"root_dir"`
+	PresignURLExpiration time.Duration `json:"presign_url_expiration" yaml:"presign_url_expiration"`
+	MaxKeys              int64         `json:"max_keys" yaml:"max_keys"`
+
+	// Leave SigningKey empty to return file:// URLs
+	// Otherwise, GetURL returns BaseURL/objectKey signed with HMAC-SHA256
+	BaseURL    string `json:"base_url" yaml:"base_url"`
+	SigningKey string `json:"signing_key" yaml:"signing_key"`
+}
+
+// Validate checks required fields
+func (c *LocalConfig) Validate() error {
+	if len(c.RootDir) == 0 {
+		return &ConfigError{Field: "root_dir", Err: errRequired}
+	}
+
+	// Signed URLs are absolute, they would be relative paths without a base URL
+	if len(c.SigningKey) > 0 && len(c.BaseURL) == 0 {
+		return &ConfigError{Field: "base_url", Err: errors.New("value is required to sign URLs")}
+	}
+
+	return nil
+}
+
+// LocalStorage stores objects in a directory of the local file system
+type LocalStorage struct {
+	config LocalConfig
+	mu     sync.Mutex // serializes conditional uploads
+}
+
+// newLocalStorage creates an instance of LocalStorage
+func newLocalStorage(ctx context.Context, config LocalConfig) (*LocalStorage, error) {
+	if len(config.RootDir) == 0 {
+		err := errors.New("missing root directory")
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	rootDir, err := filepath.Abs(config.RootDir)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	if err := os.MkdirAll(rootDir, 0o750); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	config.RootDir = rootDir
+	return &LocalStorage{config: config}, nil
+}
+
+// UploadFile reads from reader and writes to a file under the root directory
+// Data is written to a temporary file then renamed, so readers never see a partial file
+// Upload options are stored in a hidden sidecar file next to the data file
+// Conditions are checked atomically against other conditional uploads of this instance only
+func (s *LocalStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	path, err := s.getFilePath(objectKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	opts := newUploadOptions(options)
+	progress := newReaderProgress(opts.Progress, reader)
+	reader, err = opts.detectContentType(objectKey, reader)
+	if err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	if opts.hasConditions() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err := s.checkConditions(objectKey, path, opts); err != nil {
+			logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.RootDir, err))
+			return nil, err
+		}
+	}
+
+	checksums := newChecksummer(opts.Checksums)
+	if err := writeFileAtomic(path, io.TeeReader(progress.wrap(reader), checksums)); err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	meta, err := json.Marshal(&localMeta{UploadOptions: opts, Checksums: checksums.sum()})
+	if err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	if err := writeFileAtomic(getMetaPath(path), bytes.NewReader(meta)); err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	info := newLocalObjectInfo(objectKey, fileInfo)
+	return &UploadResult{Path: path, ETag: info.ETag, Size: info.Size, Checksums: checksums.sum()}, nil
+}
+
+// checkConditions checks conditions of the upload against the current file
+func (s *LocalStorage) checkConditions(objectKey string, path string, opts *UploadOptions) error {
+	fileInfo, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return opts.checkConditions(objectKey, false, "")
+	}
+
+	if err != nil {
+		return mapError(err)
+	}
+
+	return opts.checkConditions(objectKey, true, newLocalObjectInfo(objectKey, fileInfo).ETag)
+}
+
+// DownloadFile opens file and returns the content
+// Checksums are verified against the sidecar file, files which are not uploaded via UploadFile cannot be verified
+func (s *LocalStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	file, err := s.openFile(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to download %q from %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	etag := newLocalObjectInfo(objectKey, fileInfo).ETag
+	if !newDownloadOptions(options).VerifyChecksum {
+		return &DownloadResult{ReadCloser: file, ETag: etag}, nil
+	}
+
+	meta, err := readLocalMeta(file.Name())
+	if err != nil {
+		_ = file.Close()
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to download %q from %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	v, err := newChecksumVerifier(objectKey, meta.Checksums)
+	if err != nil {
+		_ = file.Close()
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to download %q from %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	return &DownloadResult{ReadCloser: newVerifyReader(file, v), ETag: etag}, nil
+}
+
+// DownloadRange opens file and returns length bytes from offset
+// Negative length reads to the end of the file
+func (s *LocalStorage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error) {
+	file, err := s.openFile(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to download %q from %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	if err := checkRange(info.Size(), offset, length); err != nil {
+		_ = file.Close()
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to download %q from %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to download %q from %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+
+	return &readCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+// DeleteFile deletes file. Deleting a missing file is not an error
+func (s *LocalStorage) DeleteFile(ctx context.Context, objectKey string) error {
+	path, err := s.getFilePath(objectKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, p := range []string{path, getMetaPath(path)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			err = mapError(err)
+			logError(ctx, fmt.Errorf("unable to delete %q from %q, %w", objectKey, s.config.RootDir, err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteMany deletes files one by one. Errors of keys which cannot be deleted are returned in the map
+func (s *LocalStorage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	keyErrors := map[string]error{}
+	for _, objectKey := range objectKeys {
+		if err := s.DeleteFile(ctx, objectKey); err != nil {
+			keyErrors[objectKey] = err
+		}
+	}
+
+	return keyErrors, nil
+}
+
+// Copy copies a file and its sidecar file to another key
+func (s *LocalStorage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	srcPath, dstPath, err := s.getCopyPaths(ctx, srcKey, dstKey)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range [][2]string{{srcPath, dstPath}, {getMetaPath(srcPath), getMetaPath(dstPath)}} {
+		err := copyFile(p[0], p[1])
+		if err != nil && p[0] != srcPath && errors.Is(err, os.ErrNotExist) {
+			// Files without sidecar files have no options, the sidecar file of the previous object must be removed
+			err = removeFile(p[1])
+		}
+
+		if err != nil {
+			err = mapError(err)
+			logError(ctx, fmt.Errorf("unable to copy %q to %q in %q, %w", srcKey, dstKey, s.config.RootDir, err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Move renames a file and its sidecar file to another key
+func (s *LocalStorage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	srcPath, dstPath, err := s.getCopyPaths(ctx, srcKey, dstKey)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range [][2]string{{srcPath, dstPath}, {getMetaPath(srcPath), getMetaPath(dstPath)}} {
+		err := os.Rename(p[0], p[1])
+		if err != nil && p[0] != srcPath && errors.Is(err, os.ErrNotExist) {
+			// Files without sidecar files have no options, the sidecar file of the previous object must be removed
+			err = removeFile(p[1])
+		}
+
+		if err != nil {
+			err = mapError(err)
+			logError(ctx, fmt.Errorf("unable to move %q to %q in %q, %w", srcKey, dstKey, s.config.RootDir, err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getCopyPaths returns paths of source and destination keys and creates the destination directory
+func (s *LocalStorage) getCopyPaths(ctx context.Context, srcKey string, dstKey string) (string, string, error) {
+	srcPath, err := s.getFilePath(srcKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return "", "", err
+	}
+
+	dstPath, err := s.getFilePath(dstKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o750); err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to copy %q to %q in %q, %w", srcKey, dstKey, s.config.RootDir, err))
+		return "", "", err
+	}
+
+	return srcPath, dstPath, nil
+}
+
+// GetURL returns a file:// URL if signing key is not set
+// Otherwise returns an URL signed by HMAC which is expired after PresignURLExpiration
+func (s *LocalStorage) GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error) {
+	opts := newPresignOptions(s.config.PresignURLExpiration, options)
+	return s.presign(ctx, http.MethodGet, objectKey, opts)
+}
+
+// GetUploadURL returns a PUT request of a signed URL or a file:// URL if signing key is not set
+// Content type and content length are signed if they are provided, VerifyRequest rejects requests which do not match
+func (s *LocalStorage) GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (*PresignedRequest, error) {
+	opts := newPresignOptions(s.config.PresignURLExpiration, options)
+	signedURL, err := s.presign(ctx, http.MethodPut, objectKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	if len(opts.ContentType) > 0 {
+		headers.Set("Content-Type", opts.ContentType)
+	}
+
+	return &PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       signedURL,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(opts.Expiration),
+	}, nil
+}
+
+// VerifyRequest checks the signature, the expiration and the constraints of a request
+// which is sent to an URL generated by GetURL or GetUploadURL
+// This is to be used by the HTTP handler that serves the signed URLs
+func (s *LocalStorage) VerifyRequest(r *http.Request, objectKey string) error {
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	opts := &PresignOptions{ContentType: query.Get("content_type")}
+	if v := query.Get("content_length"); len(v) > 0 {
+		if opts.ContentLength, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return ErrInvalidSignature
+		}
+	}
+
+	if !hmac.Equal([]byte(s.sign(method, objectKey, expires, opts)), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+
+	if time.Now().Unix() > expires {
+		return ErrURLExpired
+	}
+
+	if len(opts.ContentType) > 0 && r.Header.Get("Content-Type") != opts.ContentType {
+		return ErrInvalidSignature
+	}
+
+	if opts.ContentLength > 0 && r.ContentLength != opts.ContentLength {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) presign(ctx context.Context, method string, objectKey string, opts *PresignOptions) (string, error) {
+	path, err := s.getFilePath(objectKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return "", err
+	}
+
+	if len(s.config.SigningKey) == 0 {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+	}
+
+	expires := time.Now().Add(opts.Expiration).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.sign(method, objectKey, expires, opts))
+
+	if len(opts.ContentType) > 0 {
+		query.Set("content_type", opts.ContentType)
+	}
+
+	if opts.ContentLength > 0 {
+		query.Set("content_length", strconv.FormatInt(opts.ContentLength, 10))
+	}
+
+	path = (&url.URL{Path: objectKey}).EscapedPath()
+	return strings.TrimSuffix(s.config.BaseURL, "/") + "/" + strings.TrimPrefix(path, "/") + "?" + query.Encode(), nil
+}
+
+// Exist checks if file is existed
+func (s *LocalStorage) Exist(ctx context.Context, objectKey string) (bool, error) {
+	path, err := s.getFilePath(objectKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return false, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		err = mapError(err)
+		logger.Error(ctx, err)
+		return false, err
+	}
+
+	return !info.IsDir(), nil
+}
+
+func (s *LocalStorage) openFile(ctx context.Context, objectKey string) (*os.File, error) {
+	path, err := s.getFilePath(objectKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to download %q from %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Stat returns attributes of a file and the options stored when it was uploaded
+func (s *LocalStorage) Stat(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	path, err := s.getFilePath(objectKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to stat %q in %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	info := newLocalObjectInfo(objectKey, fileInfo)
+	meta, err := readLocalMeta(path)
+	if err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to stat %q in %q, %w", objectKey, s.config.RootDir, err))
+		return nil, err
+	}
+
+	meta.applyTo(info)
+	return info, nil
+}
+
+// List returns a page of files which have the prefix, sorted by key
+// The cursor is the last key of the previous page
+func (s *LocalStorage) List(ctx context.Context, prefix string, cursor string) (*ListResult, error) {
+	objects := []*ObjectInfo{}
+	walkFunc := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() || isInternalFile(d.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.config.RootDir, path)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) || key <= cursor {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, newLocalObjectInfo(key, info))
+		return nil
+	}
+
+	// Only walk the deepest directory which is covered by the prefix
+	startDir := s.config.RootDir
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		if dir, err := s.getFilePath(prefix[:i]); err == nil {
+			startDir = dir
+		}
+	}
+
+	if err := filepath.WalkDir(startDir, walkFunc); err != nil {
+		err = mapError(err)
+		logError(ctx, fmt.Errorf("unable to list %q in %q, %w", prefix, s.config.RootDir, err))
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	result := &ListResult{Objects: objects}
+	maxKeys := s.config.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	if int64(len(objects)) > maxKeys {
+		result.Objects = objects[:maxKeys]
+		result.NextCursor = objects[maxKeys-1].Key
+	}
+
+	return result, nil
+}
+
+func (s *LocalStorage) sign(method string, objectKey string, expires int64, opts *PresignOptions) string {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%d", method, objectKey, expires, opts.ContentType, opts.ContentLength)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getFilePath joins object key with root directory
+// Returns an error if the result points outside of the root directory
+func (s *LocalStorage) getFilePath(objectKey string) (string, error) {
+	path := filepath.Join(s.config.RootDir, filepath.FromSlash(objectKey))
+	rel, err := filepath.Rel(s.config.RootDir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || isInternalFile(filepath.Base(path)) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectKey, objectKey)
+	}
+
+	return path, nil
+}
+
+func newLocalObjectInfo(key string, info fs.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+}
+
+// localMeta is the content of sidecar files
+type localMeta struct {
+	*UploadOptions
+	Checksums Checksums `json:"checksums"`
+}
+
+// readLocalMeta reads the sidecar file of a data file
+// Files which are not uploaded via UploadFile do not have sidecar files, empty metadata is returned
+func readLocalMeta(path string) (*localMeta, error) {
+	meta := &localMeta{UploadOptions: &UploadOptions{}}
+	data, err := os.ReadFile(getMetaPath(path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return meta, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// getMetaPath returns the path of the sidecar file which stores upload options
+func getMetaPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".meta")
+}
+
+// isInternalFile checks if the name is a temporary file or a metadata file
+// Those files are hidden from List and cannot be accessed as objects
+func isInternalFile(name string) bool {
+	return strings.HasPrefix(name, ".") && (strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".meta"))
+}
+
+// removeFile removes a file, removing a missing file is not an error
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func copyFile(srcPath string, dstPath string) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = f.Close() }()
+
+	return writeFileAtomic(dstPath, f)
+}
+
+func writeFileAtomic(path string, reader io.Reader) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpName := f.Name()
+	if _, err := io.Copy(f, reader); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+
+	return nil
+}
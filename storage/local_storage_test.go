@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hungdv136/gokit/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rootDir := t.TempDir()
+	s, err := NewStorage(ctx, TypeLocal, LocalConfig{RootDir: rootDir})
+	require.NoError(t, err)
+
+	objectKey := "nested/" + uuid.NewString()
+	content := []byte(util.RandomString(64, util.AlphaNumericCharacters))
+
+	result, err := s.UploadFile(ctx, objectKey, bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(rootDir, objectKey), result.Path)
+	require.Equal(t, int64(len(content)), result.Size)
+	require.NotEmpty(t, result.ETag)
+	require.Len(t, result.Checksums.SHA256, 64)
+
+	download, err := s.DownloadFile(ctx, objectKey)
+	require.NoError(t, err)
+	downloadContent, err := io.ReadAll(download)
+	require.NoError(t, err)
+	require.NoError(t, download.Close())
+	require.Equal(t, content, downloadContent)
+
+	existed, err := s.Exist(ctx, objectKey)
+	require.NoError(t, err)
+	require.True(t, existed)
+
+	existed, err = s.Exist(ctx, uuid.NewString())
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	fileURL, err := s.GetURL(ctx, objectKey)
+	require.NoError(t, err)
+	require.Equal(t, "file://"+filepath.ToSlash(result.Path), fileURL)
+
+	require.NoError(t, s.DeleteFile(ctx, objectKey))
+	require.NoError(t, s.DeleteFile(ctx, objectKey))
+
+	existed, err = s.Exist(ctx, objectKey)
+	require.NoError(t, err)
+	require.False(t, existed)
+}
+
+func TestLocalStorage_Stat(t *testing.T) {
+	t.Parallel()
+
+	s, err := newLocalStorage(context.Background(), LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	objectKey := "reports/" + uuid.NewString() + ".json"
+	_, err = s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"a":1}`)),
+		WithContentDisposition(`attachment; filename="report.json"`),
+		WithCacheControl("max-age=60"),
+		WithMetadata(map[string]string{"Owner": "u1"}),
+		WithTags(map[string]string{"class": "report"}),
+	)
+	require.NoError(t, err)
+
+	info, err := s.Stat(ctx, objectKey)
+	require.NoError(t, err)
+	require.Equal(t, objectKey, info.Key)
+	require.Equal(t, int64(7), info.Size)
+	require.NotEmpty(t, info.ETag)
+	require.False(t, info.LastModified.IsZero())
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, `attachment; filename="report.json"`, info.ContentDisposition)
+	require.Equal(t, "max-age=60", info.CacheControl)
+	require.Equal(t, map[string]string{"owner": "u1"}, info.Metadata)
+	require.Equal(t, map[string]string{"class": "report"}, info.Tags)
+
+	_, err = s.Stat(ctx, uuid.NewString())
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestLocalStorage_List(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, err := newLocalStorage(ctx, LocalConfig{RootDir: t.TempDir(), MaxKeys: 2})
+	require.NoError(t, err)
+
+	keys := []string{"exports/2023/a.csv", "exports/2023/b.csv", "exports/2024/a.csv", "exports-old/a.csv", "images/a.png"}
+	for _, key := range keys {
+		_, err := s.UploadFile(ctx, key, bytes.NewReader([]byte(key)))
+		require.NoError(t, err)
+	}
+
+	page, err := s.List(ctx, "exports/", "")
+	require.NoError(t, err)
+	require.Len(t, page.Objects, 2)
+	require.Equal(t, "exports/2023/b.csv", page.NextCursor)
+
+	page, err = s.List(ctx, "exports/", page.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, page.Objects, 1)
+	require.Equal(t, "exports/2024/a.csv", page.Objects[0].Key)
+	require.Equal(t, int64(len(keys[2])), page.Objects[0].Size)
+	require.NotEmpty(t, page.Objects[0].ETag)
+	require.Empty(t, page.NextCursor)
+
+	objects, err := ListAll(ctx, s, "exports")
+	require.NoError(t, err)
+	require.Len(t, objects, 4)
+	require.Equal(t, "exports-old/a.csv", objects[0].Key)
+
+	objects, err = ListAll(ctx, s, "missing/dir/")
+	require.NoError(t, err)
+	require.Empty(t, objects)
+}
+
+func TestLocalStorage_DownloadRange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, err := newLocalStorage(ctx, LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+	objectKey := "ranges/" + uuid.NewString()
+	_, err = s.UploadFile(ctx, objectKey, bytes.NewReader([]byte("0123456789")))
+	require.NoError(t, err)
+
+	testDownloadRange(t, s, objectKey)
+}
+
+func TestLocalStorage_CopyMove(t *testing.T) {
+	t.Parallel()
+
+	s, err := newLocalStorage(context.Background(), LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	testCopyMove(t, s, "copy/")
+}
+
+func TestLocalStorage_CopyMoveWithoutSidecar(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rootDir := t.TempDir()
+	s, err := newLocalStorage(ctx, LocalConfig{RootDir: rootDir})
+	require.NoError(t, err)
+
+	// Files which are written without the storage have no sidecar files
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "plain.txt"), []byte("plain"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "other.txt"), []byte("other"), 0o600))
+
+	for _, dstKey := range []string{"copied.txt", "moved.txt"} {
+		_, err := s.UploadFile(ctx, dstKey, bytes.NewReader([]byte("previous")),
+			WithContentType("application/json"),
+			WithMetadata(map[string]string{"Owner": "u1"}),
+			WithChecksums(ChecksumSHA256),
+		)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.Copy(ctx, "plain.txt", "copied.txt"))
+	require.NoError(t, s.Move(ctx, "other.txt", "moved.txt"))
+
+	for dstKey, content := range map[string]string{"copied.txt": "plain", "moved.txt": "other"} {
+		info, err := s.Stat(ctx, dstKey)
+		require.NoError(t, err)
+		require.Empty(t, info.Metadata)
+		require.NotEqual(t, "application/json", info.ContentType)
+
+		// Checksums of the previous object do not apply to the content
+		_, err = s.DownloadFile(ctx, dstKey, WithChecksumVerification())
+		require.ErrorIs(t, err, ErrChecksumUnavailable)
+
+		download, err := s.DownloadFile(ctx, dstKey)
+		require.NoError(t, err)
+		data, err := io.ReadAll(download)
+		require.NoError(t, err)
+		require.NoError(t, download.Close())
+		require.Equal(t, content, string(data))
+	}
+}
+
+func TestLocalStorage_PathTraversal(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, err := NewStorage(ctx, TypeLocal, LocalConfig{RootDir: filepath.Join(t.TempDir(), "root")})
+	require.NoError(t, err)
+
+	for _, objectKey := range []string{"../escape", "a/../../escape", "", ".", "/..", "a/.b.meta"} {
+		_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte("data")))
+		require.ErrorIs(t, err, ErrInvalidObjectKey, objectKey)
+
+		_, err = s.DownloadFile(ctx, objectKey)
+		require.ErrorIs(t, err, ErrInvalidObjectKey, objectKey)
+
+		_, err = s.Exist(ctx, objectKey)
+		require.ErrorIs(t, err, ErrInvalidObjectKey, objectKey)
+	}
+}
+
+func TestLocalStorage_SignedURL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, err := newLocalStorage(ctx, LocalConfig{
+		RootDir:    t.TempDir(),
+		BaseURL:    "https://files.example.com/download/",
+		SigningKey: uuid.NewString(),
+	})
+	require.NoError(t, err)
+
+	objectKey := "avatars/" + uuid.NewString() + ".png"
+	signedURL, err := s.GetURL(ctx, objectKey, WithExpiration(time.Hour))
+	require.NoError(t, err)
+
+	u, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	require.Equal(t, "/download/"+objectKey, u.Path)
+
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	require.NoError(t, err)
+	require.InDelta(t, time.Now().Add(time.Hour).Unix(), expires, 5)
+
+	require.NoError(t, s.VerifyRequest(httptest.NewRequest(http.MethodGet, signedURL, nil), objectKey))
+	require.ErrorIs(t, s.VerifyRequest(httptest.NewRequest(http.MethodGet, signedURL, nil), "avatars/other.png"), ErrInvalidSignature)
+	require.ErrorIs(t, s.VerifyRequest(httptest.NewRequest(http.MethodPut, signedURL, nil), objectKey), ErrInvalidSignature)
+
+	expiredURL, err := s.GetURL(ctx, objectKey, WithExpiration(-time.Hour))
+	require.NoError(t, err)
+	require.ErrorIs(t, s.VerifyRequest(httptest.NewRequest(http.MethodGet, expiredURL, nil), objectKey), ErrURLExpired)
+
+	content := []byte(`{"a":1}`)
+	upload, err := s.GetUploadURL(ctx, objectKey, WithRequiredContentType("application/json"), WithRequiredContentLength(int64(len(content))))
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPut, upload.Method)
+	require.Equal(t, "application/json", upload.Headers.Get("Content-Type"))
+
+	r := httptest.NewRequest(upload.Method, upload.URL, bytes.NewReader(content))
+	r.Header = upload.Headers.Clone()
+	require.NoError(t, s.VerifyRequest(r, objectKey))
+
+	r = httptest.NewRequest(upload.Method, upload.URL, bytes.NewReader(content))
+	r.Header.Set("Content-Type", "text/plain")
+	require.ErrorIs(t, s.VerifyRequest(r, objectKey), ErrInvalidSignature)
+
+	r = httptest.NewRequest(upload.Method, upload.URL, bytes.NewReader(append(content, content...)))
+	r.Header = upload.Headers.Clone()
+	require.ErrorIs(t, s.VerifyRequest(r, objectKey), ErrInvalidSignature)
+
+	tampered := strings.Replace(upload.URL, "content_length=", "content_length=1", 1)
+	r = httptest.NewRequest(upload.Method, tampered, bytes.NewReader(content))
+	r.Header = upload.Headers.Clone()
+	require.ErrorIs(t, s.VerifyRequest(r, objectKey), ErrInvalidSignature)
+}
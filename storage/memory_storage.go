@@ -0,0 +1,479 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hungdv136/gokit/logger"
+	"github.com/hungdv136/gokit/util"
+)
+
+// MemoryConfig defines config for in-memory storage
+type MemoryConfig struct {
+	MaxKeys int64 `json:"max_keys" yaml:"max_keys"`
+}
+
+// Fault defines an error or latency injected into MemoryStorage calls
+type Fault struct {
+	Operation string        // Empty matches all operations
+	KeyPrefix string        // Empty matches all object keys
+	Nth       int           // Only the nth matching call (1-based) is affected. 0 affects every matching call
+	Err       error         // Error to return. Nil to inject latency only
+	Delay     time.Duration // Latency before the call is processed
+
+	matched int
+}
+
+// Call records a call to MemoryStorage
+type Call struct {
+	Operation string
+	ObjectKey string
+	Err       error
+	Time      time.Time
+}
+
+// MemoryStorage keeps objects in memory. It is safe for concurrent use
+// This is to be used in unit tests and local development
+type MemoryStorage struct {
+	config  MemoryConfig
+	mu      sync.Mutex
+	objects map[string]*memoryObject
+	faults  []*Fault
+	calls   []Call
+}
+
+type memoryObject struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	options      *UploadOptions
+	checksums    Checksums
+}
+
+func newMemoryObject(data []byte, options *UploadOptions) *memoryObject {
+	sum := md5.Sum(data) //nolint:gosec // ETag is MD5 of the content as S3 does
+	checksums := newChecksummer(options.Checksums)
+	_, _ = checksums.Write(data)
+	return &memoryObject{
+		data:         data,
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: time.Now(),
+		options:      options,
+		checksums:    checksums.sum(),
+	}
+}
+
+func (o *memoryObject) info(key string) *ObjectInfo {
+	return &ObjectInfo{Key: key, Size: int64(len(o.data)), ETag: o.etag, LastModified: o.lastModified}
+}
+
+// NewMemoryStorage creates an instance of MemoryStorage with default config
+func NewMemoryStorage() *MemoryStorage {
+	return newMemoryStorage(MemoryConfig{})
+}
+
+// newMemoryStorage creates an instance of MemoryStorage
+func newMemoryStorage(config MemoryConfig) *MemoryStorage {
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = defaultMaxKeys
+	}
+
+	return &MemoryStorage{config: config, objects: map[string]*memoryObject{}}
+}
+
+// InjectFault adds a fault which is applied to the matching calls
+func (s *MemoryStorage) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f.matched = 0
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all injected faults
+func (s *MemoryStorage) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// Calls returns recorded calls filtered by operations. Returns all calls if operations is empty
+func (s *MemoryStorage) Calls(operations ...string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := make([]Call, 0, len(s.calls))
+	for _, c := range s.calls {
+		if len(operations) == 0 || util.ArrayContains(operations, c.Operation) {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// ResetCalls removes all recorded calls
+func (s *MemoryStorage) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = nil
+}
+
+// UploadFile reads from reader and stores in memory
+func (s *MemoryStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (_ *UploadResult, err error) {
+	defer func() { s.record(OpUploadFile, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpUploadFile, objectKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	opts := newUploadOptions(options)
+	data, err := io.ReadAll(newReaderProgress(opts.Progress, reader).wrap(reader))
+	if err != nil {
+		logError(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	if len(opts.ContentType) == 0 {
+		opts.ContentType = detectContentType(objectKey, data)
+	}
+
+	obj := newMemoryObject(data, opts)
+	s.mu.Lock()
+	if err := s.checkConditions(objectKey, opts); err != nil {
+		s.mu.Unlock()
+		logError(ctx, fmt.Errorf("unable to upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	s.objects[objectKey] = obj
+	s.mu.Unlock()
+
+	return &UploadResult{Path: objectKey, ETag: obj.etag, Size: int64(len(data)), Checksums: obj.checksums}, nil
+}
+
+// checkConditions checks conditions of the upload against the current object. It must be called with s.mu held
+func (s *MemoryStorage) checkConditions(objectKey string, opts *UploadOptions) error {
+	current, ok := s.objects[objectKey]
+	if !ok {
+		return opts.checkConditions(objectKey, false, "")
+	}
+
+	return opts.checkConditions(objectKey, true, current.etag)
+}
+
+// DownloadFile returns a copy of the stored data
+func (s *MemoryStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (_ *DownloadResult, err error) {
+	defer func() { s.record(OpDownloadFile, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpDownloadFile, objectKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to download %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	s.mu.Lock()
+	obj, ok := s.objects[objectKey]
+	s.mu.Unlock()
+
+	if !ok {
+		err := fmt.Errorf("%q: %w", objectKey, ErrNotFound)
+		logError(ctx, fmt.Errorf("unable to download %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	reader := io.NopCloser(bytes.NewReader(obj.data))
+	if !newDownloadOptions(options).VerifyChecksum {
+		return &DownloadResult{ReadCloser: reader, ETag: obj.etag}, nil
+	}
+
+	v, err := newChecksumVerifier(objectKey, obj.checksums)
+	if err != nil {
+		logError(ctx, fmt.Errorf("unable to download %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	return &DownloadResult{ReadCloser: newVerifyReader(reader, v), ETag: obj.etag}, nil
+}
+
+// DownloadRange returns a copy of length bytes from offset. Negative length reads to the end
+func (s *MemoryStorage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (_ io.ReadCloser, err error) {
+	defer func() { s.record(OpDownloadRange, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpDownloadRange, objectKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to download %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	s.mu.Lock()
+	obj, ok := s.objects[objectKey]
+	s.mu.Unlock()
+
+	if !ok {
+		err := fmt.Errorf("%q: %w", objectKey, ErrNotFound)
+		logError(ctx, fmt.Errorf("unable to download %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	size := int64(len(obj.data))
+	if err := checkRange(size, offset, length); err != nil {
+		logError(ctx, fmt.Errorf("unable to download %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+
+	return io.NopCloser(bytes.NewReader(obj.data[offset:end])), nil
+}
+
+// DeleteFile deletes object. Deleting a missing object is not an error
+func (s *MemoryStorage) DeleteFile(ctx context.Context, objectKey string) (err error) {
+	defer func() { s.record(OpDeleteFile, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpDeleteFile, objectKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to delete %q, %w", objectKey, err))
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.objects, objectKey)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// DeleteMany deletes objects one by one. Faults of OpDeleteMany are applied per key
+// Errors of keys which cannot be deleted are returned in the map
+func (s *MemoryStorage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	keyErrors := map[string]error{}
+	for _, objectKey := range objectKeys {
+		err := s.applyFaults(ctx, OpDeleteMany, objectKey)
+		s.record(OpDeleteMany, objectKey, err)
+		if err != nil {
+			logError(ctx, fmt.Errorf("unable to delete %q, %w", objectKey, err))
+			keyErrors[objectKey] = err
+			continue
+		}
+
+		s.mu.Lock()
+		delete(s.objects, objectKey)
+		s.mu.Unlock()
+	}
+
+	return keyErrors, nil
+}
+
+// Copy copies an object and its attributes to another key
+func (s *MemoryStorage) Copy(ctx context.Context, srcKey string, dstKey string) (err error) {
+	defer func() { s.record(OpCopy, srcKey, err) }()
+
+	if err := s.applyFaults(ctx, OpCopy, srcKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to copy %q to %q, %w", srcKey, dstKey, err))
+		return err
+	}
+
+	return s.copyObject(ctx, srcKey, dstKey, false)
+}
+
+// Move moves an object and its attributes to another key
+func (s *MemoryStorage) Move(ctx context.Context, srcKey string, dstKey string) (err error) {
+	defer func() { s.record(OpMove, srcKey, err) }()
+
+	if err := s.applyFaults(ctx, OpMove, srcKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to move %q to %q, %w", srcKey, dstKey, err))
+		return err
+	}
+
+	return s.copyObject(ctx, srcKey, dstKey, true)
+}
+
+func (s *MemoryStorage) copyObject(ctx context.Context, srcKey string, dstKey string, deleteSource bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[srcKey]
+	if !ok {
+		err := fmt.Errorf("%q: %w", srcKey, ErrNotFound)
+		logError(ctx, fmt.Errorf("unable to copy %q to %q, %w", srcKey, dstKey, err))
+		return err
+	}
+
+	s.objects[dstKey] = &memoryObject{data: obj.data, etag: obj.etag, lastModified: time.Now(), options: obj.options, checksums: obj.checksums}
+	if deleteSource && srcKey != dstKey {
+		delete(s.objects, srcKey)
+	}
+
+	return nil
+}
+
+// GetURL returns a memory:// URL of the object
+func (s *MemoryStorage) GetURL(ctx context.Context, objectKey string, _ ...PresignOption) (_ string, err error) {
+	defer func() { s.record(OpGetURL, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpGetURL, objectKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to presign %q, %w", objectKey, err))
+		return "", err
+	}
+
+	return getMemoryURL(objectKey), nil
+}
+
+// GetUploadURL returns a PUT request of the memory:// URL of the object
+func (s *MemoryStorage) GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (_ *PresignedRequest, err error) {
+	defer func() { s.record(OpGetUploadURL, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpGetUploadURL, objectKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to presign upload %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	opts := newPresignOptions(0, options)
+	headers := http.Header{}
+	if len(opts.ContentType) > 0 {
+		headers.Set("Content-Type", opts.ContentType)
+	}
+
+	return &PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       getMemoryURL(objectKey),
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(opts.Expiration),
+	}, nil
+}
+
+// Exist checks if object is existed
+func (s *MemoryStorage) Exist(ctx context.Context, objectKey string) (_ bool, err error) {
+	defer func() { s.record(OpExist, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpExist, objectKey); err != nil {
+		logger.Error(ctx, err)
+		return false, err
+	}
+
+	s.mu.Lock()
+	_, ok := s.objects[objectKey]
+	s.mu.Unlock()
+
+	return ok, nil
+}
+
+// Stat returns attributes of an object and the options stored when it was uploaded
+func (s *MemoryStorage) Stat(ctx context.Context, objectKey string) (_ *ObjectInfo, err error) {
+	defer func() { s.record(OpStat, objectKey, err) }()
+
+	if err := s.applyFaults(ctx, OpStat, objectKey); err != nil {
+		logError(ctx, fmt.Errorf("unable to stat %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	s.mu.Lock()
+	obj, ok := s.objects[objectKey]
+	s.mu.Unlock()
+
+	if !ok {
+		err := fmt.Errorf("%q: %w", objectKey, ErrNotFound)
+		logError(ctx, fmt.Errorf("unable to stat %q, %w", objectKey, err))
+		return nil, err
+	}
+
+	info := obj.info(objectKey)
+	obj.options.applyTo(info)
+	return info, nil
+}
+
+// List returns a page of objects which have the prefix, sorted by key
+// The cursor is the last key of the previous page
+func (s *MemoryStorage) List(ctx context.Context, prefix string, cursor string) (_ *ListResult, err error) {
+	defer func() { s.record(OpList, prefix, err) }()
+
+	if err := s.applyFaults(ctx, OpList, prefix); err != nil {
+		logError(ctx, fmt.Errorf("unable to list %q, %w", prefix, err))
+		return nil, err
+	}
+
+	s.mu.Lock()
+	objects := []*ObjectInfo{}
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > cursor {
+			objects = append(objects, obj.info(key))
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	result := &ListResult{Objects: objects}
+	if maxKeys := s.config.MaxKeys; int64(len(objects)) > maxKeys {
+		result.Objects = objects[:maxKeys]
+		result.NextCursor = objects[maxKeys-1].Key
+	}
+
+	return result, nil
+}
+
+func getMemoryURL(objectKey string) string {
+	return (&url.URL{Scheme: "memory", Path: "/" + strings.TrimPrefix(objectKey, "/")}).String()
+}
+
+func (s *MemoryStorage) record(operation string, objectKey string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, Call{Operation: operation, ObjectKey: objectKey, Err: err, Time: time.Now()})
+}
+
+// applyFaults sleeps for the injected latency and returns the first injected error
+func (s *MemoryStorage) applyFaults(ctx context.Context, operation string, objectKey string) error {
+	var delay time.Duration
+	var err error
+
+	s.mu.Lock()
+	for _, f := range s.faults {
+		if len(f.Operation) > 0 && f.Operation != operation {
+			continue
+		}
+
+		if !strings.HasPrefix(objectKey, f.KeyPrefix) {
+			continue
+		}
+
+		f.matched++
+		if f.Nth > 0 && f.matched != f.Nth {
+			continue
+		}
+
+		delay += f.Delay
+		if err == nil {
+			err = f.Err
+		}
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return mapError(ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	return mapError(err)
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hungdv136/gokit/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, err := NewStorage(ctx, TypeMemory, MemoryConfig{})
+	require.NoError(t, err)
+
+	objectKey := uuid.NewString()
+	content := []byte(util.RandomString(64, util.AlphaNumericCharacters))
+
+	_, err = s.UploadFile(ctx, objectKey, bytes.NewReader(content))
+	require.NoError(t, err)
+
+	download, err := s.DownloadFile(ctx, objectKey)
+	require.NoError(t, err)
+	downloadContent, err := io.ReadAll(download)
+	require.NoError(t, err)
+	require.NoError(t, download.Close())
+	require.Equal(t, content, downloadContent)
+
+	existed, err := s.Exist(ctx, objectKey)
+	require.NoError(t, err)
+	require.True(t, existed)
+
+	u, err := s.GetURL(ctx, objectKey)
+	require.NoError(t, err)
+	require.Equal(t, "memory:///"+objectKey, u)
+
+	upload, err := s.GetUploadURL(ctx, objectKey, WithRequiredContentType("text/plain"))
+	require.NoError(t, err)
+	require.Equal(t, "memory:///"+objectKey, upload.URL)
+	require.Equal(t, "text/plain", upload.Headers.Get("Content-Type"))
+
+	require.NoError(t, s.DeleteFile(ctx, objectKey))
+
+	existed, err = s.Exist(ctx, objectKey)
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	_, err = s.DownloadFile(ctx, objectKey)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStorage_Stat(t *testing.T) {
+	t.Parallel()
+
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	objectKey := "reports/" + uuid.NewString() + ".json"
+	_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"a":1}`)),
+		WithContentDisposition(`attachment; filename="report.json"`),
+		WithCacheControl("max-age=60"),
+		WithMetadata(map[string]string{"Owner": "u1"}),
+		WithTags(map[string]string{"class": "report"}),
+	)
+	require.NoError(t, err)
+
+	info, err := s.Stat(ctx, objectKey)
+	require.NoError(t, err)
+	require.Equal(t, objectKey, info.Key)
+	require.Equal(t, int64(7), info.Size)
+	require.NotEmpty(t, info.ETag)
+	require.False(t, info.LastModified.IsZero())
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, `attachment; filename="report.json"`, info.ContentDisposition)
+	require.Equal(t, "max-age=60", info.CacheControl)
+	require.Equal(t, map[string]string{"owner": "u1"}, info.Metadata)
+	require.Equal(t, map[string]string{"class": "report"}, info.Tags)
+
+	_, err = s.Stat(ctx, uuid.NewString())
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStorage_DownloadRange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	_, err := s.UploadFile(ctx, "data.bin", bytes.NewReader([]byte("0123456789")))
+	require.NoError(t, err)
+
+	testDownloadRange(t, s, "data.bin")
+}
+
+func TestMemoryStorage_CopyMove(t *testing.T) {
+	t.Parallel()
+
+	testCopyMove(t, NewMemoryStorage(), "copy/")
+}
+
+func TestMemoryStorage_DeleteManyFaults(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	for _, key := range []string{"a", "b", "locked/c"} {
+		_, err := s.UploadFile(ctx, key, bytes.NewReader([]byte(key)))
+		require.NoError(t, err)
+	}
+
+	errLocked := errors.New("locked")
+	s.InjectFault(Fault{Operation: OpDeleteMany, KeyPrefix: "locked/", Err: errLocked})
+
+	keyErrors, err := s.DeleteMany(ctx, []string{"a", "b", "locked/c"})
+	require.NoError(t, err)
+	require.Len(t, keyErrors, 1)
+	require.ErrorIs(t, keyErrors["locked/c"], errLocked)
+	require.Len(t, s.Calls(OpDeleteMany), 3)
+
+	objects, err := ListAll(ctx, s, "")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+}
+
+func TestMemoryStorage_Faults(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	errUpload := errors.New("upload failed")
+	errExist := errors.New("exist failed")
+
+	s := NewMemoryStorage()
+	s.InjectFault(Fault{Operation: OpUploadFile, Nth: 3, Err: errUpload})
+	s.InjectFault(Fault{Operation: OpExist, KeyPrefix: "broken/", Err: errExist})
+
+	for i := 1; i <= 4; i++ {
+		_, err := s.UploadFile(ctx, uuid.NewString(), bytes.NewReader([]byte("data")))
+		if i == 3 {
+			require.ErrorIs(t, err, errUpload)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+
+	_, err := s.Exist(ctx, "broken/"+uuid.NewString())
+	require.ErrorIs(t, err, errExist)
+
+	_, err = s.Exist(ctx, "ok/"+uuid.NewString())
+	require.NoError(t, err)
+
+	uploads := s.Calls(OpUploadFile)
+	require.Len(t, uploads, 4)
+	require.ErrorIs(t, uploads[2].Err, errUpload)
+	require.Len(t, s.Calls(OpExist), 2)
+	require.Len(t, s.Calls(), 6)
+
+	s.ClearFaults()
+	s.ResetCalls()
+
+	_, err = s.Exist(ctx, "broken/"+uuid.NewString())
+	require.NoError(t, err)
+	require.Len(t, s.Calls(), 1)
+}
+
+func TestMemoryStorage_Delay(t *testing.T) {
+	t.Parallel()
+
+	s := NewMemoryStorage()
+	s.InjectFault(Fault{Operation: OpGetURL, Delay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := s.GetURL(ctx, uuid.NewString())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMemoryStorage_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	errs := make([]error, 20)
+	wg := sync.WaitGroup{}
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			objectKey := uuid.NewString()
+			_, errs[i] = s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(objectKey)))
+		}(i)
+	}
+
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, s.Calls(OpUploadFile), 20)
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hungdv136/gokit/logger"
+)
+
+// ErrReplicationFailed is returned by writes of a synchronous mirror if a secondary is not updated
+// The primary has been written, a later write or Reconcile updates the secondary
+var ErrReplicationFailed = errors.New("replication failed")
+
+// MirrorOption modifies a mirror
+type MirrorOption func(*MirrorStorage)
+
+// WithAsyncReplication replicates writes in the background with workers and a queue of queueSize keys
+// Writes block when the queue is full. Call Close to finish queued replications
+func WithAsyncReplication(workers int, queueSize int) MirrorOption {
+	return func(s *MirrorStorage) {
+		s.workers = max(workers, 1)
+		s.queue = make(chan replication, max(queueSize, 0))
+	}
+}
+
+// MirrorStorage writes to a primary storage and replicates the written keys to secondary storages
+// Keys are replicated by copying their current state from the primary, or deleting them if they do not exist anymore
+// Reads go to the primary and fall back to secondaries in order if the primary fails. Not-found is not a failure
+// Objects uploaded with presigned URLs are not replicated until Reconcile is called
+type MirrorStorage struct {
+	primary     Storage
+	secondaries []Storage
+	workers     int
+	queue       chan replication
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type replication struct {
+	ctx  context.Context
+	keys []string
+}
+
+// ReconcileResult reports the keys copied to secondaries by Reconcile and the keys which could not be copied
+type ReconcileResult struct {
+	Copied int
+	Errors map[string]error
+}
+
+// NewMirrorStorage creates a mirror. Replication is synchronous unless WithAsyncReplication is set
+func NewMirrorStorage(primary Storage, secondaries []Storage, options ...MirrorOption) *MirrorStorage {
+	s := &MirrorStorage{primary: primary, secondaries: secondaries}
+	for _, option := range options {
+		option(s)
+	}
+
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	return s
+}
+
+// Close waits for queued replications of an asynchronous mirror. Writes after Close are not replicated
+func (s *MirrorStorage) Close() {
+	s.mu.Lock()
+	if s.closed || s.queue == nil {
+		s.closed = true
+		s.mu.Unlock()
+		return
+	}
+
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// UploadFile uploads to the primary then replicates the key
+// The result of the primary is returned with ErrReplicationFailed if a synchronous replication fails
+func (s *MirrorStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	result, err := s.primary.UploadFile(ctx, objectKey, reader, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, s.replicate(ctx, objectKey)
+}
+
+// DownloadFile downloads from the primary or a secondary if the primary fails
+func (s *MirrorStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	return readWithFallback(ctx, s, objectKey, func(b Storage) (*DownloadResult, error) {
+		return b.DownloadFile(ctx, objectKey, options...)
+	})
+}
+
+// DownloadRange downloads a range from the primary or a secondary if the primary fails
+func (s *MirrorStorage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error) {
+	return readWithFallback(ctx, s, objectKey, func(b Storage) (io.ReadCloser, error) {
+		return b.DownloadRange(ctx, objectKey, offset, length)
+	})
+}
+
+// DeleteFile deletes from the primary then replicates the deletion
+func (s *MirrorStorage) DeleteFile(ctx context.Context, objectKey string) error {
+	if err := s.primary.DeleteFile(ctx, objectKey); err != nil {
+		return err
+	}
+
+	return s.replicate(ctx, objectKey)
+}
+
+// DeleteMany deletes from the primary then replicates the deleted keys
+func (s *MirrorStorage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	keyErrors, err := s.primary.DeleteMany(ctx, objectKeys)
+	if err != nil {
+		return keyErrors, err
+	}
+
+	deleted := make([]string, 0, len(objectKeys))
+	for _, objectKey := range objectKeys {
+		if _, failed := keyErrors[objectKey]; !failed {
+			deleted = append(deleted, objectKey)
+		}
+	}
+
+	return keyErrors, s.replicate(ctx, deleted...)
+}
+
+// Copy copies within the primary then replicates the destination key
+func (s *MirrorStorage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	if err := s.primary.Copy(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	return s.replicate(ctx, dstKey)
+}
+
+// Move moves within the primary then replicates both keys
+func (s *MirrorStorage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	if err := s.primary.Move(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	return s.replicate(ctx, dstKey, srcKey)
+}
+
+// GetURL returns the URL from the primary or a secondary if the primary fails
+func (s *MirrorStorage) GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error) {
+	return readWithFallback(ctx, s, objectKey, func(b Storage) (string, error) {
+		return b.GetURL(ctx, objectKey, options...)
+	})
+}
+
+// GetUploadURL returns the upload URL of the primary. The uploaded object is replicated by Reconcile
+func (s *MirrorStorage) GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (*PresignedRequest, error) {
+	return s.primary.GetUploadURL(ctx, objectKey, options...)
+}
+
+// Exist checks the primary or a secondary if the primary fails
+func (s *MirrorStorage) Exist(ctx context.Context, objectKey string) (bool, error) {
+	return readWithFallback(ctx, s, objectKey, func(b Storage) (bool, error) {
+		return b.Exist(ctx, objectKey)
+	})
+}
+
+// List lists the primary or a secondary if the primary fails
+// Cursors of different backends are not compatible, a failure in the middle of a listing may fail the next pages
+func (s *MirrorStorage) List(ctx context.Context, prefix string, cursor string) (*ListResult, error) {
+	return readWithFallback(ctx, s, prefix, func(b Storage) (*ListResult, error) {
+		return b.List(ctx, prefix, cursor)
+	})
+}
+
+// Stat returns attributes from the primary or a secondary if the primary fails
+func (s *MirrorStorage) Stat(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	return readWithFallback(ctx, s, objectKey, func(b Storage) (*ObjectInfo, error) {
+		return b.Stat(ctx, objectKey)
+	})
+}
+
+// Reconcile copies objects under the prefix which are missing in a secondary or have a different size
+// Keys of each secondary are listed in memory. Objects which only exist in a secondary are kept
+func (s *MirrorStorage) Reconcile(ctx context.Context, prefix string) (*ReconcileResult, error) {
+	result := &ReconcileResult{Errors: map[string]error{}}
+	for _, secondary := range s.secondaries {
+		objects, err := ListAll(ctx, secondary, prefix)
+		if err != nil {
+			return result, err
+		}
+
+		sizes := make(map[string]int64, len(objects))
+		for _, obj := range objects {
+			sizes[obj.Key] = obj.Size
+		}
+
+		it := NewObjectIterator(s.primary, prefix)
+		for it.Next(ctx) {
+			obj := it.Object()
+			if size, ok := sizes[obj.Key]; ok && size == obj.Size {
+				continue
+			}
+
+			if err := CopyBetween(ctx, s.primary, obj.Key, secondary, obj.Key); err != nil {
+				result.Errors[obj.Key] = err
+				continue
+			}
+
+			result.Copied++
+		}
+
+		if err := it.Err(); err != nil {
+			return result, err
+		}
+	}
+
+	if result.Copied > 0 || len(result.Errors) > 0 {
+		logger.Fields(ctx, "prefix", prefix, "copied", result.Copied, "failed", len(result.Errors)).Info(ctx, "reconciled mirror")
+	}
+
+	return result, nil
+}
+
+// replicate replicates the keys now or queues them for an asynchronous mirror
+func (s *MirrorStorage) replicate(ctx context.Context, objectKeys ...string) error {
+	if len(objectKeys) == 0 || len(s.secondaries) == 0 {
+		return nil
+	}
+
+	if s.queue == nil {
+		return s.replicateKeys(ctx, objectKeys)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		logger.Warn(ctx, fmt.Sprintf("mirror is closed, %q are not replicated", objectKeys))
+		return nil
+	}
+
+	// The replication outlives the request but keeps its values, e.g. the request ID
+	s.queue <- replication{ctx: context.WithoutCancel(ctx), keys: objectKeys}
+	return nil
+}
+
+func (s *MirrorStorage) work() {
+	defer s.wg.Done()
+	for r := range s.queue {
+		_ = s.replicateKeys(r.ctx, r.keys)
+	}
+}
+
+// replicateKeys copies the keys from the primary to every secondary, or deletes them if they do not exist in the primary
+func (s *MirrorStorage) replicateKeys(ctx context.Context, objectKeys []string) error {
+	var errs []error
+	for i, secondary := range s.secondaries {
+		for _, objectKey := range objectKeys {
+			err := CopyBetween(ctx, s.primary, objectKey, secondary, objectKey)
+			if errors.Is(err, ErrNotFound) {
+				err = secondary.DeleteFile(ctx, objectKey)
+			}
+
+			if err != nil {
+				err = fmt.Errorf("%w: %q to secondary %d, %w", ErrReplicationFailed, objectKey, i, err)
+				logger.Error(ctx, err)
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// readWithFallback reads from the primary then from secondaries in order while the read fails
+// Not-found and invalid ranges are results of the primary, they are not failures
+func readWithFallback[T any](ctx context.Context, s *MirrorStorage, objectKey string, read func(Storage) (T, error)) (T, error) {
+	result, err := read(s.primary)
+	for i := 0; i < len(s.secondaries) && isFallbackError(err); i++ {
+		logger.Warn(ctx, fmt.Sprintf("primary failed to read %q, reading secondary %d, %v", objectKey, i, err))
+		var secondaryErr error
+		if result, secondaryErr = read(s.secondaries[i]); secondaryErr == nil {
+			return result, nil
+		}
+
+		if !isFallbackError(secondaryErr) {
+			err = secondaryErr
+		}
+	}
+
+	return result, err
+}
+
+func isFallbackError(err error) bool {
+	return err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrInvalidRange) && !errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorStorage_Sync(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, secondary1, secondary2 := NewMemoryStorage(), NewMemoryStorage(), NewMemoryStorage()
+	s := NewMirrorStorage(primary, []Storage{secondary1, secondary2})
+	defer s.Close()
+
+	_, err := s.UploadFile(ctx, "a.json", bytes.NewReader([]byte(`{"a":1}`)), WithMetadata(map[string]string{"owner": "u1"}))
+	require.NoError(t, err)
+	for _, secondary := range []Storage{secondary1, secondary2} {
+		require.Equal(t, `{"a":1}`, string(readAll(t, secondary, "a.json")))
+		info, err := secondary.Stat(ctx, "a.json")
+		require.NoError(t, err)
+		require.Equal(t, "u1", info.Metadata["owner"])
+	}
+
+	require.NoError(t, s.Copy(ctx, "a.json", "b.json"))
+	require.NoError(t, s.Move(ctx, "b.json", "c.json"))
+	require.Equal(t, `{"a":1}`, string(readAll(t, secondary2, "c.json")))
+	existed, err := secondary2.Exist(ctx, "b.json")
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	keyErrors, err := s.DeleteMany(ctx, []string{"a.json", "c.json"})
+	require.NoError(t, err)
+	require.Empty(t, keyErrors)
+	objects, err := ListAll(ctx, secondary1, "")
+	require.NoError(t, err)
+	require.Empty(t, objects)
+
+	// The primary is written even if a secondary fails
+	errDown := errors.New("secondary is down")
+	secondary2.InjectFault(Fault{Operation: OpUploadFile, Err: errDown})
+	result, err := s.UploadFile(ctx, "d.json", bytes.NewReader([]byte(`{}`)))
+	require.ErrorIs(t, err, ErrReplicationFailed)
+	require.ErrorIs(t, err, errDown)
+	require.NotNil(t, result)
+	require.Equal(t, `{}`, string(readAll(t, primary, "d.json")))
+	require.Equal(t, `{}`, string(readAll(t, secondary1, "d.json")))
+}
+
+func TestMirrorStorage_ReadFallback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, secondary := NewMemoryStorage(), NewMemoryStorage()
+	s := NewMirrorStorage(primary, []Storage{secondary})
+	_, err := s.UploadFile(ctx, "a.txt", bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+
+	errDown := errors.New("primary is down")
+	primary.InjectFault(Fault{Err: errDown})
+	require.Equal(t, "hello", string(readAll(t, s, "a.txt")))
+	info, err := s.Stat(ctx, "a.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), info.Size)
+
+	secondary.InjectFault(Fault{Err: errDown})
+	_, err = s.Exist(ctx, "a.txt")
+	require.ErrorIs(t, err, errDown)
+
+	// Not-found of the primary is not a failure
+	primary.ClearFaults()
+	secondary.ClearFaults()
+	require.NoError(t, secondary.DeleteFile(ctx, "a.txt"))
+	_, err = secondary.UploadFile(ctx, "b.txt", bytes.NewReader([]byte("b")))
+	require.NoError(t, err)
+	_, err = s.Stat(ctx, "b.txt")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMirrorStorage_Async(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, secondary := NewMemoryStorage(), NewMemoryStorage()
+	s := NewMirrorStorage(primary, []Storage{secondary}, WithAsyncReplication(2, 1))
+
+	for _, objectKey := range []string{"a.txt", "b.txt", "c.txt"} {
+		_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(objectKey)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.DeleteFile(ctx, "b.txt"))
+
+	s.Close()
+	require.Equal(t, "a.txt", string(readAll(t, secondary, "a.txt")))
+	require.Equal(t, "c.txt", string(readAll(t, secondary, "c.txt")))
+	existed, err := secondary.Exist(ctx, "b.txt")
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	_, err = s.UploadFile(ctx, "d.txt", bytes.NewReader([]byte("d")))
+	require.NoError(t, err)
+	s.Close()
+}
+
+func TestMirrorStorage_Reconcile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, secondary := NewMemoryStorage(), NewMemoryStorage()
+	s := NewMirrorStorage(primary, []Storage{secondary})
+
+	_, err := primary.UploadFile(ctx, "data/a.txt", bytes.NewReader([]byte("a")))
+	require.NoError(t, err)
+	_, err = primary.UploadFile(ctx, "data/b.txt", bytes.NewReader([]byte("bb")))
+	require.NoError(t, err)
+	_, err = secondary.UploadFile(ctx, "data/b.txt", bytes.NewReader([]byte("b")))
+	require.NoError(t, err)
+	_, err = secondary.UploadFile(ctx, "data/extra.txt", bytes.NewReader([]byte("extra")))
+	require.NoError(t, err)
+
+	result, err := s.Reconcile(ctx, "data/")
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Copied)
+	require.Empty(t, result.Errors)
+	require.Equal(t, "a", string(readAll(t, secondary, "data/a.txt")))
+	require.Equal(t, "bb", string(readAll(t, secondary, "data/b.txt")))
+	require.Equal(t, "extra", string(readAll(t, secondary, "data/extra.txt")))
+
+	result, err = s.Reconcile(ctx, "data/")
+	require.NoError(t, err)
+	require.Zero(t, result.Copied)
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength is the maximum number of bytes used by http.DetectContentType
+const sniffLength = 512
+
+// UploadOptions defines optional attributes of an uploaded object
+type UploadOptions struct {
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+
+	// Algorithms of checksums computed while uploading. Default: MD5 and SHA256
+	Checksums []ChecksumAlgorithm `json:"-"`
+
+	// Conditions of the write, unquoted ETags or "*". Writes which do not satisfy them fail with ErrPreconditionFailed
+	IfMatch     string `json:"-"`
+	IfNoneMatch string `json:"-"`
+
+	Progress ProgressFunc `json:"-"`
+}
+
+// DownloadOptions defines options of downloads
+type DownloadOptions struct {
+	VerifyChecksum bool
+}
+
+// DownloadOption modifies download options
+type DownloadOption func(*DownloadOptions)
+
+// UploadOption modifies upload options
+type UploadOption func(*UploadOptions)
+
+// WithContentType sets Content-Type. It is sniffed from the content if not set
+func WithContentType(contentType string) UploadOption {
+	return func(o *UploadOptions) {
+		o.ContentType = contentType
+	}
+}
+
+// WithContentDisposition sets Content-Disposition
+func WithContentDisposition(contentDisposition string) UploadOption {
+	return func(o *UploadOptions) {
+		o.ContentDisposition = contentDisposition
+	}
+}
+
+// WithCacheControl sets Cache-Control
+func WithCacheControl(cacheControl string) UploadOption {
+	return func(o *UploadOptions) {
+		o.CacheControl = cacheControl
+	}
+}
+
+// WithContentEncoding sets Content-Encoding
+func WithContentEncoding(contentEncoding string) UploadOption {
+	return func(o *UploadOptions) {
+		o.ContentEncoding = contentEncoding
+	}
+}
+
+// WithMetadata adds user metadata. Keys are case-insensitive and stored in lower case
+func WithMetadata(metadata map[string]string) UploadOption {
+	return func(o *UploadOptions) {
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string, len(metadata))
+		}
+
+		for k, v := range metadata {
+			o.Metadata[strings.ToLower(k)] = v
+		}
+	}
+}
+
+// WithTags adds object tags
+func WithTags(tags map[string]string) UploadOption {
+	return func(o *UploadOptions) {
+		if o.Tags == nil {
+			o.Tags = make(map[string]string, len(tags))
+		}
+
+		for k, v := range tags {
+			o.Tags[k] = v
+		}
+	}
+}
+
+// WithChecksums sets algorithms of checksums computed while uploading
+// S3 validates SHA256 and CRC32C checksums of single-part uploads, parts are always validated with MD5
+func WithChecksums(algorithms ...ChecksumAlgorithm) UploadOption {
+	return func(o *UploadOptions) {
+		o.Checksums = algorithms
+	}
+}
+
+// WithIfMatch writes only if the current ETag of the object matches, e.g. it has not changed since it was read
+func WithIfMatch(etag string) UploadOption {
+	return func(o *UploadOptions) {
+		o.IfMatch = strings.Trim(etag, `"`)
+	}
+}
+
+// WithIfNoneMatch writes only if the current ETag of the object does not match
+// "*" writes only if the object does not exist. S3 supports only "*"
+func WithIfNoneMatch(etag string) UploadOption {
+	return func(o *UploadOptions) {
+		o.IfNoneMatch = strings.Trim(etag, `"`)
+	}
+}
+
+// WithChecksumVerification verifies the content against the checksum stored at upload
+// Read returns a *ChecksumError at the end of the content if it does not match
+func WithChecksumVerification() DownloadOption {
+	return func(o *DownloadOptions) {
+		o.VerifyChecksum = true
+	}
+}
+
+func newUploadOptions(options []UploadOption) *UploadOptions {
+	o := &UploadOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	return o
+}
+
+func newDownloadOptions(options []DownloadOption) *DownloadOptions {
+	o := &DownloadOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	return o
+}
+
+func (o *UploadOptions) hasConditions() bool {
+	return len(o.IfMatch) > 0 || len(o.IfNoneMatch) > 0
+}
+
+// checkConditions checks conditions of the write against the current ETag of the object
+func (o *UploadOptions) checkConditions(objectKey string, exists bool, etag string) error {
+	if len(o.IfMatch) > 0 && (!exists || (o.IfMatch != "*" && o.IfMatch != etag)) {
+		return fmt.Errorf("%w: ETag of %q does not match %q", ErrPreconditionFailed, objectKey, o.IfMatch)
+	}
+
+	if len(o.IfNoneMatch) > 0 && exists && (o.IfNoneMatch == "*" || o.IfNoneMatch == etag) {
+		return fmt.Errorf("%w: ETag of %q matches %q", ErrPreconditionFailed, objectKey, o.IfNoneMatch)
+	}
+
+	return nil
+}
+
+// applyTo copies the stored options to the object info
+func (o *UploadOptions) applyTo(info *ObjectInfo) {
+	info.ContentType = o.ContentType
+	info.ContentDisposition = o.ContentDisposition
+	info.CacheControl = o.CacheControl
+	info.ContentEncoding = o.ContentEncoding
+	info.Metadata = o.Metadata
+	info.Tags = o.Tags
+}
+
+// detectContentType sets ContentType if it is empty
+// The returned reader must be used instead of the input reader since the first bytes are consumed
+func (o *UploadOptions) detectContentType(objectKey string, reader io.Reader) (io.Reader, error) {
+	if len(o.ContentType) > 0 {
+		return reader, nil
+	}
+
+	buf := make([]byte, sniffLength)
+	n, err := io.ReadFull(reader, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	buf = buf[:n]
+	o.ContentType = detectContentType(objectKey, buf)
+	return io.MultiReader(bytes.NewReader(buf), reader), nil
+}
+
+// detectContentType sniffs the content type from the first bytes
+// The file extension is preferred if sniffing returns a generic type
+func detectContentType(objectKey string, head []byte) string {
+	contentType := http.DetectContentType(head)
+	if !strings.HasPrefix(contentType, "application/octet-stream") && !strings.HasPrefix(contentType, "text/plain") {
+		return contentType
+	}
+
+	if byExt := mime.TypeByExtension(filepath.Ext(objectKey)); len(byExt) > 0 {
+		return byExt
+	}
+
+	return contentType
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadOptions_DetectContentType(t *testing.T) {
+	t.Parallel()
+
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A" + "rest of image")
+	testCases := []struct {
+		Name     string
+		Key      string
+		Content  []byte
+		Options  []UploadOption
+		Expected string
+	}{
+		{"sniff_png", "avatar", png, nil, "image/png"},
+		{"sniff_over_extension", "avatar.csv", png, nil, "image/png"},
+		{"extension_for_text", "state.json", []byte(`{"a":1}`), nil, "application/json"},
+		{"text_without_extension", "notes", []byte("hello"), nil, "text/plain; charset=utf-8"},
+		{"empty", "empty", []byte{}, nil, "text/plain; charset=utf-8"},
+		{"provided", "avatar", png, []UploadOption{WithContentType("image/x-custom")}, "image/x-custom"},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := newUploadOptions(tc.Options)
+			reader, err := opts.detectContentType(tc.Key, bytes.NewReader(tc.Content))
+			require.NoError(t, err)
+			require.Equal(t, tc.Expected, opts.ContentType)
+
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, tc.Content, content)
+		})
+	}
+}
+
+func TestUploadOptions_Metadata(t *testing.T) {
+	t.Parallel()
+
+	opts := newUploadOptions([]UploadOption{
+		WithMetadata(map[string]string{"Owner-ID": "1"}),
+		WithMetadata(map[string]string{"source": "mobile"}),
+		WithTags(map[string]string{"class": "temporary"}),
+	})
+
+	require.Equal(t, map[string]string{"owner-id": "1", "source": "mobile"}, opts.Metadata)
+	require.Equal(t, map[string]string{"class": "temporary"}, opts.Tags)
+}
+
+func TestUploadOptions_Conditions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	local, err := newLocalStorage(ctx, LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name    string
+		Storage Storage
+	}{
+		{Name: "memory", Storage: NewMemoryStorage()},
+		{Name: "local", Storage: local},
+		{Name: "encrypted", Storage: newTestEncryptedStorage(t, NewMemoryStorage(), 16)},
+		{Name: "dedup", Storage: NewDedupStorage(NewMemoryStorage(), WithSpoolDir(t.TempDir()))},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			testConditionalUpload(t, tc.Storage, "")
+		})
+	}
+}
+
+func testConditionalUpload(t *testing.T, s Storage, prefix string) {
+	ctx := context.Background()
+	objectKey := prefix + "state.json"
+	created, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"n":0}`)), WithIfNoneMatch("*"))
+	require.NoError(t, err)
+	_, err = s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"n":9}`)), WithIfNoneMatch("*"))
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+
+	reader, err := s.DownloadFile(ctx, objectKey)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, created.ETag, reader.ETag)
+
+	_, err = s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"n":1}`)), WithIfMatch(`"`+reader.ETag+`"`))
+	require.NoError(t, err)
+	_, err = s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"n":2}`)), WithIfMatch(reader.ETag))
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+	require.Equal(t, `{"n":1}`, string(readAll(t, s, objectKey)))
+
+	// Concurrent read-modify-write loops do not lose updates
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, increment(ctx, s, objectKey))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, `{"n":5}`, string(readAll(t, s, objectKey)))
+}
+
+func increment(ctx context.Context, s Storage, objectKey string) error {
+	for {
+		reader, err := s.DownloadFile(ctx, objectKey)
+		if err != nil {
+			return err
+		}
+
+		state := map[string]int{}
+		err = json.NewDecoder(reader).Decode(&state)
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+
+		state["n"]++
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.UploadFile(ctx, objectKey, bytes.NewReader(data), WithIfMatch(reader.ETag))
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+	}
+}
+
+func TestUploadOptions_Progress(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	local, err := newLocalStorage(ctx, LocalConfig{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name    string
+		Storage Storage
+	}{
+		{Name: "memory", Storage: NewMemoryStorage()},
+		{Name: "local", Storage: local},
+		{Name: "encrypted", Storage: newTestEncryptedStorage(t, NewMemoryStorage(), 16)},
+		{Name: "dedup", Storage: NewDedupStorage(NewMemoryStorage(), WithSpoolDir(t.TempDir()))},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := [][2]int64{}
+			content := bytes.Repeat([]byte("a"), 100)
+			_, err := tc.Storage.UploadFile(ctx, "a.txt", bytes.NewReader(content), WithProgress(func(sent, total int64) {
+				calls = append(calls, [2]int64{sent, total})
+			}))
+			require.NoError(t, err)
+			require.NotEmpty(t, calls)
+			require.Equal(t, [2]int64{100, 100}, calls[len(calls)-1])
+
+			calls = calls[:0]
+			_, err = tc.Storage.UploadFile(ctx, "b.txt", io.MultiReader(bytes.NewReader(content)), WithProgress(func(sent, total int64) {
+				calls = append(calls, [2]int64{sent, total})
+			}))
+			require.NoError(t, err)
+			require.Equal(t, [2]int64{100, -1}, calls[len(calls)-1])
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"net/http"
+	"time"
+)
+
+// PresignOptions defines options of presigned URLs and POST policies
+type PresignOptions struct {
+	Expiration    time.Duration // Default: PresignURLExpiration of the config
+	ContentType   string        // Content-Type the uploader must send
+	ContentLength int64         // Exact Content-Length the uploader must send. 0 means no constraint
+
+	// Accepted range of the content length of a POST upload. 0 means no constraint
+	MinContentLength int64
+	MaxContentLength int64
+
+	// Name of an image variant generated by ImageStorage. Empty means the original
+	Variant string
+}
+
+// PresignOption modifies presign options
+type PresignOption func(*PresignOptions)
+
+// PresignedRequest defines an HTTP request which can be sent without credentials
+// Headers must be sent as they are part of the signature
+type PresignedRequest struct {
+	Method    string      `json:"method"`
+	URL       string      `json:"url"`
+	Headers   http.Header `json:"headers"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// PostPolicy defines a signed browser-form upload
+// Fields must be sent as form fields before the file field
+type PostPolicy struct {
+	URL       string            `json:"url"`
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// WithExpiration overrides the expiration of the config
+func WithExpiration(expiration time.Duration) PresignOption {
+	return func(o *PresignOptions) {
+		o.Expiration = expiration
+	}
+}
+
+// WithRequiredContentType requires uploader to send the content type
+func WithRequiredContentType(contentType string) PresignOption {
+	return func(o *PresignOptions) {
+		o.ContentType = contentType
+	}
+}
+
+// WithRequiredContentLength requires uploader to send exactly n bytes
+func WithRequiredContentLength(n int64) PresignOption {
+	return func(o *PresignOptions) {
+		o.ContentLength = n
+	}
+}
+
+// WithContentLengthRange limits the size of a POST upload
+func WithContentLengthRange(min int64, max int64) PresignOption {
+	return func(o *PresignOptions) {
+		o.MinContentLength = min
+		o.MaxContentLength = max
+	}
+}
+
+// WithVariant returns the URL of an image variant generated by ImageStorage instead of the original
+func WithVariant(name string) PresignOption {
+	return func(o *PresignOptions) {
+		o.Variant = name
+	}
+}
+
+func newPresignOptions(defaultExpiration time.Duration, options []PresignOption) *PresignOptions {
+	o := &PresignOptions{Expiration: defaultExpiration}
+	for _, option := range options {
+		option(o)
+	}
+
+	return o
+}
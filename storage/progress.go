@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"io"
+	"sync"
+)
+
+// ProgressFunc reports the bytes sent of an upload. Total is -1 if the size is not known in advance
+// It is called sequentially, possibly from different goroutines
+type ProgressFunc func(sent int64, total int64)
+
+// WithProgress reports the progress of the upload
+// The size is known in advance if the reader implements io.Seeker
+func WithProgress(fn ProgressFunc) UploadOption {
+	return func(o *UploadOptions) {
+		o.Progress = fn
+	}
+}
+
+// progress counts the bytes sent of an upload. A nil progress does nothing
+type progress struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	sent  int64
+	total int64
+}
+
+func newProgress(fn ProgressFunc, total int64) *progress {
+	if fn == nil {
+		return nil
+	}
+
+	return &progress{fn: fn, total: total}
+}
+
+// newReaderProgress reads the remaining size of a seekable reader
+func newReaderProgress(fn ProgressFunc, reader io.Reader) *progress {
+	return newProgress(fn, getRemainingSize(reader))
+}
+
+func (p *progress) add(n int64) {
+	if p == nil || n <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sent += n
+	p.fn(p.sent, p.total)
+}
+
+// wrap reports the bytes read from the reader
+func (p *progress) wrap(reader io.Reader) io.Reader {
+	if p == nil {
+		return reader
+	}
+
+	return io.TeeReader(reader, p)
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.add(int64(len(b)))
+	return len(b), nil
+}
+
+// getRemainingSize returns the size from the current offset to the end, or -1 if the reader is not seekable
+func getRemainingSize(reader io.Reader) int64 {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return -1
+	}
+
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return -1
+	}
+
+	return end - current
+}
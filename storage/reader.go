@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// readCloser combines a reader and the closer of the underlying source
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// ObjectReader implements io.ReadSeekCloser on top of Storage.DownloadRange
+// Ranged downloads are issued lazily on the first Read after a Seek,
+// so seeking does not transfer any data
+type ObjectReader struct {
+	ctx     context.Context
+	storage Storage
+	info    *ObjectInfo
+	offset  int64
+	body    io.ReadCloser
+}
+
+// NewObjectReader creates a reader of an object. The object size is fetched by Stat
+func NewObjectReader(ctx context.Context, s Storage, objectKey string) (*ObjectReader, error) {
+	info, err := s.Stat(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectReader{ctx: ctx, storage: s, info: info}, nil
+}
+
+// Info returns the attributes of the object
+func (r *ObjectReader) Info() *ObjectInfo {
+	return r.info
+}
+
+// Read reads from the current offset
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.info.Size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.storage.DownloadRange(r.ctx, r.info.Key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next Read
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.info.Size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset != r.offset {
+		if err := r.closeBody(); err != nil {
+			return 0, err
+		}
+
+		r.offset = offset
+	}
+
+	return offset, nil
+}
+
+// Close closes the current ranged download
+func (r *ObjectReader) Close() error {
+	return r.closeBody()
+}
+
+func (r *ObjectReader) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// checkRange validates a range as S3 does
+func checkRange(size int64, offset int64, length int64) error {
+	if offset < 0 || offset >= size || length == 0 {
+		return fmt.Errorf("%w: offset %d, length %d, size %d", ErrInvalidRange, offset, length, size)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectReader(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	content := []byte("0123456789abcdefghij")
+	_, err := s.UploadFile(ctx, "data.bin", bytes.NewReader(content))
+	require.NoError(t, err)
+
+	r, err := NewObjectReader(ctx, s, "data.bin")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), r.Info().Size)
+
+	size, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), size)
+
+	pos, err := r.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(15), pos)
+	require.Empty(t, s.Calls(OpDownloadRange))
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content[15:], data)
+
+	_, err = r.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	pos, err = r.Seek(3, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), pos)
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	require.Equal(t, content[5:9], buf)
+	require.Len(t, s.Calls(OpDownloadRange), 2)
+
+	_, err = r.Seek(-1, io.SeekStart)
+	require.Error(t, err)
+	require.NoError(t, r.Close())
+
+	_, err = NewObjectReader(ctx, s, "missing.bin")
+	require.Error(t, err)
+}
+
+// testDownloadRange checks ranges of an object whose content is "0123456789"
+func testDownloadRange(t *testing.T, s Storage, objectKey string) {
+	ctx := context.Background()
+	testCases := []struct {
+		Offset   int64
+		Length   int64
+		Expected string
+	}{
+		{0, 3, "012"},
+		{4, -1, "456789"},
+		{8, 10, "89"},
+		{9, 1, "9"},
+	}
+
+	for _, tc := range testCases {
+		reader, err := s.DownloadRange(ctx, objectKey, tc.Offset, tc.Length)
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, tc.Expected, string(data))
+	}
+
+	_, err := s.DownloadRange(ctx, objectKey, 10, 1)
+	require.ErrorIs(t, err, ErrInvalidRange)
+
+	_, err = s.DownloadRange(ctx, objectKey, -1, 1)
+	require.ErrorIs(t, err, ErrInvalidRange)
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Errors of creating storages
+var (
+	ErrUnknownStorageType = errors.New("unknown storage type")
+	ErrInvalidConfig      = errors.New("invalid storage config")
+)
+
+var errRequired = errors.New("value is required")
+
+// ConfigError describes an invalid field of a storage config. It matches ErrInvalidConfig with errors.Is
+type ConfigError struct {
+	Type  string
+	Field string // Path of the field, e.g. max_keys. Empty if the whole config is invalid
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	if len(e.Field) == 0 {
+		return fmt.Sprintf("invalid config of storage %q: %v", e.Type, e.Err)
+	}
+
+	return fmt.Sprintf("invalid config of storage %q: field %q: %v", e.Type, e.Field, e.Err)
+}
+
+// Is makes errors.Is(err, ErrInvalidConfig) true
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// registration creates a storage of a type from a config of any supported form
+type registration func(ctx context.Context, storageType string, config interface{}) (Storage, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]registration{}
+)
+
+func init() {
+	Register(TypeS3, func(ctx context.Context, config S3Config) (Storage, error) {
+		return newS3Storage(ctx, config)
+	})
+	Register(TypeLocal, func(ctx context.Context, config LocalConfig) (Storage, error) {
+		return newLocalStorage(ctx, config)
+	})
+	Register(TypeMemory, func(_ context.Context, config MemoryConfig) (Storage, error) {
+		return newMemoryStorage(config), nil
+	})
+}
+
+// Register makes a storage type available to NewStorage. Config is the config struct of the type
+// Fields of configs decoded from maps, JSON or YAML are named by their json tags, durations may be strings like 15m
+// Configs which have a Validate() error method are validated before the storage is created
+// It panics if the type is already registered, call it from init functions
+func Register[C any](storageType string, factory func(ctx context.Context, config C) (Storage, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[storageType]; ok {
+		panic(fmt.Sprintf("storage: type %q is already registered", storageType))
+	}
+
+	registry[storageType] = func(ctx context.Context, storageType string, config interface{}) (Storage, error) {
+		var cfg C
+		if err := decodeConfig(config, &cfg); err != nil {
+			return nil, withConfigType(storageType, err)
+		}
+
+		if v, ok := any(&cfg).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return nil, withConfigType(storageType, err)
+			}
+		}
+
+		return factory(ctx, cfg)
+	}
+}
+
+// Types returns the registered storage types
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for storageType := range registry {
+		types = append(types, storageType)
+	}
+
+	sort.Strings(types)
+	return types
+}
+
+// NewStorage creates a storage of a registered type
+// Config is the config struct of the type, a pointer to it, or a map decoded from JSON or YAML
+func NewStorage(ctx context.Context, storageType string, config interface{}) (Storage, error) {
+	registryMu.RLock()
+	create, ok := registry[storageType]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, registered types: %q", ErrUnknownStorageType, storageType, Types())
+	}
+
+	return create(ctx, storageType, config)
+}
+
+// Config is a storage config which can be embedded in application configs, the type and the fields of its config
+//
+//	storage:
+//	  type: s3
+//	  bucket: exports
+//	  region: ap-southeast-1
+//	  presign_url_expiration: 15m
+type Config struct {
+	Type   string
+	Fields map[string]interface{}
+}
+
+// NewStorageFromConfig creates a storage from a config decoded from JSON or YAML
+func NewStorageFromConfig(ctx context.Context, config Config) (Storage, error) {
+	return NewStorage(ctx, config.Type, config.Fields)
+}
+
+// UnmarshalJSON reads the type and keeps the other fields to be decoded by the registered type
+func (c *Config) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	fields := map[string]interface{}{}
+	if err := decoder.Decode(&fields); err != nil {
+		return err
+	}
+
+	return c.setFields(fields)
+}
+
+// UnmarshalYAML reads the type and keeps the other fields to be decoded by the registered type
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	fields := map[string]interface{}{}
+	if err := value.Decode(&fields); err != nil {
+		return err
+	}
+
+	return c.setFields(fields)
+}
+
+func (c *Config) setFields(fields map[string]interface{}) error {
+	storageType, ok := fields["type"].(string)
+	if !ok || len(storageType) == 0 {
+		return &ConfigError{Field: "type", Err: errors.New("a storage type is required")}
+	}
+
+	delete(fields, "type")
+	c.Type = storageType
+	c.Fields = fields
+	return nil
+}
+
+func withConfigType(storageType string, err error) error {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		configErr.Type = storageType
+		return configErr
+	}
+
+	return &ConfigError{Type: storageType, Err: err}
+}
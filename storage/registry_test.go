@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hungdv136/gokit/types"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewStorage_Config(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expected := S3Config{
+		Bucket:               "exports",
+		Region:               "ap-southeast-1",
+		PresignURLExpiration: 15 * time.Minute,
+		MaxKeys:              100,
+		S3ForcePathStyle:     aws.Bool(true),
+		Endpoint:             aws.String("localhost:4566"),
+	}
+
+	yamlConfig := struct {
+		Storage Config `yaml:"storage"`
+	}{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+storage:
+  type: s3
+  bucket: exports
+  region: ap-southeast-1
+  presign_url_expiration: 15m
+  max_keys: 100
+  s3_force_path_style: true
+  endpoint: localhost:4566
+`), &yamlConfig))
+	require.Equal(t, TypeS3, yamlConfig.Storage.Type)
+
+	jsonConfig := Config{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "s3",
+		"bucket": "exports",
+		"region": "ap-southeast-1",
+		"presign_url_expiration": 900000000000,
+		"max_keys": 100,
+		"s3_force_path_style": true,
+		"endpoint": "localhost:4566"
+	}`), &jsonConfig))
+
+	testCases := []struct {
+		Name   string
+		Create func() (Storage, error)
+	}{
+		{Name: "struct", Create: func() (Storage, error) { return NewStorage(ctx, TypeS3, expected) }},
+		{Name: "pointer", Create: func() (Storage, error) { return NewStorage(ctx, TypeS3, &expected) }},
+		{Name: "yaml", Create: func() (Storage, error) { return NewStorageFromConfig(ctx, yamlConfig.Storage) }},
+		{Name: "json", Create: func() (Storage, error) { return NewStorageFromConfig(ctx, jsonConfig) }},
+		{Name: "map", Create: func() (Storage, error) {
+			return NewStorage(ctx, TypeS3, types.Map{
+				"bucket":                 "exports",
+				"region":                 "ap-southeast-1",
+				"presign_url_expiration": "15m",
+				"max_keys":               100.0,
+				"s3_force_path_style":    true,
+				"endpoint":               "localhost:4566",
+			})
+		}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := tc.Create()
+			require.NoError(t, err)
+			s3Storage, ok := s.(*S3Storage)
+			require.True(t, ok)
+			require.Equal(t, expected, s3Storage.config)
+		})
+	}
+}
+
+func TestNewStorage_ConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testCases := []struct {
+		Name    string
+		Type    string
+		Config  interface{}
+		Field   string
+		Message string
+	}{
+		{
+			Name:    "wrong type of field",
+			Type:    TypeS3,
+			Config:  map[string]interface{}{"bucket": "a", "region": "b", "max_keys": "ten"},
+			Field:   "max_keys",
+			Message: `invalid config of storage "s3": field "max_keys": expected an integer, got string`,
+		},
+		{
+			Name:    "unknown field",
+			Type:    TypeS3,
+			Config:  map[string]interface{}{"bukcet": "a", "region": "b"},
+			Field:   "bukcet",
+			Message: `invalid config of storage "s3": field "bukcet": unknown field`,
+		},
+		{
+			Name:    "invalid duration",
+			Type:    TypeLocal,
+			Config:  map[string]interface{}{"root_dir": "/tmp", "presign_url_expiration": "soon"},
+			Field:   "presign_url_expiration",
+			Message: `invalid config of storage "local": field "presign_url_expiration": expected a duration like 15m, got "soon"`,
+		},
+		{
+			Name:    "missing field",
+			Type:    TypeS3,
+			Config:  S3Config{Region: "b"},
+			Field:   "bucket",
+			Message: `invalid config of storage "s3": field "bucket": value is required`,
+		},
+		{
+			Name:    "signing key without base url",
+			Type:    TypeLocal,
+			Config:  LocalConfig{RootDir: "/tmp", SigningKey: "secret"},
+			Field:   "base_url",
+			Message: `invalid config of storage "local": field "base_url": value is required to sign URLs`,
+		},
+		{
+			Name:    "wrong config type",
+			Type:    TypeS3,
+			Config:  LocalConfig{RootDir: "/tmp"},
+			Message: `invalid config of storage "s3": expected storage.S3Config or a map, got storage.LocalConfig`,
+		},
+		{
+			Name:    "nil config",
+			Type:    TypeLocal,
+			Config:  (*LocalConfig)(nil),
+			Message: `invalid config of storage "local": expected storage.LocalConfig, got nil`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewStorage(ctx, tc.Type, tc.Config)
+			require.ErrorIs(t, err, ErrInvalidConfig)
+			require.EqualError(t, err, tc.Message)
+
+			var configErr *ConfigError
+			require.ErrorAs(t, err, &configErr)
+			require.Equal(t, tc.Type, configErr.Type)
+			require.Equal(t, tc.Field, configErr.Field)
+		})
+	}
+
+	_, err := NewStorage(ctx, "gcs", map[string]interface{}{})
+	require.ErrorIs(t, err, ErrUnknownStorageType)
+
+	// Regions may be resolved by the SDK from the environment
+	_, err = NewStorage(ctx, TypeS3, map[string]interface{}{"bucket": "a"})
+	require.NoError(t, err)
+
+	require.Error(t, json.Unmarshal([]byte(`{"bucket": "a"}`), &Config{}))
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	type prefixedConfig struct {
+		Prefix string            `json:"prefix"`
+		Limits map[string]int    `json:"limits"`
+		Tags   []string          `json:"tags"`
+		Extra  map[string]string `json:"extra"`
+	}
+
+	var decoded prefixedConfig
+	Register("test-prefixed", func(_ context.Context, config prefixedConfig) (Storage, error) {
+		decoded = config
+		return NewMemoryStorage(), nil
+	})
+	require.Contains(t, Types(), "test-prefixed")
+	require.Panics(t, func() {
+		Register("test-prefixed", func(_ context.Context, config prefixedConfig) (Storage, error) { return nil, nil })
+	})
+
+	_, err := NewStorage(context.Background(), "test-prefixed", map[string]interface{}{
+		"prefix": "a/",
+		"limits": map[string]interface{}{"files": 10},
+		"tags":   []interface{}{"x", "y"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, prefixedConfig{Prefix: "a/", Limits: map[string]int{"files": 10}, Tags: []string{"x", "y"}}, decoded)
+
+	_, err = NewStorage(context.Background(), "test-prefixed", map[string]interface{}{"limits": map[string]interface{}{"files": 1.5}})
+	require.EqualError(t, err, `invalid config of storage "test-prefixed": field "limits.files": expected an integer, got number 1.5`)
+}
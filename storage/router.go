@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hungdv136/gokit/logger"
+)
+
+// ErrInvalidCursor is returned by RouterStorage.List if the cursor is not returned by a previous page
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// RouterOption adds a route to a router
+type RouterOption func(*RouterStorage)
+
+// WithPrefixRoute routes keys which have the prefix to the storage
+func WithPrefixRoute(prefix string, s Storage) RouterOption {
+	return func(r *RouterStorage) {
+		r.routes = append(r.routes, &route{prefix: prefix, storage: s})
+	}
+}
+
+// WithRoute routes keys which match the rule to the storage
+// Keys of every listed prefix are listed from the storage then filtered by the rule
+func WithRoute(match func(objectKey string) bool, s Storage) RouterOption {
+	return func(r *RouterStorage) {
+		r.routes = append(r.routes, &route{match: match, storage: s})
+	}
+}
+
+// RouterStorage routes keys to backends, e.g. avatars/ to a public bucket and exports/ to a private one
+// Routes are matched in the order they are added, keys which match no route go to the fallback storage
+// Keys are not rewritten, a backend stores the full key
+//
+//	s := storage.NewRouterStorage(defaultStorage,
+//		storage.WithPrefixRoute("avatars/", avatarStorage),
+//		storage.WithPrefixRoute("exports/", exportStorage),
+//	)
+type RouterStorage struct {
+	routes   []*route
+	fallback Storage
+}
+
+type route struct {
+	prefix  string
+	match   func(objectKey string) bool
+	storage Storage
+}
+
+// NewRouterStorage creates a router. Keys which match no route go to the fallback storage
+func NewRouterStorage(fallback Storage, options ...RouterOption) *RouterStorage {
+	r := &RouterStorage{fallback: fallback}
+	for _, option := range options {
+		option(r)
+	}
+
+	return r
+}
+
+// Route returns the storage of the key
+func (r *RouterStorage) Route(objectKey string) Storage {
+	for _, rt := range r.routes {
+		if rt.matches(objectKey) {
+			return rt.storage
+		}
+	}
+
+	return r.fallback
+}
+
+// UploadFile uploads to the storage of the key
+func (r *RouterStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	return r.Route(objectKey).UploadFile(ctx, objectKey, reader, options...)
+}
+
+// DownloadFile downloads from the storage of the key
+func (r *RouterStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	return r.Route(objectKey).DownloadFile(ctx, objectKey, options...)
+}
+
+// DownloadRange downloads a range from the storage of the key
+func (r *RouterStorage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error) {
+	return r.Route(objectKey).DownloadRange(ctx, objectKey, offset, length)
+}
+
+// DeleteFile deletes from the storage of the key
+func (r *RouterStorage) DeleteFile(ctx context.Context, objectKey string) error {
+	return r.Route(objectKey).DeleteFile(ctx, objectKey)
+}
+
+// DeleteMany groups keys by storage and deletes them with a batch of each storage
+func (r *RouterStorage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	groups := map[Storage][]string{}
+	for _, objectKey := range objectKeys {
+		s := r.Route(objectKey)
+		groups[s] = append(groups[s], objectKey)
+	}
+
+	keyErrors := map[string]error{}
+	for s, keys := range groups {
+		errs, err := s.DeleteMany(ctx, keys)
+		if err != nil {
+			return keyErrors, err
+		}
+
+		for objectKey, keyErr := range errs {
+			keyErrors[objectKey] = keyErr
+		}
+	}
+
+	return keyErrors, nil
+}
+
+// Copy copies within a storage, or between storages if the keys are routed to different storages
+func (r *RouterStorage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	src, dst := r.Route(srcKey), r.Route(dstKey)
+	if src == dst {
+		return src.Copy(ctx, srcKey, dstKey)
+	}
+
+	return CopyBetween(ctx, src, srcKey, dst, dstKey)
+}
+
+// Move moves within a storage, or between storages if the keys are routed to different storages
+func (r *RouterStorage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	src, dst := r.Route(srcKey), r.Route(dstKey)
+	if src == dst {
+		return src.Move(ctx, srcKey, dstKey)
+	}
+
+	return MoveBetween(ctx, src, srcKey, dst, dstKey)
+}
+
+// GetURL returns the URL from the storage of the key
+func (r *RouterStorage) GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error) {
+	return r.Route(objectKey).GetURL(ctx, objectKey, options...)
+}
+
+// GetUploadURL returns the upload URL from the storage of the key
+func (r *RouterStorage) GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (*PresignedRequest, error) {
+	return r.Route(objectKey).GetUploadURL(ctx, objectKey, options...)
+}
+
+// Exist checks the storage of the key
+func (r *RouterStorage) Exist(ctx context.Context, objectKey string) (bool, error) {
+	return r.Route(objectKey).Exist(ctx, objectKey)
+}
+
+// Stat returns attributes from the storage of the key
+func (r *RouterStorage) Stat(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	return r.Route(objectKey).Stat(ctx, objectKey)
+}
+
+// List lists every storage which may have keys with the prefix, one after another
+// Objects are sorted within a storage only. Objects of a storage which are routed elsewhere are skipped
+// The cursor is the index of the storage followed by its own cursor
+func (r *RouterStorage) List(ctx context.Context, prefix string, cursor string) (*ListResult, error) {
+	backends := r.getListBackends(prefix)
+	index, backendCursor := 0, ""
+	if len(cursor) > 0 {
+		i, c, ok := strings.Cut(cursor, ":")
+		n, err := strconv.Atoi(i)
+		if !ok || err != nil || n < 0 || n >= len(backends) {
+			err := fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+			logger.Error(ctx, err)
+			return nil, err
+		}
+
+		index, backendCursor = n, c
+	}
+
+	s := backends[index]
+	page, err := s.List(ctx, prefix, backendCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ListResult{Objects: make([]*ObjectInfo, 0, len(page.Objects))}
+	for _, obj := range page.Objects {
+		if r.Route(obj.Key) == s {
+			result.Objects = append(result.Objects, obj)
+		}
+	}
+
+	switch {
+	case len(page.NextCursor) > 0:
+		result.NextCursor = fmt.Sprintf("%d:%s", index, page.NextCursor)
+	case index+1 < len(backends):
+		result.NextCursor = fmt.Sprintf("%d:", index+1)
+	}
+
+	return result, nil
+}
+
+// getListBackends returns distinct storages which may have keys with the prefix
+// The fallback is skipped if the prefix is covered by a prefix route
+func (r *RouterStorage) getListBackends(prefix string) []Storage {
+	backends := []Storage{}
+	add := func(s Storage) {
+		for _, b := range backends {
+			if b == s {
+				return
+			}
+		}
+
+		backends = append(backends, s)
+	}
+
+	for _, rt := range r.routes {
+		if rt.match == nil && strings.HasPrefix(prefix, rt.prefix) {
+			add(rt.storage)
+			return backends
+		}
+
+		if rt.match != nil || strings.HasPrefix(rt.prefix, prefix) {
+			add(rt.storage)
+		}
+	}
+
+	add(r.fallback)
+	return backends
+}
+
+func (rt *route) matches(objectKey string) bool {
+	if rt.match != nil {
+		return rt.match(objectKey)
+	}
+
+	return strings.HasPrefix(objectKey, rt.prefix)
+}
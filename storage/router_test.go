@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	avatars := newMemoryStorage(MemoryConfig{MaxKeys: 1})
+	reports := NewMemoryStorage()
+	fallback := newMemoryStorage(MemoryConfig{MaxKeys: 2})
+	s := NewRouterStorage(fallback,
+		WithPrefixRoute("avatars/", avatars),
+		WithRoute(func(objectKey string) bool { return strings.HasSuffix(objectKey, ".csv") }, reports),
+	)
+
+	for _, objectKey := range []string{"avatars/1.png", "avatars/2.png", "exports/a.csv", "exports/b.json", "c.txt"} {
+		_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(objectKey)))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, avatars, s.Route("avatars/1.png"))
+	require.Equal(t, reports, s.Route("avatars.csv"))
+	require.Equal(t, fallback, s.Route("exports/b.json"))
+	require.Equal(t, "avatars/1.png", string(readAll(t, avatars, "avatars/1.png")))
+	require.Equal(t, "exports/a.csv", string(readAll(t, reports, "exports/a.csv")))
+	require.Equal(t, "exports/b.json", string(readAll(t, fallback, "exports/b.json")))
+
+	// Keys stored in a backend which are routed elsewhere are not listed
+	_, err := fallback.UploadFile(ctx, "avatars/stale.png", bytes.NewReader([]byte("stale")))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Prefix   string
+		Expected []string
+	}{
+		{Prefix: "", Expected: []string{"avatars/1.png", "avatars/2.png", "c.txt", "exports/a.csv", "exports/b.json"}},
+		{Prefix: "avatars/", Expected: []string{"avatars/1.png", "avatars/2.png"}},
+		{Prefix: "exports/", Expected: []string{"exports/a.csv", "exports/b.json"}},
+	}
+
+	for _, tc := range testCases {
+		objects, err := ListAll(ctx, s, tc.Prefix)
+		require.NoError(t, err)
+		keys := []string{}
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+		sort.Strings(keys)
+		require.Equal(t, tc.Expected, keys, tc.Prefix)
+	}
+
+	require.NoError(t, s.Copy(ctx, "exports/b.json", "avatars/b.json"))
+	require.Equal(t, "exports/b.json", string(readAll(t, avatars, "avatars/b.json")))
+	require.NoError(t, s.Move(ctx, "avatars/b.json", "avatars/moved.json"))
+	require.NoError(t, s.Move(ctx, "c.txt", "exports/c.csv"))
+	require.Equal(t, "c.txt", string(readAll(t, reports, "exports/c.csv")))
+	existed, err := fallback.Exist(ctx, "c.txt")
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	keyErrors, err := s.DeleteMany(ctx, []string{"avatars/1.png", "exports/a.csv", "exports/b.json"})
+	require.NoError(t, err)
+	require.Empty(t, keyErrors)
+	require.Len(t, avatars.Calls(OpDeleteMany), 1)
+	require.Len(t, reports.Calls(OpDeleteMany), 1)
+	require.Len(t, fallback.Calls(OpDeleteMany), 1)
+
+	for _, cursor := range []string{"x", "9:", "-1:"} {
+		_, err = s.List(ctx, "", cursor)
+		require.ErrorIs(t, err, ErrInvalidCursor)
+	}
+}
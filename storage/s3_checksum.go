@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // MD5 is used for integrity as S3 does
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// withChecksumHeaders adds SHA256 and CRC32C checksums of the body to PutObject requests so S3 validates and stores them
+// Parts of multipart uploads are validated with Content-MD5 which is added by the SDK
+func withChecksumHeaders(algorithms []ChecksumAlgorithm) request.Option {
+	headerAlgorithms := []ChecksumAlgorithm{}
+	for _, algorithm := range algorithms {
+		if algorithm == ChecksumSHA256 || algorithm == ChecksumCRC32C {
+			headerAlgorithms = append(headerAlgorithms, algorithm)
+		}
+	}
+
+	if len(algorithms) == 0 {
+		headerAlgorithms = []ChecksumAlgorithm{ChecksumSHA256}
+	}
+
+	return func(r *request.Request) {
+		if r.Operation.Name != "PutObject" || len(headerAlgorithms) == 0 {
+			return
+		}
+
+		r.Handlers.Build.PushBack(func(r *request.Request) {
+			if r.Error != nil || !aws.IsReaderSeekable(r.Body) {
+				return
+			}
+
+			checksums := newChecksummer(headerAlgorithms)
+			if _, err := aws.CopySeekableBody(checksums, r.Body); err != nil {
+				r.Error = awserr.New("BodyHashError", "failed to compute checksums", err)
+				return
+			}
+
+			for algorithm, h := range checksums.hashes {
+				r.HTTPRequest.Header.Set("X-Amz-Checksum-"+strings.ToLower(string(algorithm)), base64.StdEncoding.EncodeToString(h.Sum(nil)))
+			}
+		})
+	}
+}
+
+// newVerifier selects the checksum of a downloaded object
+// ETags of SSE-KMS and SSE-C objects are not MD5 digests. ETags of multipart uploads are verified part by part
+func (s *S3Storage) newVerifier(ctx context.Context, objectKey string, output *s3.GetObjectOutput) (verifier, error) {
+	expected := Checksums{
+		SHA256: decodeS3Checksum(aws.StringValue(output.ChecksumSHA256)),
+		CRC32C: decodeS3Checksum(aws.StringValue(output.ChecksumCRC32C)),
+	}
+
+	etag := strings.Trim(aws.StringValue(output.ETag), `"`)
+	encrypted := strings.HasPrefix(aws.StringValue(output.ServerSideEncryption), s3.ServerSideEncryptionAwsKms) || output.SSECustomerAlgorithm != nil
+	if !encrypted && len(etag) == 2*md5.Size {
+		expected.MD5 = etag
+	}
+
+	parts := 0
+	if i := strings.LastIndex(etag, "-"); i > 0 {
+		parts, _ = strconv.Atoi(etag[i+1:])
+	}
+
+	if len(expected.algorithms()) > 0 || encrypted || parts == 0 {
+		return newChecksumVerifier(objectKey, expected)
+	}
+
+	head, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:     aws.String(s.config.Bucket),
+		Key:        aws.String(s.getFilePath(objectKey)),
+		PartNumber: aws.Int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newMultipartETagVerifier(objectKey, etag, aws.Int64Value(head.ContentLength))
+}
+
+// decodeS3Checksum converts a base64 checksum to hex. Composite checksums of multipart uploads are ignored
+func decodeS3Checksum(checksum string) string {
+	if strings.Contains(checksum, "-") {
+		return ""
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(decoded)
+}
+
+// multipartETagVerifier computes the ETag of a multipart upload: MD5 of the MD5 digests of parts, followed by the number of parts
+// All parts except the last one must have the same size
+type multipartETagVerifier struct {
+	objectKey string
+	etag      string
+	partSize  int64
+	part      hash.Hash
+	written   int64
+	digests   []byte
+}
+
+func newMultipartETagVerifier(objectKey string, etag string, partSize int64) (*multipartETagVerifier, error) {
+	if partSize <= 0 {
+		return nil, fmt.Errorf("%w: %q", ErrChecksumUnavailable, objectKey)
+	}
+
+	return &multipartETagVerifier{
+		objectKey: objectKey,
+		etag:      etag,
+		partSize:  partSize,
+		part:      md5.New(), //nolint:gosec // MD5 is used for integrity as S3 does
+	}, nil
+}
+
+func (v *multipartETagVerifier) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		size := v.partSize - v.written
+		if int64(len(p)) < size {
+			size = int64(len(p))
+		}
+
+		_, _ = v.part.Write(p[:size])
+		v.written += size
+		p = p[size:]
+		if v.written == v.partSize {
+			v.flush()
+		}
+	}
+
+	return n, nil
+}
+
+func (v *multipartETagVerifier) verify() error {
+	if v.written > 0 {
+		v.flush()
+	}
+
+	sum := md5.Sum(v.digests) //nolint:gosec // MD5 is used for integrity as S3 does
+	actual := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(v.digests)/md5.Size)
+	if actual != v.etag {
+		return &ChecksumError{Key: v.objectKey, Algorithm: ChecksumMD5, Expected: v.etag, Actual: actual}
+	}
+
+	return nil
+}
+
+func (v *multipartETagVerifier) flush() {
+	v.digests = v.part.Sum(v.digests)
+	v.part.Reset()
+	v.written = 0
+}
@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hungdv136/gokit/logger"
+)
+
+// Limits of multipart uploads
+const (
+	maxUploadParts  = 10000
+	maxUploadSize   = 5 << 40
+	defaultPartSize = s3manager.DefaultUploadPartSize
+)
+
+// ErrInvalidUploadSize is returned if the size of a multipart upload is negative or exceeds the limit of S3
+var ErrInvalidUploadSize = errors.New("invalid upload size")
+
+// MultipartUploadState is the state of a resumable upload. Persist it to continue the upload after an interruption
+type MultipartUploadState struct {
+	Key      string         `json:"key"`
+	UploadID string         `json:"upload_id"`
+	Size     int64          `json:"size"`
+	PartSize int64          `json:"part_size"`
+	Parts    []UploadedPart `json:"parts"`
+}
+
+// UploadedPart is a completed part of a multipart upload
+type UploadedPart struct {
+	Number int64  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// CheckpointFunc persists the state of an upload after a part is completed
+// An error stops the upload, the completed parts are kept
+type CheckpointFunc func(ctx context.Context, state MultipartUploadState) error
+
+// MultipartUpload is a handle of a resumable upload of a content with a known size
+// Parts which are not completed are uploaded concurrently. Interrupted uploads keep their parts until Abort is called
+type MultipartUpload struct {
+	storage *S3Storage
+	opts    *UploadOptions
+
+	mu    sync.Mutex
+	state MultipartUploadState
+}
+
+// CreateMultipartUpload starts a resumable upload of size bytes
+// Content-Type is detected from the key if it is not provided since the content is not read yet
+// The part size is at least 5MiB as required by S3, it is increased if the upload would exceed 10000 parts
+func (s *S3Storage) CreateMultipartUpload(ctx context.Context, objectKey string, size int64, options ...UploadOption) (*MultipartUpload, error) {
+	if size < 0 || size > maxUploadSize {
+		err := fmt.Errorf("%w: %q has %d bytes", ErrInvalidUploadSize, objectKey, size)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	opts := newUploadOptions(options)
+	if len(opts.ContentType) == 0 {
+		opts.ContentType = detectContentType(objectKey, nil)
+	}
+
+	partSize := s.config.PartSize
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+
+	partSize = max(partSize, s3manager.MinUploadPartSize)
+	if size/partSize >= maxUploadParts {
+		partSize = size/maxUploadParts + 1
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(s.config.Bucket),
+		Key:                aws.String(s.getFilePath(objectKey)),
+		ContentType:        aws.String(opts.ContentType),
+		ContentDisposition: getOptionalString(opts.ContentDisposition),
+		CacheControl:       getOptionalString(opts.CacheControl),
+		ContentEncoding:    getOptionalString(opts.ContentEncoding),
+		Tagging:            getOptionalString(encodeTags(opts.Tags)),
+	}
+
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+
+	created, err := s.client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to create upload of %q to %q, %w", objectKey, s.config.Bucket, err))
+		return nil, err
+	}
+
+	return &MultipartUpload{
+		storage: s,
+		opts:    opts,
+		state: MultipartUploadState{
+			Key:      objectKey,
+			UploadID: aws.StringValue(created.UploadId),
+			Size:     size,
+			PartSize: partSize,
+			Parts:    []UploadedPart{},
+		},
+	}, nil
+}
+
+// ResumeMultipartUpload continues an upload from its persisted state
+// Completed parts are listed from S3 since parts completed after the last checkpoint are not in the state
+// Returns ErrNotFound if the upload has been completed or aborted
+// Content attributes are set at creation, options only apply progress and conditions of the completion
+func (s *S3Storage) ResumeMultipartUpload(ctx context.Context, state MultipartUploadState, options ...UploadOption) (*MultipartUpload, error) {
+	u := &MultipartUpload{storage: s, opts: newUploadOptions(options), state: state}
+	parts := []UploadedPart{}
+	err := s.client.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(s.config.Bucket),
+		Key:      aws.String(s.getFilePath(state.Key)),
+		UploadId: aws.String(state.UploadID),
+	}, func(page *s3.ListPartsOutput, _ bool) bool {
+		for _, part := range page.Parts {
+			uploaded := UploadedPart{
+				Number: aws.Int64Value(part.PartNumber),
+				ETag:   strings.Trim(aws.StringValue(part.ETag), `"`),
+				Size:   aws.Int64Value(part.Size),
+			}
+
+			// Parts of an unexpected size are uploaded again
+			if uploaded.Size == u.getPartSize(uploaded.Number) {
+				parts = append(parts, uploaded)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to resume upload %q of %q, %w", state.UploadID, state.Key, err))
+		return nil, err
+	}
+
+	u.state.Parts = parts
+	return u, nil
+}
+
+// State returns a copy of the current state
+func (u *MultipartUpload) State() MultipartUploadState {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	state := u.state
+	state.Parts = append([]UploadedPart{}, u.state.Parts...)
+	return state
+}
+
+// Upload uploads the parts which are not completed yet from the reader then completes the upload
+// The reader must return the same content on every attempt, e.g. a file opened again after a restart
+// Checkpoint is called after each completed part, it may be nil. Parts are kept if the upload fails
+func (u *MultipartUpload) Upload(ctx context.Context, reader io.ReaderAt, checkpoint CheckpointFunc) (*UploadResult, error) {
+	progress := newProgress(u.opts.Progress, u.state.Size)
+	completed := map[int64]bool{}
+	for _, part := range u.State().Parts {
+		completed[part.Number] = true
+		progress.add(part.Size)
+	}
+
+	pending := make(chan int64)
+	go func() {
+		defer close(pending)
+		for number := int64(1); number <= u.countParts(); number++ {
+			if !completed[number] {
+				pending <- number
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	concurrency := u.storage.config.Concurrency
+	if concurrency <= 0 {
+		concurrency = s3manager.DefaultUploadConcurrency
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range pending {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if err := u.uploadPart(ctx, reader, number, checkpoint); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					cancel()
+					continue
+				}
+
+				progress.add(u.getPartSize(number))
+			}
+		}()
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return u.complete(ctx)
+}
+
+// Abort deletes the upload and its parts
+func (u *MultipartUpload) Abort(ctx context.Context) error {
+	s := u.storage
+	_, err := s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.config.Bucket),
+		Key:      aws.String(s.getFilePath(u.state.Key)),
+		UploadId: aws.String(u.state.UploadID),
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to abort upload %q of %q, %w", u.state.UploadID, u.state.Key, err))
+		return err
+	}
+
+	return nil
+}
+
+// AbortMultipartUploads aborts uploads under the prefix which were started before olderThan ago
+// Parts of abandoned uploads are billed until they are aborted. Returns the number of aborted uploads
+func (s *S3Storage) AbortMultipartUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error) {
+	deadline := time.Now().Add(-olderThan)
+	uploads := []*s3.MultipartUpload{}
+	err := s.client.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.config.Bucket),
+		Prefix: aws.String(s.getFilePath(prefix)),
+	}, func(page *s3.ListMultipartUploadsOutput, _ bool) bool {
+		for _, upload := range page.Uploads {
+			if aws.TimeValue(upload.Initiated).Before(deadline) {
+				uploads = append(uploads, upload)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to list uploads of %q in %q, %w", prefix, s.config.Bucket, err))
+		return 0, err
+	}
+
+	for i, upload := range uploads {
+		_, err := s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.config.Bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		if err != nil && !errors.Is(mapS3Error(err), ErrNotFound) {
+			err = mapS3Error(err)
+			logError(ctx, fmt.Errorf("unable to abort upload %q of %q, %w", aws.StringValue(upload.UploadId), aws.StringValue(upload.Key), err))
+			return i, err
+		}
+	}
+
+	return len(uploads), nil
+}
+
+func (u *MultipartUpload) uploadPart(ctx context.Context, reader io.ReaderAt, number int64, checkpoint CheckpointFunc) error {
+	s := u.storage
+	size := u.getPartSize(number)
+	output, err := s.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.config.Bucket),
+		Key:           aws.String(s.getFilePath(u.state.Key)),
+		UploadId:      aws.String(u.state.UploadID),
+		PartNumber:    aws.Int64(number),
+		ContentLength: aws.Int64(size),
+		Body:          io.NewSectionReader(reader, (number-1)*u.state.PartSize, size),
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to upload part %d of %q, %w", number, u.state.Key, err))
+		return err
+	}
+
+	// Checkpoints are serialized so a later state is never overwritten by an earlier one
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.state.Parts = append(u.state.Parts, UploadedPart{Number: number, ETag: strings.Trim(aws.StringValue(output.ETag), `"`), Size: size})
+	sort.Slice(u.state.Parts, func(i, j int) bool { return u.state.Parts[i].Number < u.state.Parts[j].Number })
+	if checkpoint == nil {
+		return nil
+	}
+
+	state := u.state
+	state.Parts = append([]UploadedPart{}, u.state.Parts...)
+	if err := checkpoint(ctx, state); err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to save state of upload %q of %q, %w", u.state.UploadID, u.state.Key, err))
+		return err
+	}
+
+	return nil
+}
+
+func (u *MultipartUpload) complete(ctx context.Context) (*UploadResult, error) {
+	s := u.storage
+	state := u.State()
+	parts := make([]*s3.CompletedPart, 0, len(state.Parts))
+	for _, part := range state.Parts {
+		parts = append(parts, &s3.CompletedPart{ETag: aws.String(quoteETag(part.ETag)), PartNumber: aws.Int64(part.Number)})
+	}
+
+	path := s.getFilePath(state.Key)
+	output, err := s.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.config.Bucket),
+		Key:             aws.String(path),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	}, withConditionHeaders(u.opts))
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to complete upload %q of %q, %w", state.UploadID, state.Key, err))
+		return nil, err
+	}
+
+	return &UploadResult{Path: path, ETag: strings.Trim(aws.StringValue(output.ETag), `"`), Size: state.Size}, nil
+}
+
+// countParts returns the number of parts. An empty content has one empty part
+func (u *MultipartUpload) countParts() int64 {
+	if u.state.Size == 0 {
+		return 1
+	}
+
+	return (u.state.Size + u.state.PartSize - 1) / u.state.PartSize
+}
+
+func (u *MultipartUpload) getPartSize(number int64) int64 {
+	return min(u.state.PartSize, u.state.Size-(number-1)*u.state.PartSize)
+}
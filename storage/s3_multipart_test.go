@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Storage_UploadProgress(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newTestS3Storage(t)
+	content := make([]byte, s3manager.MinUploadPartSize+10)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	var sent, total int64
+	objectKey := "progress/" + uuid.NewString()
+	_, err = s.UploadFile(ctx, objectKey, bytes.NewReader(content), WithProgress(func(n, size int64) { sent, total = n, size }))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), sent)
+	require.Equal(t, int64(len(content)), total)
+	require.Equal(t, content, readAll(t, s, objectKey))
+}
+
+func TestS3Storage_MultipartUpload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newTestS3Storage(t)
+	content := make([]byte, 2*s3manager.MinUploadPartSize+10)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	objectKey := "multipart/" + uuid.NewString() + ".bin"
+	upload, err := s.CreateMultipartUpload(ctx, objectKey, int64(len(content)), WithMetadata(map[string]string{"owner": "u1"}))
+	require.NoError(t, err)
+	require.Equal(t, int64(s3manager.MinUploadPartSize), upload.State().PartSize)
+
+	// Interrupt the upload after the first part
+	errInterrupted := errors.New("interrupted")
+	var saved []byte
+	_, err = upload.Upload(ctx, bytes.NewReader(content), func(_ context.Context, state MultipartUploadState) error {
+		if saved != nil {
+			return errInterrupted
+		}
+
+		saved, err = json.Marshal(state)
+		return err
+	})
+	require.ErrorIs(t, err, errInterrupted)
+
+	state := MultipartUploadState{}
+	require.NoError(t, json.Unmarshal(saved, &state))
+	require.Len(t, state.Parts, 1)
+
+	var sent int64
+	resumed, err := s.ResumeMultipartUpload(ctx, state, WithProgress(func(n, _ int64) { sent = n }))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(resumed.State().Parts), 1)
+
+	result, err := resumed.Upload(ctx, bytes.NewReader(content), nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), result.Size)
+	require.Equal(t, int64(len(content)), sent)
+	require.Equal(t, content, readAll(t, s, objectKey))
+
+	info, err := s.Stat(ctx, objectKey)
+	require.NoError(t, err)
+	require.NotEmpty(t, result.ETag)
+	require.Equal(t, map[string]string{"owner": "u1"}, info.Metadata)
+
+	_, err = s.ResumeMultipartUpload(ctx, state)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = s.CreateMultipartUpload(ctx, objectKey, -1)
+	require.ErrorIs(t, err, ErrInvalidUploadSize)
+}
+
+func TestS3Storage_AbortMultipartUpload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newTestS3Storage(t)
+	prefix := "abort/" + uuid.NewString() + "/"
+
+	upload, err := s.CreateMultipartUpload(ctx, prefix+"a.bin", 10)
+	require.NoError(t, err)
+	require.NoError(t, upload.Abort(ctx))
+	_, err = s.ResumeMultipartUpload(ctx, upload.State())
+	require.ErrorIs(t, err, ErrNotFound)
+
+	orphan, err := s.CreateMultipartUpload(ctx, prefix+"b.bin", 10)
+	require.NoError(t, err)
+	aborted, err := s.AbortMultipartUploads(ctx, prefix, time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, aborted)
+
+	aborted, err = s.AbortMultipartUploads(ctx, prefix, -time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 1, aborted)
+	_, err = s.ResumeMultipartUpload(ctx, orphan.State())
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func newTestS3Storage(t *testing.T) *S3Storage {
+	s, err := newS3Storage(context.Background(), S3Config{
+		Bucket:           "test",
+		Directory:        "raw_data",
+		Region:           "ap-southeast-1",
+		AccessKeyID:      "test",
+		SecretAccessKey:  "test",
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+		Endpoint:         aws.String("localhost:4566"),
+		PartSize:         s3manager.MinUploadPartSize,
+		Concurrency:      1,
+	})
+	require.NoError(t, err)
+	return s
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hungdv136/gokit/logger"
+)
+
+const (
+	postPolicyAlgorithm  = "AWS4-HMAC-SHA256"
+	postPolicyDateFormat = "20060102T150405Z"
+)
+
+// PresignPost creates a policy for browser-form uploads (POST Object)
+// Uploaded keys must start with keyPrefix. The key field uses ${filename} so browsers can keep the file name
+// Content type and content length range are added to the policy conditions if they are provided
+func (s *S3Storage) PresignPost(ctx context.Context, keyPrefix string, options ...PresignOption) (*PostPolicy, error) {
+	opts := newPresignOptions(s.config.PresignURLExpiration, options)
+	creds, err := s.session.Config.Credentials.GetWithContext(ctx)
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to get credentials, %w", err))
+		return nil, err
+	}
+
+	bucketURL, err := s.getBucketURL()
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to build url of %q, %w", s.config.Bucket, err))
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(opts.Expiration)
+	keyPrefix = s.getDirPrefix() + keyPrefix
+	credential := fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, now.Format("20060102"), s.config.Region)
+
+	fields := map[string]string{
+		"key":              keyPrefix + "${filename}",
+		"x-amz-algorithm":  postPolicyAlgorithm,
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format(postPolicyDateFormat),
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": s.config.Bucket},
+		[]string{"starts-with", "$key", keyPrefix},
+		map[string]string{"x-amz-algorithm": postPolicyAlgorithm},
+		map[string]string{"x-amz-credential": credential},
+		map[string]string{"x-amz-date": fields["x-amz-date"]},
+	}
+
+	if len(creds.SessionToken) > 0 {
+		fields["x-amz-security-token"] = creds.SessionToken
+		conditions = append(conditions, map[string]string{"x-amz-security-token": creds.SessionToken})
+	}
+
+	if len(opts.ContentType) > 0 {
+		fields["Content-Type"] = opts.ContentType
+		conditions = append(conditions, map[string]string{"Content-Type": opts.ContentType})
+	}
+
+	minLength, maxLength := opts.MinContentLength, opts.MaxContentLength
+	if opts.ContentLength > 0 && maxLength == 0 {
+		minLength, maxLength = opts.ContentLength, opts.ContentLength
+	}
+
+	if maxLength > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", minLength, maxLength})
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": expiresAt.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	encodedPolicy := base64.StdEncoding.EncodeToString(policy)
+	fields["policy"] = encodedPolicy
+	fields["x-amz-signature"] = signPostPolicy(creds.SecretAccessKey, now, s.config.Region, encodedPolicy)
+
+	return &PostPolicy{URL: bucketURL, Fields: fields, ExpiresAt: expiresAt}, nil
+}
+
+// getBucketURL returns the endpoint of the bucket which respects path style and custom endpoint
+func (s *S3Storage) getBucketURL() (string, error) {
+	req, _ := s.client.HeadBucketRequest(&s3.HeadBucketInput{Bucket: aws.String(s.config.Bucket)})
+	if err := req.Build(); err != nil {
+		return "", err
+	}
+
+	u := *req.HTTPRequest.URL
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// signPostPolicy signs the encoded policy with AWS Signature Version 4
+func signPostPolicy(secretKey string, t time.Time, region string, encodedPolicy string) string {
+	key := hmacSHA256([]byte("AWS4"+secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, encodedPolicy))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -2,14 +2,19 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
@@ -19,6 +24,13 @@ import (
 
 const ErrCodeNotFound = "NotFound"
 
+// Limits of S3 APIs
+const (
+	maxDeleteObjects  = 1000
+	maxCopyObjectSize = 5 << 30
+	copyPartSize      = 512 << 20
+)
+
 // S3Config defines config for s3 storage
 type S3Config struct {
 	AccessKeyID          string        `json:"access_key_id" yaml:"access_key_id"`
@@ -29,28 +41,46 @@ type S3Config struct {
 	PresignURLExpiration time.Duration `json:"presign_url_expiration" yaml:"presign_url_expiration"`
 	MaxKeys              int64         `json:"max_keys" yaml:"max_keys"`
 
+	// Multipart uploads. Default: 5MiB parts, 5 parts uploaded concurrently
+	PartSize    int64 `json:"part_size" yaml:"part_size"`
+	Concurrency int   `json:"concurrency" yaml:"concurrency"`
+
 	// Set nil to use default value
 	Endpoint         *string `json:"endpoint" yaml:"endpoint"`
 	S3ForcePathStyle *bool   `json:"s3_force_path_style" yaml:"s3_force_path_style"`
 	DisableSSL       *bool   `json:"disable_ssl" yaml:"disable_ssl"`
 }
 
+// Validate checks required fields
+func (c *S3Config) Validate() error {
+	if len(c.Bucket) == 0 {
+		return &ConfigError{Field: "bucket", Err: errRequired}
+	}
+
+	return nil
+}
+
 // S3Storage defines methods to access S3
 type S3Storage struct {
-	config  S3Config
-	session *session.Session
-	client  s3iface.S3API
+	config   S3Config
+	session  *session.Session
+	client   s3iface.S3API
+	uploader *s3manager.Uploader
 }
 
 // newS3Storage creates an instance of S3Storage
 func newS3Storage(ctx context.Context, config S3Config) (*S3Storage, error) {
 	awsConfig := &aws.Config{
-		Region:           aws.String(config.Region),
 		Endpoint:         config.Endpoint,
 		DisableSSL:       config.DisableSSL,
 		S3ForcePathStyle: config.S3ForcePathStyle,
 	}
 
+	// An empty region falls back to the environment or the shared config of the SDK
+	if len(config.Region) > 0 {
+		awsConfig.Region = aws.String(config.Region)
+	}
+
 	if config.AccessKeyID != "" && config.SecretAccessKey != "" {
 		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, "")
 	}
@@ -61,35 +91,138 @@ func newS3Storage(ctx context.Context, config S3Config) (*S3Storage, error) {
 		return nil, err
 	}
 
-	return &S3Storage{config: config, session: sess, client: s3.New(sess)}, nil
+	client := s3.New(sess)
+	uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		if config.PartSize > 0 {
+			u.PartSize = config.PartSize
+		}
+
+		if config.Concurrency > 0 {
+			u.Concurrency = config.Concurrency
+		}
+	})
+
+	return &S3Storage{config: config, session: sess, client: client, uploader: uploader}, nil
 }
 
 // UploadFile reads from reader and uploads to S3
-func (s *S3Storage) UploadFile(ctx context.Context, objectKey string, reader io.Reader) (string, error) {
-	uploader := s3manager.NewUploader(s.session)
+// Content-Type is sniffed from the first bytes if it is not provided
+func (s *S3Storage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	opts := newUploadOptions(options)
+	progress := newReaderProgress(opts.Progress, reader)
+	reader, err := opts.detectContentType(objectKey, reader)
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.Bucket, err))
+		return nil, err
+	}
+
+	checksums := newChecksummer(opts.Checksums)
+
 	path := s.getFilePath(objectKey)
-	_, err := uploader.UploadWithContext(ctx,
-		&s3manager.UploadInput{
-			Bucket: aws.String(s.config.Bucket),
-			Key:    aws.String(path),
-			Body:   reader,
-		})
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(s.config.Bucket),
+		Key:         aws.String(path),
+		Body:        io.TeeReader(reader, checksums),
+		ContentType: aws.String(opts.ContentType),
+	}
+
+	if len(opts.ContentDisposition) > 0 {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+
+	if len(opts.CacheControl) > 0 {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+
+	if len(opts.ContentEncoding) > 0 {
+		input.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+
+	if len(opts.Tags) > 0 {
+		input.Tagging = aws.String(encodeTags(opts.Tags))
+	}
+
+	output, err := s.uploader.UploadWithContext(ctx, input, s3manager.WithUploaderRequestOptions(
+		withChecksumHeaders(opts.Checksums),
+		withConditionHeaders(opts),
+		withProgress(progress),
+	))
 	if err != nil {
-		logger.Error(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.Bucket, err))
-		return "", err
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to upload %q to %q, %w", objectKey, s.config.Bucket, err))
+		return nil, err
 	}
 
-	return path, nil
+	return &UploadResult{
+		Path:      path,
+		ETag:      strings.Trim(aws.StringValue(output.ETag), `"`),
+		Size:      checksums.size,
+		Checksums: checksums.sum(),
+	}, nil
 }
 
 // DownloadFile downloads file from S3 returns the body
-func (s *S3Storage) DownloadFile(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+// Checksums are verified against the SHA256 or CRC32C checksum stored by S3, or the ETag if it is an MD5 digest
+func (s *S3Storage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	opts := newDownloadOptions(options)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(s.getFilePath(objectKey)),
+	}
+
+	if opts.VerifyChecksum {
+		input.ChecksumMode = aws.String(s3.ChecksumModeEnabled)
+	}
+
+	result, err := s.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to download %q to %q, %w", objectKey, s.config.Bucket, err))
+		return nil, err
+	}
+
+	etag := strings.Trim(aws.StringValue(result.ETag), `"`)
+	if !opts.VerifyChecksum {
+		return &DownloadResult{ReadCloser: result.Body, ETag: etag}, nil
+	}
+
+	v, err := s.newVerifier(ctx, objectKey, result)
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to download %q to %q, %w", objectKey, s.config.Bucket, err))
+		_ = result.Body.Close()
+		return nil, err
+	}
+
+	return &DownloadResult{ReadCloser: newVerifyReader(result.Body, v), ETag: etag}, nil
+}
+
+// DownloadRange downloads length bytes from offset. Negative length reads to the end of the object
+func (s *S3Storage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length == 0 {
+		err := fmt.Errorf("%w: offset %d, length %d", ErrInvalidRange, offset, length)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
 	result, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.config.Bucket),
 		Key:    aws.String(s.getFilePath(objectKey)),
+		Range:  aws.String(byteRange),
 	})
 	if err != nil {
-		logger.Error(ctx, fmt.Errorf("unable to download %q to %q, %w", objectKey, s.config.Bucket, err))
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to download %s of %q to %q, %w", byteRange, objectKey, s.config.Bucket, err))
 		return nil, err
 	}
 
@@ -104,30 +237,229 @@ func (s *S3Storage) DeleteFile(ctx context.Context, objectKey string) error {
 			Key:    aws.String(s.getFilePath(objectKey)),
 		})
 	if err != nil {
-		logger.Error(ctx, fmt.Errorf("unable to delete %q to %q, %w", objectKey, s.config.Bucket, err))
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to delete %q to %q, %w", objectKey, s.config.Bucket, err))
 		return err
 	}
 
 	return nil
 }
 
-// GetURL returns the url of a file
-func (s *S3Storage) GetURL(ctx context.Context, objectKey string) (string, error) {
+// DeleteMany deletes objects with the batch delete API, up to 1000 keys per request
+// Errors of keys which cannot be deleted are returned in the map
+func (s *S3Storage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	keyErrors := map[string]error{}
+	for start := 0; start < len(objectKeys); start += maxDeleteObjects {
+		end := start + maxDeleteObjects
+		if end > len(objectKeys) {
+			end = len(objectKeys)
+		}
+
+		keys := map[string]string{}
+		objects := make([]*s3.ObjectIdentifier, 0, end-start)
+		for _, objectKey := range objectKeys[start:end] {
+			path := s.getFilePath(objectKey)
+			keys[path] = objectKey
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(path)})
+		}
+
+		output, err := s.client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.config.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			err = mapS3Error(err)
+			logError(ctx, fmt.Errorf("unable to delete %d objects from %q, %w", len(objects), s.config.Bucket, err))
+			return keyErrors, err
+		}
+
+		for _, e := range output.Errors {
+			objectKey := keys[aws.StringValue(e.Key)]
+			keyErrors[objectKey] = mapS3Error(awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil))
+			logError(ctx, fmt.Errorf("unable to delete %q from %q, %w", objectKey, s.config.Bucket, keyErrors[objectKey]))
+		}
+	}
+
+	return keyErrors, nil
+}
+
+// Copy copies an object to another key in the same bucket with server-side copy
+func (s *S3Storage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	return s.CopyTo(ctx, srcKey, s, dstKey)
+}
+
+// CopyTo copies an object to another S3 storage with server-side copy
+// Both storages must be accessible by the credentials of this storage
+// Objects larger than 5GB are copied with multipart copy
+func (s *S3Storage) CopyTo(ctx context.Context, srcKey string, dst *S3Storage, dstKey string) error {
+	info, err := s.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	copySource := getCopySource(s.config.Bucket, s.getFilePath(srcKey))
+	if info.Size > maxCopyObjectSize {
+		return s.multipartCopy(ctx, copySource, info, dst, dstKey)
+	}
+
+	_, err = s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(dst.config.Bucket),
+		Key:        aws.String(dst.getFilePath(dstKey)),
+		CopySource: aws.String(copySource),
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to copy %q to %q, %w", copySource, dstKey, err))
+		return err
+	}
+
+	return nil
+}
+
+// Move copies an object to another key then deletes the source object
+func (s *S3Storage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	if err := s.Copy(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	return s.DeleteFile(ctx, srcKey)
+}
+
+// multipartCopy copies a large object part by part. Content attributes and metadata are copied from the source object
+func (s *S3Storage) multipartCopy(ctx context.Context, copySource string, info *ObjectInfo, dst *S3Storage, dstKey string) error {
+	dstPath := dst.getFilePath(dstKey)
+	created, err := s.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(dst.config.Bucket),
+		Key:                aws.String(dstPath),
+		ContentType:        aws.String(info.ContentType),
+		ContentDisposition: getOptionalString(info.ContentDisposition),
+		CacheControl:       getOptionalString(info.CacheControl),
+		ContentEncoding:    getOptionalString(info.ContentEncoding),
+		Metadata:           aws.StringMap(info.Metadata),
+		Tagging:            getOptionalString(encodeTags(info.Tags)),
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to copy %q to %q, %w", copySource, dstKey, err))
+		return err
+	}
+
+	parts := []*s3.CompletedPart{}
+	size := info.Size
+	for offset, partNumber := int64(0), int64(1); offset < size; offset, partNumber = offset+copyPartSize, partNumber+1 {
+		end := offset + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		output, err := s.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(dst.config.Bucket),
+			Key:             aws.String(dstPath),
+			UploadId:        created.UploadId,
+			PartNumber:      aws.Int64(partNumber),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			err = mapS3Error(err)
+			logError(ctx, fmt.Errorf("unable to copy %q to %q, %w", copySource, dstKey, err))
+			s.abortMultipartUpload(ctx, dst.config.Bucket, dstPath, created.UploadId)
+			return err
+		}
+
+		parts = append(parts, &s3.CompletedPart{ETag: output.CopyPartResult.ETag, PartNumber: aws.Int64(partNumber)})
+	}
+
+	_, err = s.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(dst.config.Bucket),
+		Key:             aws.String(dstPath),
+		UploadId:        created.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to copy %q to %q, %w", copySource, dstKey, err))
+		s.abortMultipartUpload(ctx, dst.config.Bucket, dstPath, created.UploadId)
+		return err
+	}
+
+	return nil
+}
+
+func (s *S3Storage) abortMultipartUpload(ctx context.Context, bucket string, path string, uploadID *string) {
+	_, err := s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(path),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		logger.Error(ctx, fmt.Errorf("unable to abort upload %q of %q, %w", aws.StringValue(uploadID), path, err))
+	}
+}
+
+// GetURL returns the presigned url of a file
+// Expiration is PresignURLExpiration if it is not provided
+func (s *S3Storage) GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error) {
+	opts := newPresignOptions(s.config.PresignURLExpiration, options)
 	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: aws.String(s.config.Bucket),
 		Key:    aws.String(s.getFilePath(objectKey)),
 	})
 	req.SetContext(ctx)
 
-	url, err := req.Presign(s.config.PresignURLExpiration)
+	url, err := req.Presign(opts.Expiration)
 	if err != nil {
-		logger.Error(ctx, fmt.Errorf("unable to presign %q to %q, %w", objectKey, s.config.Bucket, err))
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to presign %q to %q, %w", objectKey, s.config.Bucket, err))
 		return "", err
 	}
 
 	return url, nil
 }
 
+// GetUploadURL returns a presigned PUT request
+// Content type and content length are signed if they are provided, S3 rejects uploads which do not match
+func (s *S3Storage) GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (*PresignedRequest, error) {
+	opts := newPresignOptions(s.config.PresignURLExpiration, options)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(s.getFilePath(objectKey)),
+	}
+
+	if len(opts.ContentType) > 0 {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	if opts.ContentLength > 0 {
+		input.ContentLength = aws.Int64(opts.ContentLength)
+	}
+
+	req, _ := s.client.PutObjectRequest(input)
+	req.SetContext(ctx)
+
+	presignedURL, headers, err := req.PresignRequest(opts.Expiration)
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to presign upload %q to %q, %w", objectKey, s.config.Bucket, err))
+		return nil, err
+	}
+
+	// Signed headers are returned in lower case. Host is set by HTTP clients
+	signedHeaders := make(http.Header, len(headers))
+	for k, v := range headers {
+		if !strings.EqualFold(k, "Host") {
+			signedHeaders[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	return &PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       presignedURL,
+		Headers:   signedHeaders,
+		ExpiresAt: time.Now().Add(opts.Expiration),
+	}, nil
+}
+
 // Exist checks if file is existed
 func (s *S3Storage) Exist(ctx context.Context, objectKey string) (bool, error) {
 	_, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
@@ -135,15 +467,8 @@ func (s *S3Storage) Exist(ctx context.Context, objectKey string) (bool, error) {
 		Key:    aws.String(s.getFilePath(objectKey)),
 	})
 	if err != nil {
-		//nolint:errorlint
-		aErr, ok := err.(awserr.Error)
-		if !ok {
-			logger.Error(ctx, err)
-			return false, err
-		}
-
-		code := aErr.Code()
-		if code == s3.ErrCodeNoSuchKey || code == s3.ErrCodeNoSuchBucket || code == ErrCodeNotFound {
+		err = mapS3Error(err)
+		if errors.Is(err, ErrNotFound) {
 			return false, nil
 		}
 
@@ -154,6 +479,174 @@ func (s *S3Storage) Exist(ctx context.Context, objectKey string) (bool, error) {
 	return true, nil
 }
 
+// Stat returns attributes, metadata and tags of an object
+func (s *S3Storage) Stat(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	path := s.getFilePath(objectKey)
+	output, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to stat %q in %q, %w", objectKey, s.config.Bucket, err))
+		return nil, err
+	}
+
+	info := &ObjectInfo{
+		Key:                objectKey,
+		Size:               aws.Int64Value(output.ContentLength),
+		ETag:               strings.Trim(aws.StringValue(output.ETag), `"`),
+		LastModified:       aws.TimeValue(output.LastModified),
+		ContentType:        aws.StringValue(output.ContentType),
+		ContentDisposition: aws.StringValue(output.ContentDisposition),
+		CacheControl:       aws.StringValue(output.CacheControl),
+		ContentEncoding:    aws.StringValue(output.ContentEncoding),
+		Metadata:           make(map[string]string, len(output.Metadata)),
+	}
+
+	// The SDK canonicalizes metadata keys as HTTP headers
+	for k, v := range output.Metadata {
+		info.Metadata[strings.ToLower(k)] = aws.StringValue(v)
+	}
+
+	tagging, err := s.client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to get tags of %q in %q, %w", objectKey, s.config.Bucket, err))
+		return nil, err
+	}
+
+	info.Tags = make(map[string]string, len(tagging.TagSet))
+	for _, tag := range tagging.TagSet {
+		info.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return info, nil
+}
+
+// List returns a page of objects which have the prefix
+// Keys are relative to the configured directory. Page size is MaxKeys
+func (s *S3Storage) List(ctx context.Context, prefix string, cursor string) (*ListResult, error) {
+	dir := s.getDirPrefix()
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.Bucket),
+		Prefix: aws.String(dir + prefix),
+	}
+
+	if s.config.MaxKeys > 0 {
+		input.MaxKeys = aws.Int64(s.config.MaxKeys)
+	}
+
+	if len(cursor) > 0 {
+		input.ContinuationToken = aws.String(cursor)
+	}
+
+	output, err := s.client.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		err = mapS3Error(err)
+		logError(ctx, fmt.Errorf("unable to list %q in %q, %w", prefix, s.config.Bucket, err))
+		return nil, err
+	}
+
+	result := &ListResult{Objects: make([]*ObjectInfo, 0, len(output.Contents))}
+	for _, obj := range output.Contents {
+		result.Objects = append(result.Objects, &ObjectInfo{
+			Key:          strings.TrimPrefix(aws.StringValue(obj.Key), dir),
+			Size:         aws.Int64Value(obj.Size),
+			ETag:         strings.Trim(aws.StringValue(obj.ETag), `"`),
+			LastModified: aws.TimeValue(obj.LastModified),
+		})
+	}
+
+	if aws.BoolValue(output.IsTruncated) {
+		result.NextCursor = aws.StringValue(output.NextContinuationToken)
+	}
+
+	return result, nil
+}
+
+// getDirPrefix returns the directory with a trailing slash to be used as a raw key prefix
+func (s *S3Storage) getDirPrefix() string {
+	dir := strings.Trim(filepath.ToSlash(s.config.Directory), "/")
+	if len(dir) == 0 {
+		return ""
+	}
+
+	return dir + "/"
+}
+
+// encodeTags encodes tags as the URL query format of the tagging header
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+
+	return values.Encode()
+}
+
+func getOptionalString(s string) *string {
+	if len(s) == 0 {
+		return nil
+	}
+
+	return aws.String(s)
+}
+
+// withConditionHeaders adds conditions of the upload to PutObject and CompleteMultipartUpload requests
+// The SDK does not model If-Match and If-None-Match of writes, so they are set as headers
+func withConditionHeaders(opts *UploadOptions) request.Option {
+	return func(r *request.Request) {
+		if r.Operation.Name != "PutObject" && r.Operation.Name != "CompleteMultipartUpload" {
+			return
+		}
+
+		if len(opts.IfMatch) > 0 {
+			r.HTTPRequest.Header.Set("If-Match", quoteETag(opts.IfMatch))
+		}
+
+		if len(opts.IfNoneMatch) > 0 {
+			r.HTTPRequest.Header.Set("If-None-Match", quoteETag(opts.IfNoneMatch))
+		}
+	}
+}
+
+// withProgress reports the body of each PutObject and UploadPart request once it succeeds
+func withProgress(p *progress) request.Option {
+	return func(r *request.Request) {
+		if p == nil || (r.Operation.Name != "PutObject" && r.Operation.Name != "UploadPart") {
+			return
+		}
+
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.Error == nil {
+				p.add(r.HTTPRequest.ContentLength)
+			}
+		})
+	}
+}
+
+func quoteETag(etag string) string {
+	if etag == "*" {
+		return etag
+	}
+
+	return `"` + etag + `"`
+}
+
+// getCopySource returns the URL-encoded source of copy APIs
+func getCopySource(bucket string, path string) string {
+	segments := strings.Split(bucket+"/"+path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
 func (s *S3Storage) getFilePath(objectKey string) string {
 	return filepath.Join(s.config.Directory, objectKey)
 }
@@ -3,6 +3,11 @@ package storage
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -23,9 +28,11 @@ func TestS3Storage(t *testing.T) {
 	content := []byte(data)
 
 	// upload file
-	key, err := mockS3Storage.UploadFile(ctx, objectKey, bytes.NewReader(content))
+	result, err := mockS3Storage.UploadFile(ctx, objectKey, bytes.NewReader(content))
 	require.NoError(t, err)
-	require.NotEmpty(t, key)
+	require.Equal(t, "raw_data/"+objectKey, result.Path)
+	require.Equal(t, int64(len(content)), result.Size)
+	require.Equal(t, result.Checksums.MD5, result.ETag)
 
 	// download file
 	download, err := mockS3Storage.DownloadFile(ctx, objectKey)
@@ -35,6 +42,13 @@ func TestS3Storage(t *testing.T) {
 	require.Len(t, content, n)
 	require.Equal(t, content, downloadContent)
 
+	verified, err := mockS3Storage.DownloadFile(ctx, objectKey, WithChecksumVerification())
+	require.NoError(t, err)
+	verifiedContent, err := io.ReadAll(verified)
+	require.NoError(t, err)
+	require.NoError(t, verified.Close())
+	require.Equal(t, content, verifiedContent)
+
 	existed, err := mockS3Storage.Exist(ctx, objectKey)
 	require.NoError(t, err)
 	require.True(t, existed)
@@ -43,6 +57,9 @@ func TestS3Storage(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, existed)
 
+	_, err = mockS3Storage.DownloadFile(ctx, uuid.NewString())
+	require.ErrorIs(t, err, ErrNotFound)
+
 	presignedURL, err := mockS3Storage.GetURL(ctx, objectKey)
 	require.NoError(t, err)
 	require.NotEmpty(t, presignedURL)
@@ -54,6 +71,199 @@ func TestS3Storage(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestS3Storage_List(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newMockS3()
+	prefix := uuid.NewString() + "/"
+	keys := []string{prefix + "a.csv", prefix + "b.csv", prefix + "c.csv"}
+	for _, key := range keys {
+		_, err := s.UploadFile(ctx, key, bytes.NewReader([]byte(key)))
+		require.NoError(t, err)
+	}
+
+	page, err := s.List(ctx, prefix, "")
+	require.NoError(t, err)
+	require.Len(t, page.Objects, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	objects, err := ListAll(ctx, s, prefix)
+	require.NoError(t, err)
+	require.Len(t, objects, len(keys))
+	for i, obj := range objects {
+		require.Equal(t, keys[i], obj.Key)
+		require.Equal(t, int64(len(keys[i])), obj.Size)
+		require.NotEmpty(t, obj.ETag)
+		require.False(t, obj.LastModified.IsZero())
+	}
+}
+
+func TestS3Storage_Stat(t *testing.T) {
+	t.Parallel()
+
+	s := newMockS3()
+	ctx := context.Background()
+	objectKey := "reports/" + uuid.NewString() + ".json"
+	_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"a":1}`)),
+		WithContentDisposition(`attachment; filename="report.json"`),
+		WithCacheControl("max-age=60"),
+		WithMetadata(map[string]string{"Owner": "u1"}),
+		WithTags(map[string]string{"class": "report"}),
+	)
+	require.NoError(t, err)
+
+	info, err := s.Stat(ctx, objectKey)
+	require.NoError(t, err)
+	require.Equal(t, objectKey, info.Key)
+	require.Equal(t, int64(7), info.Size)
+	require.NotEmpty(t, info.ETag)
+	require.False(t, info.LastModified.IsZero())
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, `attachment; filename="report.json"`, info.ContentDisposition)
+	require.Equal(t, "max-age=60", info.CacheControl)
+	require.Equal(t, map[string]string{"owner": "u1"}, info.Metadata)
+	require.Equal(t, map[string]string{"class": "report"}, info.Tags)
+
+	_, err = s.Stat(ctx, uuid.NewString())
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestS3Storage_GetUploadURL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newMockS3()
+	objectKey := "uploads/" + uuid.NewString() + ".json"
+	content := []byte(`{"a":1}`)
+
+	presignedURL, err := s.GetURL(ctx, objectKey, WithExpiration(30*time.Second))
+	require.NoError(t, err)
+	require.Contains(t, presignedURL, "X-Amz-Expires=30")
+
+	upload, err := s.GetUploadURL(ctx, objectKey, WithRequiredContentType("application/json"), WithRequiredContentLength(int64(len(content))))
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPut, upload.Method)
+	require.Equal(t, "application/json", upload.Headers.Get("Content-Type"))
+	require.Equal(t, strconv.Itoa(len(content)), upload.Headers.Get("Content-Length"))
+
+	req, err := http.NewRequestWithContext(ctx, upload.Method, upload.URL, bytes.NewReader(content))
+	require.NoError(t, err)
+	req.Header = upload.Headers.Clone()
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	info, err := s.Stat(ctx, objectKey)
+	require.NoError(t, err)
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, int64(len(content)), info.Size)
+}
+
+func TestS3Storage_PresignPost(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, ok := newMockS3().(*S3Storage)
+	require.True(t, ok)
+
+	prefix := "browser/" + uuid.NewString() + "/"
+	policy, err := s.PresignPost(ctx, prefix, WithRequiredContentType("text/plain"), WithContentLengthRange(1, 1024))
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:4566/test", policy.URL)
+	require.Equal(t, "raw_data/"+prefix+"${filename}", policy.Fields["key"])
+	require.NotEmpty(t, policy.Fields["x-amz-signature"])
+
+	decoded, err := base64.StdEncoding.DecodeString(policy.Fields["policy"])
+	require.NoError(t, err)
+	require.Contains(t, string(decoded), `["starts-with","$key","raw_data/`+prefix+`"]`)
+	require.Contains(t, string(decoded), `["content-length-range",1,1024]`)
+	require.Contains(t, string(decoded), `{"Content-Type":"text/plain"}`)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for k, v := range policy.Fields {
+		require.NoError(t, writer.WriteField(k, v))
+	}
+	part, err := writer.CreateFormFile("file", "hello.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, policy.URL, body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Less(t, res.StatusCode, 300)
+
+	existed, err := s.Exist(ctx, prefix+"hello.txt")
+	require.NoError(t, err)
+	require.True(t, existed)
+}
+
+func TestS3Storage_DownloadRange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newMockS3()
+	objectKey := "ranges/" + uuid.NewString()
+	_, err := s.UploadFile(ctx, objectKey, bytes.NewReader([]byte("0123456789")))
+	require.NoError(t, err)
+
+	testDownloadRange(t, s, objectKey)
+}
+
+func TestS3Storage_CopyMove(t *testing.T) {
+	t.Parallel()
+
+	testCopyMove(t, newMockS3(), "copy/"+uuid.NewString()+"/")
+}
+
+func TestS3Storage_CopyBetween(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src := newMockS3()
+	dst, err := NewStorage(ctx, TypeS3, S3Config{
+		Bucket:           "test2",
+		Region:           "ap-southeast-1",
+		AccessKeyID:      "test",
+		SecretAccessKey:  "test",
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+		Endpoint:         aws.String("localhost:4566"),
+	})
+	require.NoError(t, err)
+
+	objectKey := "copy/" + uuid.NewString() + ".json"
+	_, err = src.UploadFile(ctx, objectKey, bytes.NewReader([]byte(`{"a":1}`)), WithTags(map[string]string{"class": "report"}))
+	require.NoError(t, err)
+
+	require.NoError(t, MoveBetween(ctx, src, objectKey, dst, objectKey))
+	require.Equal(t, `{"a":1}`, string(readAll(t, dst, objectKey)))
+	existed, err := src.Exist(ctx, objectKey)
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	require.Equal(t, "test/raw_data/a%20b/c+d%3F.json", getCopySource("test", "raw_data/a b/c+d?.json"))
+}
+
+func TestS3Storage_Conditions(t *testing.T) {
+	t.Parallel()
+
+	testConditionalUpload(t, newMockS3(), "conditions/"+uuid.NewString()+"/")
+}
+
+func TestS3Storage_Janitor(t *testing.T) {
+	t.Parallel()
+
+	testJanitorSweep(t, newMockS3(), "janitor/"+uuid.NewString()+"/")
+}
+
 func newMockS3() Storage {
 	s, err := NewStorage(context.Background(), TypeS3, S3Config{
 		Bucket:               "test",
@@ -65,6 +275,7 @@ func newMockS3() Storage {
 		DisableSSL:           aws.Bool(true),
 		Endpoint:             aws.String("localhost:4566"),
 		PresignURLExpiration: time.Minute,
+		MaxKeys:              2,
 	})
 	if err != nil {
 		panic(err)
@@ -4,29 +4,79 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 )
 
-const TypeS3 = "s3"
+// Supported storage types
+const (
+	TypeS3     = "s3"
+	TypeLocal  = "local"
+	TypeMemory = "memory"
+)
+
+// Operation names of Storage
+const (
+	OpUploadFile    = "UploadFile"
+	OpDownloadFile  = "DownloadFile"
+	OpDeleteFile    = "DeleteFile"
+	OpGetURL        = "GetURL"
+	OpExist         = "Exist"
+	OpList          = "List"
+	OpStat          = "Stat"
+	OpGetUploadURL  = "GetUploadURL"
+	OpDownloadRange = "DownloadRange"
+	OpCopy          = "Copy"
+	OpMove          = "Move"
+	OpDeleteMany    = "DeleteMany"
+)
+
+// ErrInvalidRange is returned if the requested range is not satisfiable
+var ErrInvalidRange = errors.New("invalid range")
+
+// defaultMaxKeys is the page size of List if it is not configured
+const defaultMaxKeys = 1000
 
 // Storage defines interface for store data file
 type Storage interface {
-	UploadFile(ctx context.Context, objectKey string, reader io.Reader) (string, error)
-	DownloadFile(ctx context.Context, objectKey string) (io.ReadCloser, error)
+	UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error)
+	DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error)
+	DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error)
 	DeleteFile(ctx context.Context, objectKey string) error
-	GetURL(ctx context.Context, objectKey string) (string, error)
+	DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error)
+	Copy(ctx context.Context, srcKey string, dstKey string) error
+	Move(ctx context.Context, srcKey string, dstKey string) error
+	GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error)
+	GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (*PresignedRequest, error)
 	Exist(ctx context.Context, objectKey string) (bool, error)
+	List(ctx context.Context, prefix string, cursor string) (*ListResult, error)
+	Stat(ctx context.Context, objectKey string) (*ObjectInfo, error)
+}
+
+// ObjectInfo defines the attributes of a stored object
+// Content attributes, metadata and tags are only returned by Stat
+type ObjectInfo struct {
+	Key                string            `json:"key"`
+	Size               int64             `json:"size"`
+	ETag               string            `json:"etag"`
+	LastModified       time.Time         `json:"last_modified"`
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+}
+
+// DownloadResult is the content of a downloaded object
+// ETag identifies the version which is read, pass it to WithIfMatch to update the object only if it has not changed since
+type DownloadResult struct {
+	io.ReadCloser
+	ETag string
 }
 
-// NewStorage creates a instance of FileStore with provided config
-func NewStorage(ctx context.Context, storageType string, config interface{}) (Storage, error) {
-	switch storageType {
-	case TypeS3:
-		cfg, ok := config.(S3Config)
-		if !ok {
-			return nil, errors.New("invalid config")
-		}
-		return newS3Storage(ctx, cfg)
-	}
-
-	return nil, errors.New("not found storage type")
+// ListResult is a page of objects returned by List
+// NextCursor is empty if there is no more page
+type ListResult struct {
+	Objects    []*ObjectInfo `json:"objects"`
+	NextCursor string        `json:"next_cursor"`
 }
@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer and the meter of instrumented storages
+const instrumentationName = "github.com/hungdv136/gokit/storage"
+
+// Attributes of spans and metrics of instrumented storages
+const (
+	attrBackend   = attribute.Key("storage.backend")
+	attrOperation = attribute.Key("storage.operation")
+	attrKey       = attribute.Key("storage.key")
+	attrDstKey    = attribute.Key("storage.destination_key")
+	attrPrefix    = attribute.Key("storage.prefix")
+	attrSize      = attribute.Key("storage.size")
+	attrOffset    = attribute.Key("storage.offset")
+	attrLength    = attribute.Key("storage.length")
+	attrKeyCount  = attribute.Key("storage.key_count")
+	attrErrorType = attribute.Key("error.type")
+
+	attrFailedKeyCount = attribute.Key("storage.failed_key_count")
+)
+
+// InstrumentOption modifies an instrumented storage
+type InstrumentOption func(*InstrumentedStorage)
+
+// WithTracerProvider sets the provider of spans. Default: the global provider
+func WithTracerProvider(provider trace.TracerProvider) InstrumentOption {
+	return func(s *InstrumentedStorage) {
+		s.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider sets the provider of metrics. Default: the global provider
+func WithMeterProvider(provider metric.MeterProvider) InstrumentOption {
+	return func(s *InstrumentedStorage) {
+		s.meterProvider = provider
+	}
+}
+
+// WithBackendName sets the storage.backend attribute. Default: the type of S3, local and memory storages
+func WithBackendName(name string) InstrumentOption {
+	return func(s *InstrumentedStorage) {
+		s.backend = name
+	}
+}
+
+// InstrumentedStorage records metrics and creates a span for every call of a storage
+// Spans are children of the span in the context, e.g. the span of ginkit.TracingMiddleware
+//
+//	storage.operations      calls by backend and operation
+//	storage.errors          failed calls by backend, operation and error.type, e.g. not_found
+//	storage.duration        latency in seconds. Downloads are measured until their body is closed
+//	storage.bytes_written   uploaded bytes
+//	storage.bytes_read      downloaded bytes
+type InstrumentedStorage struct {
+	storage        Storage
+	backend        string
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+
+	tracer       trace.Tracer
+	operations   metric.Int64Counter
+	errors       metric.Int64Counter
+	duration     metric.Float64Histogram
+	bytesWritten metric.Int64Counter
+	bytesRead    metric.Int64Counter
+}
+
+// NewInstrumentedStorage wraps a storage with metrics and tracing
+func NewInstrumentedStorage(s Storage, options ...InstrumentOption) (*InstrumentedStorage, error) {
+	i := &InstrumentedStorage{
+		storage:        s,
+		backend:        getBackendName(s),
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+	}
+	for _, option := range options {
+		option(i)
+	}
+
+	i.tracer = i.tracerProvider.Tracer(instrumentationName)
+	meter := i.meterProvider.Meter(instrumentationName)
+
+	var errs [5]error
+	i.operations, errs[0] = meter.Int64Counter("storage.operations", metric.WithUnit("{operation}"), metric.WithDescription("Calls of storage operations"))
+	i.errors, errs[1] = meter.Int64Counter("storage.errors", metric.WithUnit("{operation}"), metric.WithDescription("Failed calls of storage operations"))
+	i.duration, errs[2] = meter.Float64Histogram("storage.duration", metric.WithUnit("s"), metric.WithDescription("Latency of storage operations"))
+	i.bytesWritten, errs[3] = meter.Int64Counter("storage.bytes_written", metric.WithUnit("By"), metric.WithDescription("Bytes uploaded to storages"))
+	i.bytesRead, errs[4] = meter.Int64Counter("storage.bytes_read", metric.WithUnit("By"), metric.WithDescription("Bytes downloaded from storages"))
+	if err := errors.Join(errs[:]...); err != nil {
+		return nil, fmt.Errorf("unable to create storage metrics, %w", err)
+	}
+
+	return i, nil
+}
+
+// UploadFile records the uploaded bytes
+func (s *InstrumentedStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	ctx, c := s.start(ctx, OpUploadFile, attrKey.String(objectKey))
+	counter := &countingReader{reader: reader}
+	result, err := s.storage.UploadFile(ctx, objectKey, counter.wrap(), options...)
+	n := counter.n.Load()
+	s.bytesWritten.Add(ctx, n, metric.WithAttributes(c.attrs...))
+	c.end(err, attrSize.Int64(n))
+	return result, err
+}
+
+// DownloadFile records the downloaded bytes, the span ends when the body is closed
+func (s *InstrumentedStorage) DownloadFile(ctx context.Context, objectKey string, options ...DownloadOption) (*DownloadResult, error) {
+	ctx, c := s.start(ctx, OpDownloadFile, attrKey.String(objectKey))
+	result, err := s.storage.DownloadFile(ctx, objectKey, options...)
+	if err != nil {
+		c.end(err)
+		return nil, err
+	}
+
+	result.ReadCloser = newDownloadBody(c, result.ReadCloser)
+	return result, nil
+}
+
+// DownloadRange records the downloaded bytes, the span ends when the body is closed
+func (s *InstrumentedStorage) DownloadRange(ctx context.Context, objectKey string, offset int64, length int64) (io.ReadCloser, error) {
+	ctx, c := s.start(ctx, OpDownloadRange, attrKey.String(objectKey), attrOffset.Int64(offset), attrLength.Int64(length))
+	body, err := s.storage.DownloadRange(ctx, objectKey, offset, length)
+	if err != nil {
+		c.end(err)
+		return nil, err
+	}
+
+	return newDownloadBody(c, body), nil
+}
+
+// DeleteFile creates a span and records metrics
+func (s *InstrumentedStorage) DeleteFile(ctx context.Context, objectKey string) error {
+	ctx, c := s.start(ctx, OpDeleteFile, attrKey.String(objectKey))
+	err := s.storage.DeleteFile(ctx, objectKey)
+	c.end(err)
+	return err
+}
+
+// DeleteMany creates a span with the number of keys. Keys which fail are not counted as errors
+func (s *InstrumentedStorage) DeleteMany(ctx context.Context, objectKeys []string) (map[string]error, error) {
+	ctx, c := s.start(ctx, OpDeleteMany, attrKeyCount.Int(len(objectKeys)))
+	keyErrors, err := s.storage.DeleteMany(ctx, objectKeys)
+	c.end(err, attrFailedKeyCount.Int(len(keyErrors)))
+	return keyErrors, err
+}
+
+// Copy creates a span and records metrics
+func (s *InstrumentedStorage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	ctx, c := s.start(ctx, OpCopy, attrKey.String(srcKey), attrDstKey.String(dstKey))
+	err := s.storage.Copy(ctx, srcKey, dstKey)
+	c.end(err)
+	return err
+}
+
+// Move creates a span and records metrics
+func (s *InstrumentedStorage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	ctx, c := s.start(ctx, OpMove, attrKey.String(srcKey), attrDstKey.String(dstKey))
+	err := s.storage.Move(ctx, srcKey, dstKey)
+	c.end(err)
+	return err
+}
+
+// GetURL creates a span and records metrics
+func (s *InstrumentedStorage) GetURL(ctx context.Context, objectKey string, options ...PresignOption) (string, error) {
+	ctx, c := s.start(ctx, OpGetURL, attrKey.String(objectKey))
+	url, err := s.storage.GetURL(ctx, objectKey, options...)
+	c.end(err)
+	return url, err
+}
+
+// GetUploadURL creates a span and records metrics
+func (s *InstrumentedStorage) GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (*PresignedRequest, error) {
+	ctx, c := s.start(ctx, OpGetUploadURL, attrKey.String(objectKey))
+	req, err := s.storage.GetUploadURL(ctx, objectKey, options...)
+	c.end(err)
+	return req, err
+}
+
+// Exist creates a span and records metrics
+func (s *InstrumentedStorage) Exist(ctx context.Context, objectKey string) (bool, error) {
+	ctx, c := s.start(ctx, OpExist, attrKey.String(objectKey))
+	existed, err := s.storage.Exist(ctx, objectKey)
+	c.end(err)
+	return existed, err
+}
+
+// List creates a span with the number of listed objects
+func (s *InstrumentedStorage) List(ctx context.Context, prefix string, cursor string) (*ListResult, error) {
+	ctx, c := s.start(ctx, OpList, attrPrefix.String(prefix))
+	result, err := s.storage.List(ctx, prefix, cursor)
+	if err != nil {
+		c.end(err)
+		return nil, err
+	}
+
+	c.end(nil, attrKeyCount.Int(len(result.Objects)))
+	return result, nil
+}
+
+// Stat creates a span with the size of the object
+func (s *InstrumentedStorage) Stat(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	ctx, c := s.start(ctx, OpStat, attrKey.String(objectKey))
+	info, err := s.storage.Stat(ctx, objectKey)
+	if err != nil {
+		c.end(err)
+		return nil, err
+	}
+
+	c.end(nil, attrSize.Int64(info.Size))
+	return info, nil
+}
+
+// call is an operation in progress
+type call struct {
+	storage *InstrumentedStorage
+	ctx     context.Context
+	span    trace.Span
+	start   time.Time
+	attrs   []attribute.KeyValue // Attributes of metrics, keys are only set on spans to keep the cardinality low
+}
+
+func (s *InstrumentedStorage) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, *call) {
+	metricAttrs := []attribute.KeyValue{attrBackend.String(s.backend), attrOperation.String(operation)}
+	ctx, span := s.tracer.Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(metricAttrs...),
+		trace.WithAttributes(attrs...),
+	)
+
+	return ctx, &call{storage: s, ctx: ctx, span: span, start: time.Now(), attrs: metricAttrs}
+}
+
+// end records the call and ends its span
+// Not-found is recorded as an error of metrics but does not mark the span as failed since callers often expect it
+func (c *call) end(err error, attrs ...attribute.KeyValue) {
+	s := c.storage
+	c.span.SetAttributes(attrs...)
+	s.operations.Add(c.ctx, 1, metric.WithAttributes(c.attrs...))
+	s.duration.Record(c.ctx, time.Since(c.start).Seconds(), metric.WithAttributes(c.attrs...))
+	if err != nil {
+		errorType := getErrorType(err)
+		s.errors.Add(c.ctx, 1, metric.WithAttributes(append(c.attrs, attrErrorType.String(errorType))...))
+		c.span.SetAttributes(attrErrorType.String(errorType))
+		if !errors.Is(err, ErrNotFound) {
+			c.span.RecordError(err)
+			c.span.SetStatus(codes.Error, err.Error())
+		}
+	}
+
+	c.span.End()
+}
+
+// downloadBody counts downloaded bytes and ends the call when it is closed
+type downloadBody struct {
+	io.ReadCloser
+	call *call
+	n    int64
+	err  error
+	once sync.Once
+}
+
+func newDownloadBody(c *call, body io.ReadCloser) *downloadBody {
+	return &downloadBody{ReadCloser: body, call: c}
+}
+
+func (b *downloadBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.err = err
+	}
+
+	return n, err
+}
+
+// Close ends the call with the first error of reading
+func (b *downloadBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		c := b.call
+		c.storage.bytesRead.Add(c.ctx, b.n, metric.WithAttributes(c.attrs...))
+		c.end(b.err, attrSize.Int64(b.n))
+	})
+
+	return err
+}
+
+// countingReader counts the bytes read. Parts of uploads may be read concurrently with ReadAt
+type countingReader struct {
+	reader io.Reader
+	n      atomic.Int64
+}
+
+// wrap keeps io.Seeker and io.ReaderAt of the reader, storages use them to know sizes and read parts concurrently
+func (r *countingReader) wrap() io.Reader {
+	if _, ok := r.reader.(io.Seeker); !ok {
+		return r
+	}
+
+	if _, ok := r.reader.(io.ReaderAt); ok {
+		return &countingReadSeekerAt{countingReadSeeker{r}}
+	}
+
+	return &countingReadSeeker{r}
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+type countingReadSeeker struct {
+	*countingReader
+}
+
+func (r *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.reader.(io.Seeker).Seek(offset, whence)
+}
+
+type countingReadSeekerAt struct {
+	countingReadSeeker
+}
+
+func (r *countingReadSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.reader.(io.ReaderAt).ReadAt(p, off)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// getBackendName returns the storage type of built-in backends and the Go type of others
+func getBackendName(s Storage) string {
+	switch s.(type) {
+	case *S3Storage:
+		return TypeS3
+	case *LocalStorage:
+		return TypeLocal
+	case *MemoryStorage:
+		return TypeMemory
+	default:
+		return fmt.Sprintf("%T", s)
+	}
+}
+
+// getErrorType returns a low-cardinality name of storage errors
+func getErrorType(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrAccessDenied):
+		return "access_denied"
+	case errors.Is(err, ErrPreconditionFailed):
+		return "precondition_failed"
+	case errors.Is(err, ErrQuotaExceeded):
+		return "quota_exceeded"
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrInvalidRange):
+		return "invalid_range"
+	case errors.Is(err, ErrValidationFailed):
+		return "validation_failed"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentedStorage(t *testing.T) {
+	t.Parallel()
+
+	tracer := &testTracer{}
+	meter := &testMeter{values: map[string]float64{}}
+	backend := NewMemoryStorage()
+	s, err := NewInstrumentedStorage(backend, WithTracerProvider(tracer), WithMeterProvider(&testMeterProvider{meter: meter}))
+	require.NoError(t, err)
+
+	// Spans are children of the span of the request
+	requestSpan := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}})
+	ctx := trace.ContextWithSpanContext(context.Background(), requestSpan)
+
+	_, err = s.UploadFile(ctx, "a.txt", strings.NewReader("hello"))
+	require.NoError(t, err)
+
+	download, err := s.DownloadFile(ctx, "a.txt")
+	require.NoError(t, err)
+	content, err := io.ReadAll(download)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(content))
+	require.Len(t, tracer.getSpans(), 1, "downloads end when they are closed")
+	require.NoError(t, download.Close())
+	require.NoError(t, download.Close())
+
+	_, err = s.Stat(ctx, "missing.txt")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	backend.InjectFault(Fault{Operation: OpDeleteFile, Err: ErrAccessDenied})
+	require.ErrorIs(t, s.DeleteFile(ctx, "a.txt"), ErrAccessDenied)
+
+	spans := tracer.getSpans()
+	require.Len(t, spans, 4)
+	for _, span := range spans {
+		require.Equal(t, requestSpan.TraceID(), span.parent.TraceID())
+		require.Equal(t, requestSpan.SpanID(), span.parent.SpanID())
+		require.True(t, span.ended)
+		require.Equal(t, "memory", span.attrs[attrBackend].AsString())
+	}
+
+	upload, stat, deletion := spans[0], spans[2], spans[3]
+	require.Equal(t, "storage.UploadFile", upload.name)
+	require.Equal(t, "a.txt", upload.attrs[attrKey].AsString())
+	require.Equal(t, int64(5), upload.attrs[attrSize].AsInt64())
+	require.Equal(t, int64(5), spans[1].attrs[attrSize].AsInt64())
+	require.Equal(t, "not_found", stat.attrs[attrErrorType].AsString())
+	require.Equal(t, codes.Unset, stat.status, "not-found is not a failure of the span")
+	require.Equal(t, codes.Error, deletion.status)
+	require.Equal(t, "access_denied", deletion.attrs[attrErrorType].AsString())
+
+	require.Equal(t, 1.0, meter.get("storage.operations", OpUploadFile, ""))
+	require.Equal(t, 1.0, meter.get("storage.operations", OpDownloadFile, ""))
+	require.Equal(t, 5.0, meter.get("storage.bytes_written", OpUploadFile, ""))
+	require.Equal(t, 5.0, meter.get("storage.bytes_read", OpDownloadFile, ""))
+	require.Equal(t, 1.0, meter.get("storage.errors", OpStat, "not_found"))
+	require.Equal(t, 1.0, meter.get("storage.errors", OpDeleteFile, "access_denied"))
+	require.Equal(t, 4.0, meter.get("storage.duration", "", ""))
+}
+
+func TestInstrumentedStorage_Operations(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tracer := &testTracer{}
+	s, err := NewInstrumentedStorage(NewMemoryStorage(), WithTracerProvider(tracer), WithBackendName("attachments"))
+	require.NoError(t, err)
+
+	_, err = s.UploadFile(ctx, "a.txt", bytes.NewReader([]byte("0123456789")))
+	require.NoError(t, err)
+	reader, err := s.DownloadRange(ctx, "a.txt", 2, 3)
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.NoError(t, s.Copy(ctx, "a.txt", "b.txt"))
+	require.NoError(t, s.Move(ctx, "b.txt", "c.txt"))
+	_, err = s.Exist(ctx, "a.txt")
+	require.NoError(t, err)
+	_, err = s.List(ctx, "", "")
+	require.NoError(t, err)
+	_, err = s.GetURL(ctx, "a.txt")
+	require.NoError(t, err)
+	_, err = s.GetUploadURL(ctx, "d.txt")
+	require.NoError(t, err)
+	_, err = s.DeleteMany(ctx, []string{"a.txt", "c.txt"})
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, span := range tracer.getSpans() {
+		names = append(names, span.name)
+		require.Equal(t, "attachments", span.attrs[attrBackend].AsString())
+	}
+
+	require.Equal(t, []string{
+		"storage.UploadFile", "storage.DownloadRange", "storage.Copy", "storage.Move", "storage.Exist",
+		"storage.List", "storage.GetURL", "storage.GetUploadURL", "storage.DeleteMany",
+	}, names)
+}
+
+func TestInstrumentedStorage_UploadProgress(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	meter := &testMeter{values: map[string]float64{}}
+	s, err := NewInstrumentedStorage(NewMemoryStorage(), WithMeterProvider(&testMeterProvider{meter: meter}))
+	require.NoError(t, err)
+
+	// Sizes of seekable readers are known in advance
+	totals := []int64{}
+	_, err = s.UploadFile(ctx, "a.txt", bytes.NewReader([]byte("0123456789")), WithProgress(func(sent int64, total int64) {
+		totals = append(totals, total)
+	}))
+	require.NoError(t, err)
+	require.NotEmpty(t, totals)
+	for _, total := range totals {
+		require.Equal(t, int64(10), total)
+	}
+
+	require.Equal(t, 10.0, meter.get("storage.bytes_written", OpUploadFile, ""))
+
+	counter := &countingReader{reader: bytes.NewReader([]byte("hello"))}
+	_, ok := counter.wrap().(io.ReaderAt)
+	require.True(t, ok)
+	_, ok = (&countingReader{reader: strings.NewReader("hello")}).wrap().(io.Seeker)
+	require.True(t, ok)
+	_, ok = (&countingReader{reader: io.LimitReader(strings.NewReader("hello"), 2)}).wrap().(io.Seeker)
+	require.False(t, ok)
+}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type testSpan struct {
+	trace.Span
+	tracer *testTracer
+	name   string
+	parent trace.SpanContext
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	ended  bool
+}
+
+func (t *testTracer) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return t
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &testSpan{
+		Span:   trace.SpanFromContext(context.Background()),
+		tracer: t,
+		name:   name,
+		parent: trace.SpanContextFromContext(ctx),
+		attrs:  map[attribute.Key]attribute.Value{},
+	}
+	config := trace.NewSpanStartConfig(options...)
+	span.SetAttributes(config.Attributes()...)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (t *testTracer) getSpans() []*testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*testSpan{}, t.spans...)
+}
+
+func (s *testSpan) SetAttributes(attrs ...attribute.KeyValue) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) SetStatus(code codes.Code, _ string) {
+	s.status = code
+}
+
+// End registers the span, spans are listed in the order they end
+func (s *testSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+	s.tracer.register(s)
+}
+
+func (t *testTracer) register(span *testSpan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = append(t.spans, span)
+}
+
+type testMeterProvider struct {
+	noop.MeterProvider
+	meter *testMeter
+}
+
+func (p *testMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return p.meter
+}
+
+// testMeter sums measurements by name, operation and error type
+type testMeter struct {
+	noop.Meter
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+type testInstrument struct {
+	noop.Int64Counter
+	name  string
+	meter *testMeter
+}
+
+type testHistogram struct {
+	noop.Float64Histogram
+	name  string
+	meter *testMeter
+}
+
+func (m *testMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &testInstrument{name: name, meter: m}, nil
+}
+
+func (m *testMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &testHistogram{name: name, meter: m}, nil
+}
+
+func (i *testInstrument) Add(_ context.Context, incr int64, options ...metric.AddOption) {
+	i.meter.add(i.name, float64(incr), metric.NewAddConfig(options).Attributes())
+}
+
+// Record counts the measurements of histograms
+func (h *testHistogram) Record(_ context.Context, _ float64, options ...metric.RecordOption) {
+	attrs := metric.NewRecordConfig(options).Attributes()
+	h.meter.add(h.name, 1, attrs)
+}
+
+func (m *testMeter) add(name string, value float64, attrs attribute.Set) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	operation, _ := attrs.Value(attrOperation)
+	errorType, _ := attrs.Value(attrErrorType)
+	m.values[name+"|"+operation.AsString()+"|"+errorType.AsString()] += value
+	m.values[name+"||"] += value
+}
+
+func (m *testMeter) get(name string, operation string, errorType string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.values[name+"|"+operation+"|"+errorType]
+}
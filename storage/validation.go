@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/hungdv136/gokit/logger"
+)
+
+// Reasons of rejected uploads, they are wrapped in a ValidationError
+var (
+	ErrValidationFailed      = errors.New("upload validation failed")
+	ErrFileTooLarge          = errors.New("file is too large")
+	ErrContentTypeNotAllowed = errors.New("content type is not allowed")
+	ErrExtensionNotAllowed   = errors.New("file extension is not allowed")
+	ErrMalwareDetected       = errors.New("malware detected")
+)
+
+// ErrValidatedUploadURL is returned by ValidatingStorage.GetUploadURL if contents must be sniffed or scanned, or sizes are not declared
+var ErrValidatedUploadURL = errors.New("presigned uploads bypass content validation")
+
+// ValidationError describes a rejected upload. It matches ErrValidationFailed and its reason with errors.Is
+type ValidationError struct {
+	ObjectKey   string
+	ContentType string // Sniffed content type, empty if the content is not read
+	Err         error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("upload of %q is rejected: %v", e.ObjectKey, e.Err)
+}
+
+// Is makes errors.Is(err, ErrValidationFailed) true
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidationFailed
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Scanner scans contents of uploads, e.g. with an antivirus
+// Scan reads the content while it is uploaded. Infected contents return an error which wraps ErrMalwareDetected
+// Other errors fail the upload too, objects are not stored unless Scan returns nil
+type Scanner interface {
+	Scan(ctx context.Context, objectKey string, content io.Reader) error
+}
+
+// ScannerFunc adapts a function to Scanner
+type ScannerFunc func(ctx context.Context, objectKey string, content io.Reader) error
+
+// Scan calls f
+func (f ScannerFunc) Scan(ctx context.Context, objectKey string, content io.Reader) error {
+	return f(ctx, objectKey, content)
+}
+
+// ValidationOption modifies a validating storage
+type ValidationOption func(*ValidatingStorage)
+
+// WithMaxUploadSize rejects uploads which are larger than n bytes
+func WithMaxUploadSize(n int64) ValidationOption {
+	return func(s *ValidatingStorage) {
+		s.maxSize = n
+	}
+}
+
+// WithAllowedContentTypes rejects uploads whose sniffed content type is not in the list, e.g. image/png or image/*
+// Content types are sniffed with http.DetectContentType, e.g. CSV files are text/plain
+func WithAllowedContentTypes(contentTypes ...string) ValidationOption {
+	return func(s *ValidatingStorage) {
+		s.contentTypes = append(s.contentTypes, contentTypes...)
+	}
+}
+
+// WithAllowedExtensions rejects keys whose extension is not in the list, e.g. .jpg. Extensions are case-insensitive
+func WithAllowedExtensions(extensions ...string) ValidationOption {
+	return func(s *ValidatingStorage) {
+		for _, ext := range extensions {
+			s.extensions[strings.ToLower(ext)] = true
+		}
+	}
+}
+
+// WithScanner scans contents of uploads
+func WithScanner(scanner Scanner) ValidationOption {
+	return func(s *ValidatingStorage) {
+		s.scanner = scanner
+	}
+}
+
+// ValidatingStorage validates uploads while they are streamed to the wrapped storage
+// The key is checked first, then the sniffed content type before anything is sent, then the size while streaming
+// The scanner reads the content along with the storage, the upload fails before it is completed if the scan fails
+// Rejected uploads return a ValidationError and are not stored
+type ValidatingStorage struct {
+	Storage
+	maxSize      int64
+	contentTypes []string
+	extensions   map[string]bool
+	scanner      Scanner
+}
+
+// NewValidatingStorage wraps a storage with upload validation
+func NewValidatingStorage(s Storage, options ...ValidationOption) *ValidatingStorage {
+	v := &ValidatingStorage{Storage: s, extensions: map[string]bool{}}
+	for _, option := range options {
+		option(v)
+	}
+
+	return v
+}
+
+// MaxUploadSize returns the maximum size of uploads, 0 means no limit
+// Use it to limit request bodies so HTTP handlers and the storage agree on the limit
+func (s *ValidatingStorage) MaxUploadSize() int64 {
+	return s.maxSize
+}
+
+// Check validates what is known before an upload, e.g. a file name and a declared size of a multipart form
+// Negative sizes are unknown
+func (s *ValidatingStorage) Check(objectKey string, size int64) error {
+	if len(s.extensions) > 0 && !s.extensions[strings.ToLower(filepath.Ext(objectKey))] {
+		return &ValidationError{ObjectKey: objectKey, Err: fmt.Errorf("%w: %q", ErrExtensionNotAllowed, filepath.Ext(objectKey))}
+	}
+
+	if s.maxSize > 0 && size > s.maxSize {
+		return &ValidationError{ObjectKey: objectKey, Err: fmt.Errorf("%w: %d bytes, limit is %d bytes", ErrFileTooLarge, size, s.maxSize)}
+	}
+
+	return nil
+}
+
+// UploadFile validates the upload while streaming it to the wrapped storage
+// A declared content type must be allowed too, otherwise clients could label contents with another allowed type
+func (s *ValidatingStorage) UploadFile(ctx context.Context, objectKey string, reader io.Reader, options ...UploadOption) (*UploadResult, error) {
+	if err := s.Check(objectKey, getRemainingSize(reader)); err != nil {
+		logger.Warn(ctx, err.Error())
+		return nil, err
+	}
+
+	if declared := newUploadOptions(options).ContentType; len(declared) > 0 && !s.allowsContentType(declared) {
+		err := &ValidationError{ObjectKey: objectKey, Err: fmt.Errorf("%w: declared %q", ErrContentTypeNotAllowed, declared)}
+		logger.Warn(ctx, err.Error())
+		return nil, err
+	}
+
+	validated := &validatingReader{reader: reader, objectKey: objectKey, limit: s.maxSize}
+	head, err := io.ReadAll(io.LimitReader(validated, sniffLength))
+	if err != nil {
+		logger.Warn(ctx, err.Error())
+		return nil, err
+	}
+
+	validated.contentType = http.DetectContentType(head)
+	if !s.allowsContentType(validated.contentType) {
+		err := &ValidationError{ObjectKey: objectKey, ContentType: validated.contentType, Err: ErrContentTypeNotAllowed}
+		logger.Warn(ctx, err.Error())
+		return nil, err
+	}
+
+	if s.scanner != nil {
+		validated.scan = startScan(ctx, s.scanner, objectKey)
+	}
+
+	validated.reader, validated.read = io.MultiReader(bytes.NewReader(head), reader), 0
+	result, err := s.Storage.UploadFile(ctx, objectKey, validated, options...)
+	validated.scan.abort()
+	if validated.err != nil {
+		// The storage may wrap errors of the reader in its own errors, the validation error is returned as is
+		logger.Warn(ctx, validated.err.Error())
+		return nil, validated.err
+	}
+
+	return result, err
+}
+
+// Copy checks the extension of the destination key
+func (s *ValidatingStorage) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	if err := s.Check(dstKey, -1); err != nil {
+		logger.Warn(ctx, err.Error())
+		return err
+	}
+
+	return s.Storage.Copy(ctx, srcKey, dstKey)
+}
+
+// Move checks the extension of the destination key
+func (s *ValidatingStorage) Move(ctx context.Context, srcKey string, dstKey string) error {
+	if err := s.Check(dstKey, -1); err != nil {
+		logger.Warn(ctx, err.Error())
+		return err
+	}
+
+	return s.Storage.Move(ctx, srcKey, dstKey)
+}
+
+// GetUploadURL checks the key and the content length of presigned uploads
+// Presigned uploads of a storage with a maximum size must require their length with WithRequiredContentLength
+// Contents of presigned uploads cannot be sniffed or scanned, ErrValidatedUploadURL is returned if they must be
+func (s *ValidatingStorage) GetUploadURL(ctx context.Context, objectKey string, options ...PresignOption) (*PresignedRequest, error) {
+	size := newPresignOptions(0, options).ContentLength
+	if len(s.contentTypes) > 0 || s.scanner != nil || (s.maxSize > 0 && size <= 0) {
+		logger.Error(ctx, fmt.Errorf("unable to presign upload of %q, %w", objectKey, ErrValidatedUploadURL))
+		return nil, ErrValidatedUploadURL
+	}
+
+	if size <= 0 {
+		size = -1
+	}
+
+	if err := s.Check(objectKey, size); err != nil {
+		logger.Warn(ctx, err.Error())
+		return nil, err
+	}
+
+	return s.Storage.GetUploadURL(ctx, objectKey, options...)
+}
+
+// allowsContentType matches the media type without parameters against the allow-list, which may have wildcards
+func (s *ValidatingStorage) allowsContentType(contentType string) bool {
+	if len(s.contentTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range s.contentTypes {
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, allowed[:len(allowed)-1])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validatingReader enforces the size limit and feeds the scanner
+// Its first error stops the upload and is kept since storages may wrap it
+type validatingReader struct {
+	reader      io.Reader
+	objectKey   string
+	contentType string
+	limit       int64
+	read        int64
+	scan        *scan
+	err         error
+}
+
+func (r *validatingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.reader.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		// The request body is limited by http.MaxBytesReader, e.g. ginkit.MaxBody
+		return 0, r.fail(fmt.Errorf("%w: limit of the request is %d bytes", ErrFileTooLarge, maxBytesErr.Limit))
+	}
+
+	r.read += int64(n)
+	if r.limit > 0 && r.read > r.limit {
+		return 0, r.fail(fmt.Errorf("%w: limit is %d bytes", ErrFileTooLarge, r.limit))
+	}
+
+	if r.scan != nil {
+		if scanErr := r.scan.write(p[:n]); scanErr != nil {
+			return 0, r.fail(scanErr)
+		}
+
+		if errors.Is(err, io.EOF) {
+			if scanErr := r.scan.wait(); scanErr != nil {
+				return 0, r.fail(scanErr)
+			}
+		}
+	}
+
+	return n, err
+}
+
+// fail keeps the error which stops the upload. Malware is a validation error, other scan failures are not
+func (r *validatingReader) fail(err error) error {
+	if errors.Is(err, ErrFileTooLarge) || errors.Is(err, ErrMalwareDetected) {
+		r.err = &ValidationError{ObjectKey: r.objectKey, ContentType: r.contentType, Err: err}
+	} else {
+		r.err = fmt.Errorf("unable to scan %q, %w", r.objectKey, err)
+	}
+
+	return r.err
+}
+
+// scan runs a scanner on a pipe which is written while the content is uploaded
+type scan struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+func startScan(ctx context.Context, scanner Scanner, objectKey string) *scan {
+	pr, pw := io.Pipe()
+	sc := &scan{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(sc.done)
+		sc.err = scanner.Scan(ctx, objectKey, pr)
+		// Unblock writes if the scanner returns before reading the whole content
+		_ = pr.Close()
+	}()
+
+	return sc
+}
+
+// write sends content to the scanner. It returns the result of the scanner if the scanner has returned early
+func (sc *scan) write(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	if _, err := sc.pw.Write(p); err != nil {
+		<-sc.done
+		return sc.err
+	}
+
+	return nil
+}
+
+// wait ends the content and waits for the result of the scanner
+func (sc *scan) wait() error {
+	_ = sc.pw.Close()
+	<-sc.done
+	return sc.err
+}
+
+// abort stops a scanner which has not reached the end of the content
+func (sc *scan) abort() {
+	if sc == nil {
+		return
+	}
+
+	_ = sc.pw.CloseWithError(io.ErrUnexpectedEOF)
+	<-sc.done
+}
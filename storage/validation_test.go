@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func TestValidatingStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	png := encodeTestImage(t, "png", 8, 8)
+	scanner := ScannerFunc(func(_ context.Context, _ string, content io.Reader) error {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Contains(data, []byte("EICAR")) {
+			return fmt.Errorf("%w: EICAR test file", ErrMalwareDetected)
+		}
+
+		return nil
+	})
+
+	testCases := []struct {
+		name        string
+		key         string
+		reader      io.Reader
+		options     []UploadOption
+		expectedErr error
+	}{
+		{name: "allowed", key: "a.png", reader: bytes.NewReader(png)},
+		{name: "upper case extension", key: "a.PNG", reader: bytes.NewReader(png)},
+		{name: "extension", key: "a.exe", reader: bytes.NewReader(png), expectedErr: ErrExtensionNotAllowed},
+		{name: "sniffed type", key: "a.png", reader: strings.NewReader("<html><script></script></html>"), expectedErr: ErrContentTypeNotAllowed},
+		{name: "declared type", key: "a.png", reader: bytes.NewReader(png), options: []UploadOption{WithContentType("text/html")}, expectedErr: ErrContentTypeNotAllowed},
+		{name: "known size", key: "a.png", reader: bytes.NewReader(append(png, make([]byte, 2048)...)), expectedErr: ErrFileTooLarge},
+		{name: "streamed size", key: "a.png", reader: io.MultiReader(bytes.NewReader(png), bytes.NewReader(make([]byte, 2048))), expectedErr: ErrFileTooLarge},
+		{name: "malware", key: "a.txt", reader: io.MultiReader(strings.NewReader("hello "), strings.NewReader(eicar)), expectedErr: ErrMalwareDetected},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			backend := NewMemoryStorage()
+			s := NewValidatingStorage(backend,
+				WithMaxUploadSize(1024),
+				WithAllowedContentTypes("image/*", "text/plain"),
+				WithAllowedExtensions(".png", ".txt"),
+				WithScanner(scanner),
+			)
+
+			_, err := s.UploadFile(ctx, tc.key, tc.reader, tc.options...)
+			existed, existErr := backend.Exist(ctx, tc.key)
+			require.NoError(t, existErr)
+			if tc.expectedErr == nil {
+				require.NoError(t, err)
+				require.True(t, existed)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrValidationFailed)
+			require.ErrorIs(t, err, tc.expectedErr)
+			require.False(t, existed)
+		})
+	}
+}
+
+func TestValidatingStorage_Scanner(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789"), 10_000)
+
+	// The scanner reads the whole content along with the storage
+	var scanned []byte
+	backend := NewMemoryStorage()
+	s := NewValidatingStorage(backend, WithScanner(ScannerFunc(func(_ context.Context, _ string, r io.Reader) error {
+		var err error
+		scanned, err = io.ReadAll(r)
+		return err
+	})))
+	_, err := s.UploadFile(ctx, "a.txt", bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, content, scanned)
+	require.Equal(t, string(content), string(readAll(t, backend, "a.txt")))
+
+	// Scanners may stop before the end of the content
+	s = NewValidatingStorage(backend, WithScanner(ScannerFunc(func(_ context.Context, _ string, r io.Reader) error {
+		_, err := io.ReadFull(r, make([]byte, 10))
+		return err
+	})))
+	_, err = s.UploadFile(ctx, "b.txt", bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, string(content), string(readAll(t, backend, "b.txt")))
+
+	// Failures of scanners are not validation errors but fail the upload
+	errUnavailable := errors.New("scanner is unavailable")
+	s = NewValidatingStorage(backend, WithScanner(ScannerFunc(func(context.Context, string, io.Reader) error {
+		return errUnavailable
+	})))
+	_, err = s.UploadFile(ctx, "c.txt", bytes.NewReader(content))
+	require.ErrorIs(t, err, errUnavailable)
+	require.NotErrorIs(t, err, ErrValidationFailed)
+	existed, err := backend.Exist(ctx, "c.txt")
+	require.NoError(t, err)
+	require.False(t, existed)
+
+	// Scanners are stopped if the storage fails
+	errDown := errors.New("storage is down")
+	backend.InjectFault(Fault{Operation: OpUploadFile, Err: errDown})
+	s = NewValidatingStorage(backend, WithScanner(ScannerFunc(func(_ context.Context, _ string, r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return err
+	})))
+	_, err = s.UploadFile(ctx, "d.txt", bytes.NewReader(content))
+	require.ErrorIs(t, err, errDown)
+}
+
+func TestValidatingStorage_MaxBytesReader(t *testing.T) {
+	t.Parallel()
+
+	backend := NewMemoryStorage()
+	s := NewValidatingStorage(backend)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1024)
+		_, err := s.UploadFile(r.Context(), "a.bin", r.Body)
+		require.ErrorIs(t, err, ErrFileTooLarge)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(make([]byte, 4096))))
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestValidatingStorage_Keys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := NewMemoryStorage()
+	_, err := backend.UploadFile(ctx, "a.txt", strings.NewReader("hello"))
+	require.NoError(t, err)
+
+	s := NewValidatingStorage(backend, WithAllowedExtensions(".txt"), WithMaxUploadSize(1024))
+	require.ErrorIs(t, s.Copy(ctx, "a.txt", "a.html"), ErrExtensionNotAllowed)
+	require.ErrorIs(t, s.Move(ctx, "a.txt", "a.html"), ErrExtensionNotAllowed)
+	require.NoError(t, s.Copy(ctx, "a.txt", "b.txt"))
+	require.ErrorIs(t, s.Check("big.txt", 2048), ErrFileTooLarge)
+	require.Equal(t, int64(1024), s.MaxUploadSize())
+
+	_, err = s.GetUploadURL(ctx, "a.html", WithRequiredContentLength(5))
+	require.ErrorIs(t, err, ErrExtensionNotAllowed)
+	_, err = s.GetUploadURL(ctx, "c.txt", WithRequiredContentLength(5))
+	require.NoError(t, err)
+
+	// Presigned uploads must declare lengths within the maximum size
+	_, err = s.GetUploadURL(ctx, "c.txt")
+	require.ErrorIs(t, err, ErrValidatedUploadURL)
+	_, err = s.GetUploadURL(ctx, "c.txt", WithRequiredContentLength(2048))
+	require.ErrorIs(t, err, ErrFileTooLarge)
+	require.ErrorIs(t, err, ErrValidationFailed)
+
+	_, err = NewValidatingStorage(backend).GetUploadURL(ctx, "c.txt")
+	require.NoError(t, err)
+
+	s = NewValidatingStorage(backend, WithAllowedContentTypes("text/plain"))
+	_, err = s.GetUploadURL(ctx, "c.txt")
+	require.ErrorIs(t, err, ErrValidatedUploadURL)
+}